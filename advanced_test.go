@@ -42,6 +42,24 @@ func TestFingerprintProfileMaximum(t *testing.T) {
 	t.Log("FingerprintProfileMaximum correctly generated dynamic JA3 and shuffled headers.")
 }
 
+func TestFingerprintProfileMaximumValidation(t *testing.T) {
+	for _, browser := range []Browser{BrowserChrome, BrowserEdge, BrowserFirefox, BrowserSafari, BrowserOpera, BrowserBrave} {
+		t.Run(string(browser), func(t *testing.T) {
+			g := NewGenerator(WithBrowsers(browser), WithFingerprintProfile(FingerprintProfileMaximum), WithValidation(ValidationReject))
+			for range 20 {
+				agent, err := g.Generate()
+				if err != nil {
+					t.Fatalf("Generate failed: %v", err)
+				}
+				if agent.ClientHelloSpec == nil {
+					t.Errorf("Expected a dynamic ClientHelloSpec for %s", agent.UserAgent)
+				}
+				g.ReleaseAgent(agent)
+			}
+		})
+	}
+}
+
 func TestFingerprintProfileNormal(t *testing.T) {
 	g := NewGenerator(WithFingerprintProfile(FingerprintProfileNormal))
 
@@ -68,7 +86,7 @@ func TestBrowserSpecificH2Settings(t *testing.T) {
 
 	for browser, expectedSettings := range testCases {
 		t.Run(string(browser), func(t *testing.T) {
-			g := NewGenerator(WithBrowsers(browser))
+			g := NewGenerator(WithBrowsers(browser), WithPlatforms(PlatformDesktop))
 
 			agent, err := g.Generate()
 			if err != nil {
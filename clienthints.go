@@ -0,0 +1,330 @@
+package legitagent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrMissingClientHints = errors.New("legitagent: sec-ch-ua or sec-ch-ua-full-version-list is required")
+
+var structuredBrandRegex = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"\s*;\s*v\s*=\s*"((?:[^"\\]|\\.)*)"`)
+
+var clientHintPlatforms = map[string]OperatingSystem{
+	"Windows":   OSWindows,
+	"macOS":     osMacIntel,
+	"Linux":     OSLinux,
+	"Android":   OSAndroid,
+	"Chrome OS": OSChromeOS,
+	"ChromeOS":  OSChromeOS,
+}
+
+const (
+	uaReductionMinVersion = 110
+	formFactorsMinVersion = 124
+)
+
+var highEntropyClientHints = []string{
+	"sec-ch-ua-arch",
+	"sec-ch-ua-bitness",
+	"sec-ch-ua-form-factors",
+	"sec-ch-ua-full-version-list",
+	"sec-ch-ua-model",
+	"sec-ch-ua-platform-version",
+	"sec-ch-ua-wow64",
+}
+
+var reducedPlatformTokens = map[OperatingSystem]string{
+	OSWindows:         "Windows NT 10.0; Win64; x64",
+	OSWindows11:       "Windows NT 10.0; Win64; x64",
+	osMacIntel:        "Macintosh; Intel Mac OS X 10_15_7",
+	osMacAppleSilicon: "Macintosh; Intel Mac OS X 10_15_7",
+	OSLinux:           "X11; Linux x86_64",
+	osUbuntu:          "X11; Linux x86_64",
+	osFedora:          "X11; Linux x86_64",
+	OSChromeOS:        "X11; CrOS x86_64 14541.0.0",
+	OSAndroid:         "Linux; Android 10; K",
+	osAndroidTablet:   "Linux; Android 10; K",
+}
+
+type clientHintBrand struct {
+	Brand   string
+	Version string
+}
+
+func parseBrandList(value string) []clientHintBrand {
+	unescape := strings.NewReplacer(`\"`, `"`, `\\`, `\`)
+
+	var brands []clientHintBrand
+	for _, m := range structuredBrandRegex.FindAllStringSubmatch(value, -1) {
+		brands = append(brands, clientHintBrand{Brand: unescape.Replace(m[1]), Version: unescape.Replace(m[2])})
+	}
+	return brands
+}
+
+func isGreaseBrand(brand string) bool {
+	if brand == "Chromium" || browserForBrand(brand) != "" {
+		return false
+	}
+	return strings.Contains(brand, "Not") && strings.Contains(brand, "Brand")
+}
+
+func browserForBrand(brand string) Browser {
+	for _, b := range allRealBrowsers {
+		if p := DefaultProfilePack().browsers[b]; p.ChromiumBased && p.Brand == brand {
+			return b
+		}
+	}
+	return ""
+}
+
+func unquoteClientHint(v string) string {
+	v = strings.TrimSpace(v)
+	if s, err := strconv.Unquote(v); err == nil {
+		return s
+	}
+	return strings.Trim(v, `"`)
+}
+
+func FromClientHints(h http.Header) (*Agent, error) {
+	list := h.Get("sec-ch-ua-full-version-list")
+	if list == "" {
+		list = h.Get("sec-ch-ua")
+	}
+	if list == "" {
+		return nil, ErrMissingClientHints
+	}
+
+	var browser Browser
+	var brandVersion, chromiumVersion string
+	for _, b := range parseBrandList(list) {
+		switch {
+		case isGreaseBrand(b.Brand):
+		case b.Brand == "Chromium":
+			chromiumVersion = b.Version
+		case browserForBrand(b.Brand) != "":
+			browser, brandVersion = browserForBrand(b.Brand), b.Version
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedBrowser, b.Brand)
+		}
+	}
+	if chromiumVersion == "" {
+		chromiumVersion = brandVersion
+	}
+	if browser == "" {
+		browser, brandVersion = BrowserChrome, chromiumVersion
+	}
+	if chromiumVersion == "" {
+		return nil, ErrUnsupportedBrowser
+	}
+
+	chromiumMajor, err := strconv.Atoi(strings.Split(chromiumVersion, ".")[0])
+	if err != nil {
+		return nil, fmt.Errorf("legitagent: could not parse chromium version %q: %w", chromiumVersion, err)
+	}
+	brandMajor, err := strconv.Atoi(strings.Split(brandVersion, ".")[0])
+	if err != nil {
+		return nil, fmt.Errorf("legitagent: could not parse brand version %q: %w", brandVersion, err)
+	}
+
+	osKey, ok := clientHintPlatforms[unquoteClientHint(h.Get("sec-ch-ua-platform"))]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedOS, h.Get("sec-ch-ua-platform"))
+	}
+	switch {
+	case osKey == osMacIntel && unquoteClientHint(h.Get("sec-ch-ua-arch")) == "arm":
+		osKey = osMacAppleSilicon
+	case osKey == OSWindows:
+		if major, err := strconv.Atoi(strings.Split(unquoteClientHint(h.Get("sec-ch-ua-platform-version")), ".")[0]); err == nil && major >= 13 {
+			osKey = OSWindows11
+		}
+	}
+
+	platform := PlatformDesktop
+	if h.Get("sec-ch-ua-mobile") == "?1" {
+		platform = PlatformMobile
+	}
+
+	pack := DefaultProfilePack()
+	profile := pack.browsers[browser]
+	versionKey := brandMajor
+	if browser == BrowserOpera {
+		versionKey = chromiumMajor
+	}
+	versionProf, _, err := findClosestVersionProfile(profile.Versions, versionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, _ := buildStaticHeaders(profile, pack.os[osKey], platformProfiles[platform], brandMajor, brandVersion, versionProf, RequestTypeNavigate)
+	for k := range headers {
+		if strings.HasPrefix(strings.ToLower(k), "sec-ch-") {
+			headers.Del(k)
+		}
+	}
+	for k, v := range h {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "sec-ch-") && len(v) > 0 {
+			headers.Set(k, v[0])
+		}
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, strings.ToLower(k))
+	}
+	PriorityHeaderSorter(keys)
+
+	return &Agent{
+		UserAgent:      reducedUserAgent(profile, reducedPlatformTokens[osKey], platform == PlatformMobile, chromiumMajor, brandMajor),
+		Headers:        headers,
+		HeaderOrder:    append(append([]string(nil), familyPseudoHeaderOrder[profile.Family]...), keys...),
+		ClientHelloID:  versionProf.TLS.HelloID,
+		H2Settings:     profile.H2Settings(),
+		H2WindowUpdate: profile.H2WindowUpdate,
+	}, nil
+}
+
+func reducedUserAgent(profile BrowserProfile, platformToken string, mobile bool, chromiumMajor, brandMajor int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 ", platformToken, chromiumMajor)
+	if mobile {
+		sb.WriteString("Mobile ")
+	}
+	sb.WriteString("Safari/537.36")
+
+	if suffix := profile.UASuffix; suffix != "" {
+		sb.WriteByte(' ')
+		fmt.Fprintf(&sb, suffix, strconv.Itoa(brandMajor)+".0.0.0")
+	}
+	return sb.String()
+}
+
+type ClientHints struct {
+	Values map[string]string
+
+	mu       sync.RWMutex
+	accepted map[string][]string
+}
+
+func NewClientHints(values map[string]string) *ClientHints {
+	return &ClientHints{Values: values}
+}
+
+func buildClientHints(browser BrowserProfile, os OSProfile, platform PlatformProfile, version int, fullVersion, chromiumVersion string, device *Device) map[string]string {
+	quote := func(v string) string {
+		return `"` + v + `"`
+	}
+
+	model := ""
+	if device != nil {
+		model = device.Model
+	}
+
+	hints := map[string]string{
+		"sec-ch-ua":                   buildSecChUa(browser.Brand, strconv.Itoa(version), strconv.Itoa(version), false),
+		"sec-ch-ua-mobile":            platform.MobileHint,
+		"sec-ch-ua-platform":          quote(os.Name),
+		"sec-ch-ua-arch":              quote(os.Arch),
+		"sec-ch-ua-bitness":           quote(os.BitnessHint),
+		"sec-ch-ua-full-version":      quote(fullVersion),
+		"sec-ch-ua-full-version-list": buildSecChUa(browser.Brand, fullVersion, chromiumVersion, true),
+		"sec-ch-ua-model":             quote(model),
+		"sec-ch-ua-platform-version":  quote(os.Version),
+		"sec-ch-ua-wow64":             "?0",
+	}
+
+	if version >= formFactorsMinVersion {
+		formFactor := "Desktop"
+		switch {
+		case platform.IsTablet:
+			formFactor = "Tablet"
+		case platform.MobileHint == "?1":
+			formFactor = "Mobile"
+		}
+		hints["sec-ch-ua-form-factors"] = quote(formFactor)
+	}
+
+	if device != nil {
+		for k, v := range device.clientHints() {
+			hints[k] = v
+		}
+	}
+
+	return hints
+}
+
+func (c *ClientHints) Accepted(origin string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.accepted[origin]...)
+}
+
+func (c *ClientHints) Header(origin string) http.Header {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	h := http.Header{}
+	for _, k := range lowEntropyClientHints {
+		if v, ok := c.Values[k]; ok {
+			h.Set(k, v)
+		}
+	}
+	for _, k := range c.accepted[origin] {
+		h.Set(k, c.Values[k])
+	}
+	return h
+}
+
+func (c *ClientHints) Record(origin string, h http.Header) []string {
+	if _, ok := h["Accept-Ch"]; !ok {
+		return nil
+	}
+
+	var accepted []string
+	for _, k := range parseClientHintList(h.Values("Accept-CH")) {
+		if _, ok := c.Values[k]; ok {
+			accepted = append(accepted, k)
+		}
+	}
+	sort.Strings(accepted)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous := c.accepted[origin]
+	if c.accepted == nil {
+		c.accepted = make(map[string][]string)
+	}
+	c.accepted[origin] = accepted
+
+	var retry []string
+	for _, k := range parseClientHintList(h.Values("Critical-CH")) {
+		if containsString(accepted, k) && !containsString(previous, k) && !containsString(lowEntropyClientHints, k) {
+			retry = append(retry, k)
+		}
+	}
+	return retry
+}
+
+func (c *ClientHints) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accepted = nil
+}
+
+func parseClientHintList(values []string) []string {
+	var hints []string
+	for _, v := range values {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.ToLower(strings.TrimSpace(k)); k != "" && !containsString(hints, k) {
+				hints = append(hints, k)
+			}
+		}
+	}
+	return hints
+}
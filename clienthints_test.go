@@ -0,0 +1,194 @@
+package legitagent
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestFromClientHints(t *testing.T) {
+	t.Run("Chrome Windows 11", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("sec-ch-ua", `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`)
+		h.Set("sec-ch-ua-full-version-list", `"Chromium";v="124.0.6367.91", "Google Chrome";v="124.0.6367.91", "Not-A.Brand";v="99.0.0.0"`)
+		h.Set("sec-ch-ua-mobile", "?0")
+		h.Set("sec-ch-ua-platform", `"Windows"`)
+		h.Set("sec-ch-ua-platform-version", `"15.0.0"`)
+
+		agent, err := FromClientHints(h)
+		if err != nil {
+			t.Fatalf("FromClientHints failed: %v", err)
+		}
+
+		want := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+		if agent.UserAgent != want {
+			t.Errorf("Expected reduced UA %q, got %q", want, agent.UserAgent)
+		}
+		if agent.Headers.Get("sec-ch-ua-full-version-list") != h.Get("sec-ch-ua-full-version-list") || agent.Headers.Get("sec-ch-ua-arch") != "" {
+			t.Errorf("Expected client hints to be copied as-is, got %v", agent.Headers)
+		}
+		if agent.ClientHelloID != utls.HelloChrome_120 || h2SettingsFamily(agent.H2Settings) != Chromium {
+			t.Errorf("Unexpected network profile: %v %v", agent.ClientHelloID, agent.H2Settings)
+		}
+		if issues := Validate(agent); HasErrors(issues) {
+			t.Errorf("Expected a consistent agent, got %v", issues)
+		}
+	})
+
+	t.Run("Edge Android", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("sec-ch-ua", `"Not)A;Brand";v="8", "Chromium";v="128", "Microsoft Edge";v="128"`)
+		h.Set("sec-ch-ua-mobile", "?1")
+		h.Set("sec-ch-ua-platform", `"Android"`)
+
+		agent, err := FromClientHints(h)
+		if err != nil {
+			t.Fatalf("FromClientHints failed: %v", err)
+		}
+
+		want := "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/128.0.0.0 Mobile Safari/537.36 Edg/128.0.0.0"
+		if agent.UserAgent != want {
+			t.Errorf("Expected reduced UA %q, got %q", want, agent.UserAgent)
+		}
+		if issues := Validate(agent); HasErrors(issues) {
+			t.Errorf("Expected a consistent agent, got %v", issues)
+		}
+	})
+
+	t.Run("Escaped GREASE Brand", func(t *testing.T) {
+		brands := parseBrandList(`"Not\"A\\Brand";v="24", "Chromium";v="116"`)
+		if len(brands) != 2 || brands[0].Brand != `Not"A\Brand` || !isGreaseBrand(brands[0].Brand) {
+			t.Errorf("Unexpected brand list: %+v", brands)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := FromClientHints(http.Header{}); !errors.Is(err, ErrMissingClientHints) {
+			t.Errorf("Expected ErrMissingClientHints, got %v", err)
+		}
+
+		h := http.Header{}
+		h.Set("sec-ch-ua", `"Chromium";v="124", "Google Chrome";v="124"`)
+		h.Set("sec-ch-ua-platform", `"Fuchsia"`)
+		if _, err := FromClientHints(h); !errors.Is(err, ErrUnsupportedOS) {
+			t.Errorf("Expected ErrUnsupportedOS, got %v", err)
+		}
+
+		h.Set("sec-ch-ua", `"Chromium";v="124", "Samsung Internet";v="25"`)
+		h.Set("sec-ch-ua-platform", `"Android"`)
+		if _, err := FromClientHints(h); !errors.Is(err, ErrUnsupportedBrowser) {
+			t.Errorf("Expected ErrUnsupportedBrowser, got %v", err)
+		}
+	})
+}
+
+func TestClientHintsStore(t *testing.T) {
+	g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSAndroid), WithPlatforms(PlatformMobile), WithVersionRange(133, 133))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	t.Run("Hint Set", func(t *testing.T) {
+		hints := agent.ClientHints
+		if hints == nil {
+			t.Fatal("Expected a client hints store for Chrome")
+		}
+		if hints.Values["sec-ch-ua-form-factors"] != `"Mobile"` || hints.Values["sec-ch-ua-wow64"] != "?0" {
+			t.Errorf("Unexpected hint values: %v", hints.Values)
+		}
+		if model := hints.Values["sec-ch-ua-model"]; model == `""` || !strings.Contains(agent.UserAgent, "Android 10; K") {
+			t.Errorf("Expected the device model only in the hint, got %s for %q", model, agent.UserAgent)
+		}
+		for _, k := range highEntropyClientHints {
+			if agent.Headers.Get(k) != "" {
+				t.Errorf("Expected %s not to be sent unsolicited", k)
+			}
+		}
+	})
+
+	t.Run("Accept-CH", func(t *testing.T) {
+		hints := NewClientHints(agent.ClientHints.Values)
+		h := http.Header{}
+		h.Set("Accept-CH", "Sec-CH-UA-Model, sec-ch-ua-arch, Sec-CH-Unknown")
+		h.Set("Critical-CH", "Sec-CH-UA-Model")
+
+		retry := hints.Record("https://example.com", h)
+		if !reflect.DeepEqual(retry, []string{"sec-ch-ua-model"}) {
+			t.Errorf("Expected a Critical-CH retry for the model, got %v", retry)
+		}
+		if got := hints.Accepted("https://example.com"); !reflect.DeepEqual(got, []string{"sec-ch-ua-arch", "sec-ch-ua-model"}) {
+			t.Errorf("Unexpected accepted hints %v", got)
+		}
+		if hints.Header("https://example.com").Get("sec-ch-ua-model") == "" || hints.Header("https://other.example").Get("sec-ch-ua-model") != "" {
+			t.Error("Expected accepted hints to be scoped to their origin")
+		}
+		if retry := hints.Record("https://example.com", h); len(retry) != 0 {
+			t.Errorf("Expected no retry once the hint was sent, got %v", retry)
+		}
+
+		h.Set("Accept-CH", "")
+		hints.Record("https://example.com", h)
+		if got := hints.Accepted("https://example.com"); len(got) != 0 {
+			t.Errorf("Expected an empty Accept-CH to clear the origin, got %v", got)
+		}
+	})
+
+	t.Run("Transport Retry", func(t *testing.T) {
+		var requests, withModel int
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Header.Get("sec-ch-ua-model") != "" {
+				withModel++
+			}
+			w.Header().Set("Accept-CH", "Sec-CH-UA-Model, Sec-CH-UA-Platform-Version")
+			w.Header().Set("Critical-CH", "Sec-CH-UA-Model")
+		}))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		defer srv.Close()
+
+		transport := &Transport{Agent: agent, InsecureSkipVerify: true}
+		defer transport.CloseIdleConnections()
+		client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+		}
+
+		if requests != 3 || withModel != 2 {
+			t.Errorf("Expected one Critical-CH retry and hints on later requests, got %d requests, %d with the model", requests, withModel)
+		}
+	})
+}
+
+func TestFullVersionListChromiumBuild(t *testing.T) {
+	g := NewGenerator(WithBrowsers(BrowserEdge), WithVersionRange(128, 128), WithOS(OSWindows11), WithPlatforms(PlatformDesktop), WithFullFingerprint(true))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	list := agent.ClientHints.Values["sec-ch-ua-full-version-list"]
+	if !strings.Contains(list, `"Chromium";v="128.0.6636.`) {
+		t.Errorf("Expected the Chromium 128 build for Chromium, got %s", list)
+	}
+	if !strings.Contains(list, `"Microsoft Edge";v="128.0.2739.`) {
+		t.Errorf("Expected the Edge build for Microsoft Edge, got %s", list)
+	}
+	if full := agent.ClientHints.Values["sec-ch-ua-full-version"]; !strings.HasPrefix(full, `"128.0.2739.`) {
+		t.Errorf("Expected the Edge build in sec-ch-ua-full-version, got %s", full)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SyNdicateFoundation/legitagent"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	echoURL := flag.String("echo", "", "URL of a running echo server (a local one is started when empty)")
+	asJSON := flag.Bool("json", false, "print every report as JSON")
+	timeout := flag.Duration("timeout", 5*time.Minute, "overall verification timeout")
+	flag.Parse()
+
+	if *echoURL == "" {
+		s, err := legitagent.NewEchoServer()
+		if err != nil {
+			log.Printf("Failed to start echo server: %v", err)
+			return 1
+		}
+		defer s.Close()
+		*echoURL = s.URL
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	reports, err := legitagent.VerifyCombinations(ctx, *echoURL)
+	if err != nil {
+		log.Printf("Verification failed: %v", err)
+		return 1
+	}
+
+	failed := 0
+	for _, r := range reports {
+		if *asJSON {
+			_ = json.NewEncoder(os.Stdout).Encode(r)
+		}
+		if r.OK() {
+			continue
+		}
+		failed++
+		if !*asJSON {
+			fmt.Printf("%s %d on %s/%s (%s)\n", r.Browser, r.Version, r.OS, r.Platform, r.Expected.HTTPVersion)
+			for _, d := range r.Drifts {
+				fmt.Printf("  %s\n", d)
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d combinations verified, %d drifted\n", len(reports), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/SyNdicateFoundation/legitagent"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8443", "address to listen on")
+	certFile := flag.String("cert", "", "TLS certificate file (a self-signed certificate is generated when empty)")
+	keyFile := flag.String("key", "", "TLS private key file")
+	flag.Parse()
+
+	var config *tls.Config
+	if *certFile != "" || *keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load certificate: %v", err)
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *addr, err)
+	}
+
+	s, err := legitagent.ServeEchoListener(l, config)
+	if err != nil {
+		log.Fatalf("Failed to start echo server: %v", err)
+	}
+	log.Printf("Echo server listening on %s", s.URL)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	if err := s.Close(); err != nil {
+		log.Printf("Failed to close echo server: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SyNdicateFoundation/legitagent"
+)
+
+func main() {
+	out := flag.String("o", "data/fingerprints.json", "output file (- for stdout)")
+	revision := flag.String("revision", time.Now().UTC().Format("2006-01-02"), "revision recorded in the database")
+	keyLog := flag.String("keylog", os.Getenv("SSLKEYLOGFILE"), "TLS key log used to decrypt captures")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [capture.jsonl|capture.pcap ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	db, err := legitagent.BuildFingerprintDatabase()
+	if err != nil {
+		log.Fatalf("Failed to build fingerprint database: %v", err)
+	}
+	db.Revision = *revision
+
+	for _, name := range flag.Args() {
+		records, err := legitagent.ReadCaptureFileWithKeyLog(name, *keyLog)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", name, err)
+		}
+		imported := 0
+		for _, rec := range records {
+			if err := db.ImportCapture(rec); err == nil {
+				imported++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: imported %d of %d records\n", name, imported, len(records))
+	}
+
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode fingerprint database: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "-" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d entries to %s\n", len(db.Entries), *out)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/SyNdicateFoundation/legitagent"
+)
+
+func main() {
+	out := flag.String("o", "-", "output file for the profile pack (- for stdout)")
+	prev := flag.String("prev", "", "previous legitpack output to diff against (defaults to the closest older built-in version)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] capture.json|capture.har|capture.pcap ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var captures []legitagent.ProfileCapture
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", name, err)
+		}
+		c, err := legitagent.ReadProfileCaptures(f)
+		_ = f.Close()
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", name, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: read %d captures\n", name, len(c))
+		captures = append(captures, c...)
+	}
+
+	entry, err := legitagent.BuildProfilePackEntry(captures...)
+	if err != nil {
+		log.Fatalf("Failed to build profile-pack entry: %v", err)
+	}
+	if entry.TLS != nil && entry.HelloID == "" {
+		fmt.Fprintln(os.Stderr, "warning: the captured ClientHello matches no known utls ClientHelloID")
+	}
+
+	var previous *legitagent.ProfilePackEntry
+	if *prev != "" {
+		f, err := os.Open(*prev)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *prev, err)
+		}
+		pack, err := legitagent.ReadProfilePackEntries(f)
+		_ = f.Close()
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *prev, err)
+		}
+		previous = pack.Entries[len(pack.Entries)-1]
+	} else if previous, err = legitagent.PreviousProfilePackEntry(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "no previous entry to diff against: %v\n", err)
+	}
+	if previous != nil {
+		fmt.Fprintf(os.Stderr, "diff against %s %d:\n%s", previous.Browser, previous.Version, legitagent.DiffProfilePackEntries(previous, entry))
+	}
+
+	data, err := json.MarshalIndent(legitagent.NewProfilePackEntries(entry), "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode profile pack: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "-" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s %d entry to %s\n", entry.Browser, entry.Version, *out)
+}
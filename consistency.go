@@ -0,0 +1,349 @@
+package legitagent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const goTLSFamily BrowserFamily = "Go"
+
+const (
+	RuleALPN = "tls-alpn"
+
+	verdictErrorPenalty   = 35
+	verdictWarningPenalty = 10
+)
+
+type consistencyContextKey int
+
+const (
+	captureContextKey consistencyContextKey = iota
+	verdictContextKey
+	tlsConnContextKey
+)
+
+type Verdict struct {
+	Score         int           `json:"score"`
+	ClaimedFamily BrowserFamily `json:"claimed_family,omitempty"`
+	TLSFamily     BrowserFamily `json:"tls_family,omitempty"`
+	H2Family      BrowserFamily `json:"h2_family,omitempty"`
+	Issues        []Issue       `json:"issues,omitempty"`
+	Fingerprint   *Fingerprint  `json:"fingerprint"`
+}
+
+func (v *Verdict) Consistent() bool {
+	return !HasErrors(v.Issues)
+}
+
+type consistencyConn struct {
+	*helloRecordingConn
+	mu sync.Mutex
+	h2 *h2Recorder
+	h1 *h1Recorder
+}
+
+type consistencyAccept struct {
+	conn net.Conn
+	err  error
+}
+
+type consistencyListener struct {
+	net.Listener
+	config    *tls.Config
+	accepted  chan consistencyAccept
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewConsistencyListener(l net.Listener, config *tls.Config) (net.Listener, error) {
+	if config == nil {
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}}
+	} else {
+		config = config.Clone()
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	cl := &consistencyListener{
+		Listener: l,
+		config:   config,
+		accepted: make(chan consistencyAccept),
+		done:     make(chan struct{}),
+	}
+	go cl.serve()
+	return cl, nil
+}
+
+func (l *consistencyListener) serve() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.accepted <- consistencyAccept{err: err}:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.handshake(c)
+	}
+}
+
+func (l *consistencyListener) handshake(c net.Conn) {
+	cc := &consistencyConn{helloRecordingConn: &helloRecordingConn{Conn: c}}
+	tc := tls.Server(cc, l.config)
+
+	_ = c.SetDeadline(time.Now().Add(echoHandshakeTimeout))
+	if err := tc.Handshake(); err != nil {
+		_ = c.Close()
+		return
+	}
+	_ = c.SetDeadline(time.Time{})
+
+	var conn net.Conn = tc
+	if tc.ConnectionState().NegotiatedProtocol != "h2" {
+		cc.h1 = new(h1Recorder)
+		conn = &h1TeeConn{Conn: tc, capture: cc}
+	}
+
+	select {
+	case l.accepted <- consistencyAccept{conn: conn}:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+func (l *consistencyListener) Accept() (net.Conn, error) {
+	select {
+	case a := <-l.accepted:
+		return a.conn, a.err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *consistencyListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+type h2TeeConn struct {
+	*tls.Conn
+	capture *consistencyConn
+}
+
+func (c *h2TeeConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.capture.mu.Lock()
+		c.capture.h2.feed(p[:n])
+		c.capture.mu.Unlock()
+	}
+	return n, err
+}
+
+type h1TeeConn struct {
+	*tls.Conn
+	capture *consistencyConn
+}
+
+func (c *h1TeeConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.capture.mu.Lock()
+		c.capture.h1.feed(p[:n])
+		c.capture.mu.Unlock()
+	}
+	return n, err
+}
+
+func consistencyConnOf(c net.Conn) *consistencyConn {
+	switch tc := c.(type) {
+	case *tls.Conn:
+		c = tc.NetConn()
+	case *h1TeeConn:
+		c = tc.NetConn()
+	}
+	cc, _ := c.(*consistencyConn)
+	return cc
+}
+
+func ConfigureConsistencyServer(srv *http.Server) error {
+	h2srv := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2srv); err != nil {
+		return fmt.Errorf("legitagent: could not configure http/2: %w", err)
+	}
+
+	connContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		if cc := consistencyConnOf(c); cc != nil {
+			ctx = context.WithValue(ctx, captureContextKey, cc)
+		}
+		if tc, ok := c.(*h1TeeConn); ok {
+			ctx = context.WithValue(ctx, tlsConnContextKey, tc.Conn)
+		}
+		return ctx
+	}
+
+	handler := srv.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tc, ok := r.Context().Value(tlsConnContextKey).(*tls.Conn); ok && r.TLS == nil {
+			state := tc.ConnectionState()
+			r2 := *r
+			r2.TLS = &state
+			r = &r2
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	srv.TLSNextProto["h2"] = func(hs *http.Server, c *tls.Conn, h http.Handler) {
+		var conn net.Conn = c
+		if cc := consistencyConnOf(c); cc != nil {
+			cc.mu.Lock()
+			cc.h2 = newH2Recorder()
+			cc.mu.Unlock()
+			conn = &h2TeeConn{Conn: c, capture: cc}
+		}
+
+		ctx := context.Background()
+		if bc, ok := h.(interface{ BaseContext() context.Context }); ok {
+			ctx = bc.BaseContext()
+		}
+		h2srv.ServeConn(conn, &http2.ServeConnOpts{Context: ctx, BaseConfig: hs, Handler: h})
+	}
+
+	return nil
+}
+
+func ConsistencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := ScoreRequest(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), verdictContextKey, v)))
+	})
+}
+
+func VerdictFromContext(ctx context.Context) (*Verdict, bool) {
+	v, ok := ctx.Value(verdictContextKey).(*Verdict)
+	return v, ok
+}
+
+func ScoreRequest(r *http.Request) *Verdict {
+	fp := &Fingerprint{UserAgent: r.UserAgent(), HTTPVersion: "http/1.1"}
+	agent := &Agent{UserAgent: r.UserAgent(), Headers: r.Header.Clone()}
+	v := &Verdict{Fingerprint: fp}
+
+	if parsed, err := parseUserAgentString(r.UserAgent()); err == nil {
+		v.ClaimedFamily = parsed.Engine
+	}
+
+	cc, _ := r.Context().Value(captureContextKey).(*consistencyConn)
+	if cc != nil {
+		if hello, err := ParseClientHello(cc.ClientHello()); err == nil {
+			fp.TLS = hello
+			v.TLSFamily = classifyClientHello(hello)
+		}
+
+		cc.mu.Lock()
+		if r.ProtoMajor == 2 && cc.h2 != nil {
+			fp.HTTPVersion = "h2"
+			fp.H2 = cc.h2.fingerprint()
+			if block := cc.h2.findBlock(r.Method, r.URL.RequestURI()); block != nil {
+				pseudo, regular := splitHeaderFields(block.Fields)
+				fp.HeaderOrder = regular
+				agent.HeaderOrder = append(pseudo, regular...)
+			}
+		}
+		if r.ProtoMajor == 1 && cc.h1 != nil {
+			if req := cc.h1.findRequest(r.Method, r.RequestURI); req != nil {
+				fp.HeaderOrder = req.HeaderOrder
+				for _, h := range req.HeaderOrder {
+					if _, ok := r.Header[http.CanonicalHeaderKey(h)]; ok {
+						agent.HeaderOrder = append(agent.HeaderOrder, h)
+					}
+				}
+			}
+		}
+		cc.mu.Unlock()
+	}
+
+	if fp.H2 != nil {
+		agent.H2Settings = make(map[http2.SettingID]uint32, len(fp.H2.Settings))
+		for _, s := range fp.H2.Settings {
+			agent.H2Settings[s.ID] = s.Val
+		}
+		agent.H2WindowUpdate = fp.H2.WindowUpdate
+		v.H2Family = h2SettingsFamily(agent.H2Settings)
+	}
+
+	v.Issues = validateLayers(agent, v.TLSFamily, true)
+	if v.ClaimedFamily != "" && fp.TLS != nil && !containsString(fp.TLS.ALPN, "h2") {
+		v.Issues = append(v.Issues, Issue{Rule: RuleALPN, Severity: SeverityWarning, Message: fmt.Sprintf("user agent is %s but the ClientHello does not offer h2", v.ClaimedFamily)})
+	}
+
+	v.Score = 100
+	for _, issue := range v.Issues {
+		switch issue.Severity {
+		case SeverityError:
+			v.Score -= verdictErrorPenalty
+		case SeverityWarning:
+			v.Score -= verdictWarningPenalty
+		}
+	}
+	v.Score = max(v.Score, 0)
+
+	return v
+}
+
+func (r *h2Recorder) findBlock(method, path string) *h2HeaderBlock {
+	for i := len(r.blocks) - 1; i >= 0; i-- {
+		b := &r.blocks[i]
+		if headerFieldValue(b.Fields, ":method") == method && headerFieldValue(b.Fields, ":path") == path {
+			return b
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyClientHello(f *TLSFingerprint) BrowserFamily {
+	return DefaultFingerprintDatabase().tlsFamily(f.JA4)
+}
+
+func ja4CipherSection(ja4 string) string {
+	parts := strings.Split(ja4, "_")
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
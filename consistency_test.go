@@ -0,0 +1,205 @@
+package legitagent
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startConsistencyServer(t *testing.T) string {
+	t.Helper()
+
+	return startCaptureServer(t, ConsistencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, ok := VerdictFromContext(r.Context())
+		if !ok {
+			http.Error(w, "no verdict", http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(v)
+	})))
+}
+
+func startCaptureServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatalf("selfSignedCertificate failed: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	cl, err := NewConsistencyListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("NewConsistencyListener failed: %v", err)
+	}
+
+	srv := &http.Server{Handler: h}
+	if err := ConfigureConsistencyServer(srv); err != nil {
+		t.Fatalf("ConfigureConsistencyServer failed: %v", err)
+	}
+
+	go func() { _ = srv.Serve(cl) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return "https://" + l.Addr().String() + "/"
+}
+
+func fetchVerdict(t *testing.T, client *http.Client, url, userAgent string) *Verdict {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	v := new(Verdict)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("Failed to decode verdict: %v", err)
+	}
+	return v
+}
+
+func TestConsistencyMiddleware(t *testing.T) {
+	url := startConsistencyServer(t)
+
+	for _, browser := range []Browser{BrowserChrome, BrowserFirefox, BrowserSafari} {
+		t.Run("Consistent "+string(browser), func(t *testing.T) {
+			g := NewGenerator(WithBrowsers(browser), WithPlatforms(PlatformDesktop), WithOS(OSMac), WithValidation(ValidationRegenerate))
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			defer g.ReleaseAgent(agent)
+
+			client := &http.Client{Transport: &Transport{Agent: agent, InsecureSkipVerify: true}, Timeout: 10 * time.Second}
+			v := fetchVerdict(t, client, url, "")
+
+			family := DefaultProfilePack().browsers[browser].Family
+			if v.Score != 100 || v.TLSFamily != family || v.H2Family != family || v.Fingerprint.HTTPVersion != "h2" {
+				t.Errorf("Expected a clean %s verdict, got score=%d tls=%s h2=%s issues=%v", family, v.Score, v.TLSFamily, v.H2Family, v.Issues)
+			}
+		})
+	}
+
+	t.Run("Go Client Claiming Chrome", func(t *testing.T) {
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, ForceAttemptHTTP2: true},
+			Timeout:   10 * time.Second,
+		}
+		v := fetchVerdict(t, client, url, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36")
+
+		if v.TLSFamily != goTLSFamily || !hasRule(v.Issues, RuleTLSFamily) || !hasRule(v.Issues, RuleH2Family) || v.Consistent() {
+			t.Errorf("Expected Go TLS and H2 mismatches, got tls=%s issues=%v", v.TLSFamily, v.Issues)
+		}
+		if v.Score >= 50 {
+			t.Errorf("Expected a low score, got %d", v.Score)
+		}
+	})
+
+	t.Run("Firefox UA With Client Hints", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSWindows), WithPlatforms(PlatformDesktop))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		client := &http.Client{Transport: &Transport{Agent: agent, InsecureSkipVerify: true}, Timeout: 10 * time.Second}
+		v := fetchVerdict(t, client, url, "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0")
+
+		if v.ClaimedFamily != Gecko || !hasRule(v.Issues, RuleClientHintsUnexpected) || !hasRule(v.Issues, RuleTLSFamily) {
+			t.Errorf("Expected client hint and TLS issues, got %v", v.Issues)
+		}
+	})
+
+	t.Run("HTTP/1.1", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserFirefox), WithOS(OSLinux), WithPlatforms(PlatformDesktop), WithH2Only(false))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+		agent.H2Settings = nil
+
+		client := &http.Client{Transport: &Transport{Agent: agent, InsecureSkipVerify: true}, Timeout: 10 * time.Second}
+		v := fetchVerdict(t, client, url, "")
+
+		if v.Fingerprint.HTTPVersion != "http/1.1" || v.TLSFamily != Gecko || !hasRule(v.Issues, RuleALPN) {
+			t.Errorf("Unexpected HTTP/1.1 verdict: version=%s tls=%s issues=%v", v.Fingerprint.HTTPVersion, v.TLSFamily, v.Issues)
+		}
+
+		var want []string
+		for _, h := range agent.wireHeaderOrder() {
+			if containsString(v.Fingerprint.HeaderOrder, h) {
+				want = append(want, h)
+			}
+		}
+		var got []string
+		for _, h := range v.Fingerprint.HeaderOrder {
+			if containsString(want, h) {
+				got = append(got, h)
+			}
+		}
+		if len(want) < 3 || !containsString(want, "user-agent") || strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected the raw HTTP/1.1 header order %v, got %v", want, v.Fingerprint.HeaderOrder)
+		}
+	})
+}
+
+func TestConsistencyListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	cl, err := NewConsistencyListener(l, nil)
+	if err != nil {
+		t.Fatalf("NewConsistencyListener with a nil config failed: %v", err)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, "no tls state", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(r.TLS.NegotiatedProtocol))
+	})}
+	if err := ConfigureConsistencyServer(srv); err != nil {
+		t.Fatalf("ConfigureConsistencyServer failed: %v", err)
+	}
+	go func() { _ = srv.Serve(cl) }()
+	defer srv.Close()
+
+	for _, proto := range []string{"h2", "http/1.1"} {
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{proto}}, ForceAttemptHTTP2: proto == "h2"},
+			Timeout:   10 * time.Second,
+		}
+		resp, err := client.Get("https://" + l.Addr().String() + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		client.CloseIdleConnections()
+
+		if resp.StatusCode != http.StatusOK || string(body) != proto {
+			t.Errorf("Expected TLS state with %s, got %s %q", proto, resp.Status, body)
+		}
+	}
+}
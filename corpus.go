@@ -0,0 +1,208 @@
+package legitagent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+type Defect string
+
+const (
+	DefectNone                  Defect = "none"
+	DefectTLSFamily             Defect = "wrong-tls-family"
+	DefectMissingSecFetch       Defect = "missing-sec-fetch"
+	DefectShuffledPseudoHeaders Defect = "shuffled-pseudo-headers"
+	DefectGoH2Settings          Defect = "go-h2-settings"
+)
+
+const (
+	LabelConsistent   = "consistent"
+	LabelInconsistent = "inconsistent"
+
+	corpusServerName = "example.com"
+)
+
+var AllDefects = []Defect{
+	DefectTLSFamily,
+	DefectMissingSecFetch,
+	DefectShuffledPseudoHeaders,
+	DefectGoH2Settings,
+}
+
+var (
+	ErrUnknownDefect      = errors.New("legitagent: unknown corpus defect")
+	ErrDefectInapplicable = errors.New("legitagent: defect cannot be injected into this agent")
+)
+
+type CorpusSample struct {
+	ID     int
+	Label  string
+	Defect Defect
+	Detail string
+	Agent  *Agent
+}
+
+type corpusRecord struct {
+	ID          int          `json:"id"`
+	Label       string       `json:"label"`
+	Defect      Defect       `json:"defect"`
+	Detail      string       `json:"detail,omitempty"`
+	UserAgent   string       `json:"user_agent"`
+	Headers     [][2]string  `json:"headers"`
+	Fingerprint *Fingerprint `json:"fingerprint"`
+}
+
+func (g *Generator) GenerateCorpus(perClass int, defects ...Defect) ([]CorpusSample, error) {
+	if len(defects) == 0 {
+		defects = AllDefects
+	}
+	classes := append([]Defect{DefectNone}, defects...)
+
+	samples := make([]CorpusSample, 0, perClass*len(classes))
+	for _, defect := range classes {
+		for i := 0; i < perClass; i++ {
+			agent, detail, err := g.corpusAgent(defect)
+			if err != nil {
+				return nil, err
+			}
+
+			label := LabelInconsistent
+			if defect == DefectNone {
+				label = LabelConsistent
+			}
+			samples = append(samples, CorpusSample{ID: len(samples), Label: label, Defect: defect, Detail: detail, Agent: agent})
+		}
+	}
+
+	return samples, nil
+}
+
+func (g *Generator) corpusAgent(defect Defect) (*Agent, string, error) {
+	var lastErr error
+	for i := 0; i < maxValidationAttempts; i++ {
+		agent, err := g.generate()
+		if err != nil {
+			return nil, "", err
+		}
+
+		if issues := Validate(agent); HasErrors(issues) {
+			lastErr = &ValidationError{Issues: issues}
+			g.ReleaseAgent(agent)
+			continue
+		}
+
+		detail, err := InjectDefect(agent, defect)
+		if err == nil {
+			return agent, detail, nil
+		}
+		g.ReleaseAgent(agent)
+		if !errors.Is(err, ErrDefectInapplicable) {
+			return nil, "", err
+		}
+		lastErr = err
+	}
+
+	return nil, "", fmt.Errorf("legitagent: could not generate a %s corpus agent: %w", defect, lastErr)
+}
+
+func InjectDefect(agent *Agent, defect Defect) (string, error) {
+	switch defect {
+	case DefectNone:
+		return "", nil
+
+	case DefectTLSFamily:
+		from := clientHelloFamily(agent)
+		id := utls.HelloFirefox_120
+		if from == Gecko {
+			id = utls.HelloChrome_120
+		}
+		agent.ClientHelloID = id
+		agent.ClientHelloSpec = nil
+		return fmt.Sprintf("ClientHello %s replaced with %s", from, id.Str()), nil
+
+	case DefectMissingSecFetch:
+		var removed []string
+		for k := range agent.Headers {
+			if k := strings.ToLower(k); strings.HasPrefix(k, "sec-fetch-") {
+				removed = append(removed, k)
+				agent.Headers.Del(k)
+			}
+		}
+		if len(removed) == 0 {
+			return "", fmt.Errorf("%w: %s: no sec-fetch headers", ErrDefectInapplicable, defect)
+		}
+		agent.HeaderOrder = removeHeaders(agent.HeaderOrder, removed)
+		PriorityHeaderSorter(removed)
+		return "removed " + strings.Join(removed, ", "), nil
+
+	case DefectShuffledPseudoHeaders:
+		if agent.H2Settings == nil {
+			return "", fmt.Errorf("%w: %s: agent does not use http/2", ErrDefectInapplicable, defect)
+		}
+		original := agent.pseudoHeaderOrder()
+		shuffled := append([]string(nil), original...)
+		for strings.Join(shuffled, ",") == strings.Join(original, ",") {
+			rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		}
+		agent.HeaderOrder = append(shuffled, removeHeaders(agent.HeaderOrder, original)...)
+		return fmt.Sprintf("pseudo-header order %s replaced with %s", strings.Join(original, ","), strings.Join(shuffled, ",")), nil
+
+	case DefectGoH2Settings:
+		if agent.H2Settings == nil {
+			return "", fmt.Errorf("%w: %s: agent does not use http/2", ErrDefectInapplicable, defect)
+		}
+		agent.H2Settings = GetGoH2Settings()
+		agent.H2WindowUpdate = goH2WindowUpdate
+		return "HTTP/2 SETTINGS and WINDOW_UPDATE replaced with Go net/http defaults", nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownDefect, defect)
+}
+
+func removeHeaders(order, remove []string) []string {
+	kept := make([]string, 0, len(order))
+	for _, h := range order {
+		if !containsString(remove, h) {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+func WriteCorpusJSONL(w io.Writer, samples []CorpusSample) error {
+	enc := json.NewEncoder(w)
+	for _, s := range samples {
+		fp, err := s.Agent.Fingerprint(corpusServerName)
+		if err != nil {
+			return fmt.Errorf("legitagent: corpus sample %d: %w", s.ID, err)
+		}
+
+		rec := corpusRecord{
+			ID:          s.ID,
+			Label:       s.Label,
+			Defect:      s.Defect,
+			Detail:      s.Detail,
+			UserAgent:   s.Agent.UserAgent,
+			Headers:     make([][2]string, 0, len(fp.HeaderOrder)),
+			Fingerprint: fp,
+		}
+		for _, h := range fp.HeaderOrder {
+			v := s.Agent.Headers.Get(h)
+			if h == "user-agent" {
+				v = s.Agent.UserAgent
+			}
+			rec.Headers = append(rec.Headers, [2]string{h, v})
+		}
+
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package legitagent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCorpus(t *testing.T) {
+	g := NewGenerator()
+	samples, err := g.GenerateCorpus(5)
+	if err != nil {
+		t.Fatalf("GenerateCorpus failed: %v", err)
+	}
+	if len(samples) != 5*(len(AllDefects)+1) {
+		t.Fatalf("Expected %d samples, got %d", 5*(len(AllDefects)+1), len(samples))
+	}
+
+	for _, s := range samples {
+		issues := Validate(s.Agent)
+		switch s.Defect {
+		case DefectNone:
+			if s.Label != LabelConsistent || HasErrors(issues) {
+				t.Errorf("Consistent sample %q has label %s and issues %v", s.Agent.UserAgent, s.Label, issues)
+			}
+			continue
+		case DefectTLSFamily:
+			if !hasRule(issues, RuleTLSFamily) {
+				t.Errorf("Expected %s issue, got %v", RuleTLSFamily, issues)
+			}
+		case DefectMissingSecFetch:
+			for k := range s.Agent.Headers {
+				if strings.HasPrefix(strings.ToLower(k), "sec-fetch-") {
+					t.Errorf("Expected no sec-fetch headers, got %s", k)
+				}
+			}
+			if hasRule(issues, RuleHeaderOrder) {
+				t.Errorf("Expected HeaderOrder to be updated, got %v", issues)
+			}
+		case DefectShuffledPseudoHeaders:
+			if !hasRule(issues, RulePseudoHeaderOrder) {
+				t.Errorf("Expected %s issue, got %v", RulePseudoHeaderOrder, issues)
+			}
+		case DefectGoH2Settings:
+			if h2SettingsFamily(s.Agent.H2Settings) != "" || !hasRule(issues, RuleH2WindowUpdate) {
+				t.Errorf("Expected Go HTTP/2 settings, got %v with issues %v", s.Agent.H2Settings, issues)
+			}
+		}
+		if s.Label != LabelInconsistent || s.Detail == "" {
+			t.Errorf("Defect %s sample has label %s and detail %q", s.Defect, s.Label, s.Detail)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCorpusJSONL(&buf, samples); err != nil {
+		t.Fatalf("WriteCorpusJSONL failed: %v", err)
+	}
+
+	lines := 0
+	sc := bufio.NewScanner(&buf)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var rec corpusRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid JSONL line %d: %v", lines, err)
+		}
+		if rec.ID != lines || rec.Defect != samples[lines].Defect || rec.Fingerprint == nil || rec.Fingerprint.TLS.JA4 == "" {
+			t.Errorf("Unexpected record %d: %+v", lines, rec)
+		}
+		lines++
+	}
+	if lines != len(samples) {
+		t.Errorf("Expected %d JSONL lines, got %d", len(samples), lines)
+	}
+
+	if _, err := g.GenerateCorpus(1, Defect("bogus")); !errors.Is(err, ErrUnknownDefect) {
+		t.Errorf("Expected ErrUnknownDefect, got %v", err)
+	}
+	if _, err := NewGenerator(WithH2Only(false), WithBrowsers(BrowserSafari)).GenerateCorpus(1, DefectGoH2Settings); err == nil {
+		t.Error("Expected an error when no agent can carry the defect")
+	}
+}
@@ -0,0 +1,152 @@
+package legitagent
+
+import (
+	"math/rand/v2"
+	"strconv"
+)
+
+type Device struct {
+	Name            string            `json:"name"`
+	Manufacturer    string            `json:"manufacturer,omitempty"`
+	Model           string            `json:"model,omitempty"`
+	Platform        Platform          `json:"platform"`
+	OS              []OperatingSystem `json:"os,omitempty"`
+	AndroidVersions []int             `json:"android_versions,omitempty"`
+	Builds          map[int]string    `json:"builds,omitempty"`
+	AndroidVersion  int               `json:"android_version,omitempty"`
+	BuildID         string            `json:"build_id,omitempty"`
+	DPR             float64           `json:"dpr"`
+	ScreenWidth     int               `json:"screen_width"`
+	ScreenHeight    int               `json:"screen_height"`
+	DeviceMemory    float64           `json:"device_memory"`
+	ViewportWidth   int               `json:"viewport_width,omitempty"`
+	ViewportHeight  int               `json:"viewport_height,omitempty"`
+	ColorScheme     string            `json:"color_scheme,omitempty"`
+	ReducedMotion   string            `json:"reduced_motion,omitempty"`
+}
+
+func (p *ProfilePack) Devices(platform Platform, os OperatingSystem) []Device {
+	var devices []Device
+	for _, name := range p.deviceList {
+		d := p.devices[name]
+		if d.Platform == platform && (len(d.OS) == 0 || containsOS(d.OS, os)) {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+func (p *ProfilePack) pickDevice(platform Platform, os OperatingSystem, model string) *Device {
+	candidates := p.Devices(platform, os)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	for _, d := range candidates {
+		if model != "" && d.Model == model {
+			return newDevicePersona(d)
+		}
+	}
+
+	d := randomChoice(candidates)
+	if model != "" {
+		d.Model = model
+	}
+	return newDevicePersona(d)
+}
+
+func (p *ProfilePack) androidDevices(platform Platform, version int) []Device {
+	os := OSAndroid
+	if platform == PlatformTablet {
+		os = osAndroidTablet
+	}
+
+	var devices []Device
+	for _, d := range p.Devices(platform, os) {
+		if d.Model != "" && d.supportsAndroid(version) {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+func newDevicePersona(d Device) *Device {
+	if len(d.AndroidVersions) > 0 {
+		d.setAndroidVersion(randomChoice(d.AndroidVersions))
+	}
+
+	if d.Platform == PlatformDesktop {
+		d.ViewportWidth = d.ScreenWidth
+		if rand.IntN(3) == 0 {
+			d.ViewportWidth = d.ScreenWidth * (70 + rand.IntN(26)) / 100
+		}
+		d.ViewportHeight = d.ScreenHeight - 120 - rand.IntN(40)
+	} else {
+		d.ViewportWidth = d.ScreenWidth
+		d.ViewportHeight = d.ScreenHeight - 56 - rand.IntN(32)
+	}
+
+	d.ColorScheme = "light"
+	if rand.IntN(10) < 3 {
+		d.ColorScheme = "dark"
+	}
+	d.ReducedMotion = "no-preference"
+	if rand.IntN(20) == 0 {
+		d.ReducedMotion = "reduce"
+	}
+	return &d
+}
+
+func (d *Device) supportsAndroid(version int) bool {
+	for _, v := range d.AndroidVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Device) setAndroidVersion(version int) {
+	d.AndroidVersion = version
+	d.BuildID = d.Builds[version]
+}
+
+func (d *Device) platformVersion() string {
+	return strconv.Itoa(d.AndroidVersion) + ".0.0"
+}
+
+func (d *Device) clientHints() map[string]string {
+	dpr := strconv.FormatFloat(d.DPR, 'f', -1, 64)
+	memory := strconv.FormatFloat(approximateDeviceMemory(d.DeviceMemory), 'f', -1, 64)
+	width := strconv.Itoa(d.ViewportWidth)
+
+	return map[string]string{
+		"sec-ch-dpr":                    dpr,
+		"sec-ch-viewport-width":         width,
+		"sec-ch-viewport-height":        strconv.Itoa(d.ViewportHeight),
+		"sec-ch-device-memory":          memory,
+		"sec-ch-prefers-color-scheme":   `"` + d.ColorScheme + `"`,
+		"sec-ch-prefers-reduced-motion": `"` + d.ReducedMotion + `"`,
+		"dpr":                           dpr,
+		"viewport-width":                width,
+		"device-memory":                 memory,
+	}
+}
+
+func approximateDeviceMemory(gb float64) float64 {
+	if gb <= 0.25 {
+		return 0.25
+	}
+
+	lower := 0.25
+	for lower*2 <= gb {
+		lower *= 2
+	}
+	if upper := lower * 2; upper-gb < gb-lower {
+		lower = upper
+	}
+	if lower > 8 {
+		return 8
+	}
+	return lower
+}
@@ -0,0 +1,122 @@
+package legitagent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDevicePersona(t *testing.T) {
+	t.Run("Android Generate", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSAndroid), WithPlatforms(PlatformMobile), WithUserAgentReduction(false))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		d := agent.Device
+		if d == nil || d.Model == "" || d.Platform != PlatformMobile {
+			t.Fatalf("Expected an Android device persona, got %+v", d)
+		}
+		if !strings.Contains(agent.UserAgent, "; "+d.Model+")") {
+			t.Errorf("Expected the UA to name %s, got %q", d.Model, agent.UserAgent)
+		}
+		if got := agent.ClientHints.Values["sec-ch-ua-model"]; got != `"`+d.Model+`"` {
+			t.Errorf("Expected sec-ch-ua-model %q, got %s", d.Model, got)
+		}
+		if d.ViewportWidth != d.ScreenWidth || d.ViewportHeight >= d.ScreenHeight {
+			t.Errorf("Unexpected mobile viewport %dx%d for a %dx%d screen", d.ViewportWidth, d.ViewportHeight, d.ScreenWidth, d.ScreenHeight)
+		}
+	})
+
+	t.Run("From User Agent", func(t *testing.T) {
+		g := NewGenerator()
+		agent, err := g.FromUserAgent("Mozilla/5.0 (Linux; Android 14; Pixel 8 Pro) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.6943.49 Mobile Safari/537.36", RequestTypeNavigate)
+		if err != nil {
+			t.Fatalf("FromUserAgent failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		hints := agent.ClientHints.Values
+		if agent.Device.Name != "Pixel 8 Pro" || hints["sec-ch-dpr"] != "2.625" || hints["sec-ch-viewport-width"] != "412" || hints["sec-ch-device-memory"] != "8" {
+			t.Errorf("Unexpected device hints for a Pixel 8 Pro: %+v %v", agent.Device, hints)
+		}
+		if s := hints["sec-ch-prefers-color-scheme"]; s != `"light"` && s != `"dark"` {
+			t.Errorf("Unexpected color scheme %s", s)
+		}
+	})
+
+	t.Run("Android Catalog", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSAndroid), WithPlatforms(PlatformMobile), WithUserAgentReduction(false), WithFullFingerprint(true))
+		for i := 0; i < 20; i++ {
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			d := agent.Device
+			if d.Manufacturer == "" || !d.supportsAndroid(d.AndroidVersion) || d.BuildID != d.Builds[d.AndroidVersion] {
+				t.Errorf("Incoherent Android persona %+v", d)
+			}
+			if token := fmt.Sprintf("(Linux; Android %d; %s)", d.AndroidVersion, d.Model); !strings.Contains(agent.UserAgent, token) {
+				t.Errorf("Expected the UA to contain %q, got %q", token, agent.UserAgent)
+			}
+			if got, want := agent.ClientHints.Values["sec-ch-ua-platform-version"], fmt.Sprintf(`"%d.0.0"`, d.AndroidVersion); got != want {
+				t.Errorf("Expected sec-ch-ua-platform-version %s, got %s", want, got)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+
+	t.Run("Android Version From User Agent", func(t *testing.T) {
+		g := NewGenerator(WithFullFingerprint(true))
+		agent, err := g.FromUserAgent("Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.6943.49 Mobile Safari/537.36", RequestTypeNavigate)
+		if err != nil {
+			t.Fatalf("FromUserAgent failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		if agent.Device.AndroidVersion != 13 || agent.Device.BuildID != "TQ3A.230901.001" {
+			t.Errorf("Expected Android 13 build data, got %+v", agent.Device)
+		}
+		if got := agent.ClientHints.Values["sec-ch-ua-platform-version"]; got != `"13.0.0"` {
+			t.Errorf("Expected sec-ch-ua-platform-version \"13.0.0\", got %s", got)
+		}
+	})
+
+	t.Run("Firefox Android", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserFirefox), WithOS(OSAndroid), WithPlatforms(PlatformMobile))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		want := fmt.Sprintf("(Android %d; Mobile; rv:", agent.Device.AndroidVersion)
+		if !strings.Contains(agent.UserAgent, want) || strings.Contains(agent.UserAgent, agent.Device.Model) {
+			t.Errorf("Expected a model-less Firefox Android UA with %q, got %q", want, agent.UserAgent)
+		}
+	})
+
+	t.Run("Mac Desktop", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserSafari), WithOS(OSMac), WithPlatforms(PlatformDesktop))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		if agent.Device == nil || agent.Device.DPR != 2 || agent.ClientHints != nil {
+			t.Errorf("Expected a Retina Mac persona without client hints, got %+v", agent.Device)
+		}
+	})
+}
+
+func TestApproximateDeviceMemory(t *testing.T) {
+	for gb, want := range map[float64]float64{0.1: 0.25, 0.5: 0.5, 3: 2, 6: 4, 7: 8, 12: 8, 32: 8} {
+		if got := approximateDeviceMemory(gb); got != want {
+			t.Errorf("approximateDeviceMemory(%v) = %v, want %v", gb, got, want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package legitagent
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+const diffServerName = "example.com"
+
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+	DiffMoved   DiffKind = "moved"
+)
+
+type DiffEntry struct {
+	Field string   `json:"field"`
+	Kind  DiffKind `json:"kind"`
+	A     string   `json:"a,omitempty"`
+	B     string   `json:"b,omitempty"`
+}
+
+type DiffLayer struct {
+	Name    string      `json:"name"`
+	Entries []DiffEntry `json:"entries"`
+}
+
+type AgentDiff struct {
+	Layers []DiffLayer `json:"layers"`
+}
+
+func (d *AgentDiff) Empty() bool {
+	return len(d.Layers) == 0
+}
+
+func (d *AgentDiff) Layer(name string) *DiffLayer {
+	for i := range d.Layers {
+		if d.Layers[i].Name == name {
+			return &d.Layers[i]
+		}
+	}
+	return nil
+}
+
+func (d *AgentDiff) String() string {
+	if d.Empty() {
+		return "no differences\n"
+	}
+
+	var sb strings.Builder
+	for _, layer := range d.Layers {
+		sb.WriteString(layer.Name)
+		sb.WriteByte('\n')
+		for _, e := range layer.Entries {
+			switch e.Kind {
+			case DiffAdded:
+				fmt.Fprintf(&sb, "  + %s: %s\n", e.Field, e.B)
+			case DiffRemoved:
+				fmt.Fprintf(&sb, "  - %s: %s\n", e.Field, e.A)
+			case DiffChanged:
+				fmt.Fprintf(&sb, "  ~ %s: %s -> %s\n", e.Field, e.A, e.B)
+			case DiffMoved:
+				fmt.Fprintf(&sb, "  > %s: position %s -> %s\n", e.Field, e.A, e.B)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func DiffAgents(a, b *Agent) (*AgentDiff, error) {
+	d := &AgentDiff{}
+	add := func(name string, entries []DiffEntry) {
+		if len(entries) > 0 {
+			d.Layers = append(d.Layers, DiffLayer{Name: name, Entries: entries})
+		}
+	}
+
+	add("user-agent", diffUserAgents(a.UserAgent, b.UserAgent))
+
+	headersA, headersB := agentHeaderValues(a), agentHeaderValues(b)
+	orderA, orderB := a.wireHeaderOrder(), b.wireHeaderOrder()
+	add("header-set", diffSets("header", orderA, orderB))
+	add("header-order", diffOrder(orderA, orderB))
+	add("header-values", diffValues(headersA, headersB, orderA, orderB))
+
+	tlsA, err := a.tlsFingerprint(diffServerName, a.alpn())
+	if err != nil {
+		return nil, err
+	}
+	tlsB, err := b.tlsFingerprint(diffServerName, b.alpn())
+	if err != nil {
+		return nil, err
+	}
+	add("tls", diffClientHellos(tlsA, tlsB))
+
+	add("h2", diffH2(a, b))
+
+	return d, nil
+}
+
+func diffUserAgents(a, b string) []DiffEntry {
+	productsA, commentsA := userAgentTokens(a)
+	productsB, commentsB := userAgentTokens(b)
+
+	entries := diffValues(productsA, productsB, sortedKeys(productsA), sortedKeys(productsB))
+	return append(entries, diffSets("comment", commentsA, commentsB)...)
+}
+
+func userAgentTokens(ua string) (map[string]string, []string) {
+	products := make(map[string]string)
+	var comments []string
+
+	for len(ua) > 0 {
+		ua = strings.TrimLeft(ua, " ")
+		if ua == "" {
+			break
+		}
+
+		if ua[0] == '(' {
+			end := strings.IndexByte(ua, ')')
+			if end < 0 {
+				end = len(ua) - 1
+			}
+			for _, c := range strings.Split(ua[1:end], ";") {
+				if c = strings.TrimSpace(c); c != "" {
+					comments = append(comments, c)
+				}
+			}
+			ua = ua[end+1:]
+			continue
+		}
+
+		end := strings.IndexAny(ua, " (")
+		if end < 0 {
+			end = len(ua)
+		}
+		name, version, _ := strings.Cut(ua[:end], "/")
+		products[name] = version
+		ua = ua[end:]
+	}
+
+	return products, comments
+}
+
+func agentHeaderValues(a *Agent) map[string]string {
+	values := make(map[string]string, len(a.Headers))
+	for k, v := range a.Headers {
+		values[strings.ToLower(k)] = strings.Join(v, ", ")
+	}
+	delete(values, "user-agent")
+	return values
+}
+
+func diffSets(field string, a, b []string) []DiffEntry {
+	inA, inB := make(map[string]bool, len(a)), make(map[string]bool, len(b))
+	for _, v := range a {
+		inA[v] = true
+	}
+	for _, v := range b {
+		inB[v] = true
+	}
+
+	var entries []DiffEntry
+	for _, v := range a {
+		if !inB[v] {
+			entries = append(entries, DiffEntry{Field: field, Kind: DiffRemoved, A: v})
+		}
+	}
+	for _, v := range b {
+		if !inA[v] {
+			entries = append(entries, DiffEntry{Field: field, Kind: DiffAdded, B: v})
+		}
+	}
+	return entries
+}
+
+func diffOrder(a, b []string) []DiffEntry {
+	inA, inB := make(map[string]bool, len(a)), make(map[string]bool, len(b))
+	for _, v := range a {
+		inA[v] = true
+	}
+	for _, v := range b {
+		inB[v] = true
+	}
+
+	var commonA, commonB []string
+	for _, v := range a {
+		if inB[v] {
+			commonA = append(commonA, v)
+		}
+	}
+	for _, v := range b {
+		if inA[v] {
+			commonB = append(commonB, v)
+		}
+	}
+
+	posB := make(map[string]int, len(commonB))
+	for i, v := range commonB {
+		posB[v] = i
+	}
+
+	var entries []DiffEntry
+	for i, v := range commonA {
+		if j := posB[v]; i != j {
+			entries = append(entries, DiffEntry{Field: v, Kind: DiffMoved, A: strconv.Itoa(i), B: strconv.Itoa(j)})
+		}
+	}
+	return entries
+}
+
+func diffValues(a, b map[string]string, orderA, orderB []string) []DiffEntry {
+	var entries []DiffEntry
+	seen := make(map[string]bool, len(orderA)+len(orderB))
+
+	for _, k := range append(append([]string(nil), orderA...), orderB...) {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		va, okA := a[k]
+		vb, okB := b[k]
+		switch {
+		case okA && okB && va != vb:
+			entries = append(entries, DiffEntry{Field: k, Kind: DiffChanged, A: va, B: vb})
+		case okA && !okB:
+			entries = append(entries, DiffEntry{Field: k, Kind: DiffRemoved, A: va})
+		case !okA && okB:
+			entries = append(entries, DiffEntry{Field: k, Kind: DiffAdded, B: vb})
+		}
+	}
+	return entries
+}
+
+func diffClientHellos(a, b *TLSFingerprint) []DiffEntry {
+	var entries []DiffEntry
+	changed := func(field, va, vb string) {
+		if va != vb {
+			entries = append(entries, DiffEntry{Field: field, Kind: DiffChanged, A: va, B: vb})
+		}
+	}
+
+	changed("ja4", a.JA4, b.JA4)
+	changed("version", ja4Version(a.Version), ja4Version(b.Version))
+
+	ciphersA, ciphersB := cipherSuiteNames(a.CipherSuites), cipherSuiteNames(b.CipherSuites)
+	if cipherSet := diffSets("cipher", ciphersA, ciphersB); len(cipherSet) > 0 {
+		entries = append(entries, cipherSet...)
+	} else {
+		changed("cipher order", strings.Join(ciphersA, ","), strings.Join(ciphersB, ","))
+	}
+
+	entries = append(entries, diffSets("extension", hexNames(a.Extensions), hexNames(b.Extensions))...)
+	entries = append(entries, diffSets("curve", curveNames(a.SupportedGroups), curveNames(b.SupportedGroups))...)
+	changed("curve order", strings.Join(curveNames(a.SupportedGroups), ","), strings.Join(curveNames(b.SupportedGroups), ","))
+	changed("signature algorithms", strings.Join(hexNames(a.SignatureAlgorithms), ","), strings.Join(hexNames(b.SignatureAlgorithms), ","))
+	changed("supported versions", strings.Join(hexNames(a.SupportedVersions), ","), strings.Join(hexNames(b.SupportedVersions), ","))
+	changed("alpn", strings.Join(a.ALPN, ","), strings.Join(b.ALPN, ","))
+
+	return entries
+}
+
+func diffH2(a, b *Agent) []DiffEntry {
+	var entries []DiffEntry
+
+	if (a.H2Settings == nil) != (b.H2Settings == nil) {
+		protocol := func(ag *Agent) string {
+			if ag.H2Settings == nil {
+				return "http/1.1"
+			}
+			return "h2"
+		}
+		return append(entries, DiffEntry{Field: "protocol", Kind: DiffChanged, A: protocol(a), B: protocol(b)})
+	}
+	if a.H2Settings == nil {
+		return nil
+	}
+
+	settingsA, settingsB := h2SettingValues(a.H2Settings), h2SettingValues(b.H2Settings)
+	entries = append(entries, diffValues(settingsA, settingsB, sortedKeys(settingsA), sortedKeys(settingsB))...)
+
+	if a.H2WindowUpdate != b.H2WindowUpdate {
+		entries = append(entries, DiffEntry{Field: "window update", Kind: DiffChanged, A: strconv.FormatUint(uint64(a.H2WindowUpdate), 10), B: strconv.FormatUint(uint64(b.H2WindowUpdate), 10)})
+	}
+
+	if pa, pb := strings.Join(a.pseudoHeaderOrder(), ","), strings.Join(b.pseudoHeaderOrder(), ","); pa != pb {
+		entries = append(entries, DiffEntry{Field: "pseudo-header order", Kind: DiffChanged, A: pa, B: pb})
+	}
+
+	return entries
+}
+
+func h2SettingValues(settings map[http2.SettingID]uint32) map[string]string {
+	values := make(map[string]string, len(settings))
+	for id, v := range settings {
+		values[id.String()] = strconv.FormatUint(uint64(v), 10)
+	}
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func cipherSuiteNames(ids []uint16) []string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = tls.CipherSuiteName(id)
+	}
+	return names
+}
+
+func curveNames(ids []uint16) []string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = tls.CurveID(id).String()
+	}
+	return names
+}
+
+func hexNames(ids []uint16) []string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = fmt.Sprintf("0x%04x", id)
+	}
+	return names
+}
@@ -0,0 +1,76 @@
+package legitagent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffAgents(t *testing.T) {
+	chrome, err := FromUserAgentString("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", RequestTypeNavigate)
+	if err != nil {
+		t.Fatalf("FromUserAgentString failed: %v", err)
+	}
+
+	t.Run("Identical", func(t *testing.T) {
+		d, err := DiffAgents(chrome, chrome)
+		if err != nil {
+			t.Fatalf("DiffAgents failed: %v", err)
+		}
+		if !d.Empty() {
+			t.Errorf("Expected no differences, got:\n%s", d)
+		}
+	})
+
+	t.Run("Different Families", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserFirefox), WithOS(OSWindows), WithPlatforms(PlatformDesktop))
+		firefox, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(firefox)
+
+		d, err := DiffAgents(chrome, firefox)
+		if err != nil {
+			t.Fatalf("DiffAgents failed: %v", err)
+		}
+
+		for _, name := range []string{"user-agent", "header-set", "tls", "h2"} {
+			if d.Layer(name) == nil {
+				t.Errorf("Expected %s layer in diff:\n%s", name, d)
+			}
+		}
+
+		text := d.String()
+		for _, want := range []string{"- header: sec-ch-ua", "+ Firefox:", "~ pseudo-header order: :method,:authority,:scheme,:path -> :method,:path,:authority,:scheme"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("Expected text output to contain %q, got:\n%s", want, text)
+			}
+		}
+
+		raw, err := json.Marshal(d)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		var decoded AgentDiff
+		if err := json.Unmarshal(raw, &decoded); err != nil || len(decoded.Layers) != len(d.Layers) {
+			t.Errorf("JSON round trip failed: %v", err)
+		}
+	})
+
+	t.Run("Header Order", func(t *testing.T) {
+		moved := *chrome
+		moved.HeaderOrder = append([]string(nil), chrome.HeaderOrder...)
+		n := len(moved.HeaderOrder)
+		moved.HeaderOrder[n-1], moved.HeaderOrder[n-2] = moved.HeaderOrder[n-2], moved.HeaderOrder[n-1]
+
+		d, err := DiffAgents(chrome, &moved)
+		if err != nil {
+			t.Fatalf("DiffAgents failed: %v", err)
+		}
+		layer := d.Layer("header-order")
+		if layer == nil || len(layer.Entries) != 2 || len(d.Layers) != 1 {
+			t.Errorf("Expected exactly two moved headers, got:\n%s", d)
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package legitagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LayerTLS  = "tls"
+	LayerH2   = "h2"
+	LayerHTTP = "http"
+)
+
+type Drift struct {
+	Layer    string `json:"layer"`
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Observed string `json:"observed"`
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s/%s: expected %q, observed %q", d.Layer, d.Field, d.Expected, d.Observed)
+}
+
+type VerificationReport struct {
+	Browser   Browser         `json:"browser,omitempty"`
+	OS        OperatingSystem `json:"os,omitempty"`
+	Platform  Platform        `json:"platform,omitempty"`
+	Version   int             `json:"version,omitempty"`
+	UserAgent string          `json:"user_agent"`
+	Expected  *Fingerprint    `json:"expected"`
+	Observed  *EchoResponse   `json:"observed"`
+	Drifts    []Drift         `json:"drifts,omitempty"`
+}
+
+func (r *VerificationReport) OK() bool {
+	return len(r.Drifts) == 0
+}
+
+func VerifyAgent(ctx context.Context, agent *Agent, echoURL string) (*VerificationReport, error) {
+	u, err := url.Parse(echoURL)
+	if err != nil {
+		return nil, fmt.Errorf("legitagent: invalid echo url: %w", err)
+	}
+	u.Path = "/doctor"
+
+	expected, err := agent.Fingerprint(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if claimed, err := claimedTLSFingerprint(agent, u.Hostname()); err == nil {
+		expected.TLS = claimed
+	} else if !errors.Is(err, ErrUnsupportedBrowser) {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transport{Agent: agent, InsecureSkipVerify: true}
+	defer t.CloseIdleConnections()
+
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("legitagent: request to echo server failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("legitagent: echo server returned %s", resp.Status)
+	}
+
+	observed := new(EchoResponse)
+	if err := json.NewDecoder(resp.Body).Decode(observed); err != nil {
+		return nil, fmt.Errorf("legitagent: could not decode echo response: %w", err)
+	}
+
+	report := &VerificationReport{
+		UserAgent: agent.UserAgent,
+		Expected:  expected,
+		Observed:  observed,
+	}
+	report.Drifts = compareFingerprints(expected, profileHeaders(agent), observed)
+	return report, nil
+}
+
+func profileHeaders(agent *Agent) [][2]string {
+	values := agentHeaderValues(agent)
+	if agent.UserAgent != "" {
+		values["user-agent"] = agent.UserAgent
+	}
+
+	var headers [][2]string
+	for _, k := range agent.wireHeaderOrder() {
+		if v, ok := values[k]; ok && !hopByHopHeaders[k] {
+			headers = append(headers, [2]string{k, v})
+		}
+	}
+	return headers
+}
+
+func claimedTLSFingerprint(agent *Agent, serverName string) (*TLSFingerprint, error) {
+	info, err := ParseUserAgent(agent.UserAgent)
+	if err != nil || info.Browser == "" {
+		return nil, ErrUnsupportedBrowser
+	}
+
+	pack := DefaultProfilePack()
+	profile, ok := pack.browsers[info.Browser]
+	if !ok {
+		return nil, ErrUnsupportedBrowser
+	}
+
+	var versionProf VersionProfile
+	if osProf, ok := pack.os[info.profileOS]; ok && info.Engine == WebKit && isIOSVariant(pack, info.Browser, info.profileOS) {
+		osProf.Version = info.OSVersion
+		_, versionProf, err = iosWebKitProfile(pack, osProf)
+	} else {
+		versionProf, _, err = findClosestVersionProfile(profile.Versions, info.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := &Agent{ClientHelloID: versionProf.TLS.HelloID}
+	if versionProf.TLS.ClientSpec != nil {
+		claimed.ClientHelloSpec = versionProf.TLS.ClientSpec()
+	}
+	return claimed.tlsFingerprint(serverName, agent.alpn())
+}
+
+func VerifyCombinations(ctx context.Context, echoURL string) ([]*VerificationReport, error) {
+	var reports []*VerificationReport
+
+	pack := DefaultProfilePack()
+	for _, browser := range allRealBrowsers {
+		versions := getVersionKeys(pack.browsers[browser].Versions)
+		sort.Ints(versions)
+
+		for _, os := range allRealOS {
+			for _, platform := range pack.platformNames() {
+				for _, version := range versions {
+					for _, h2 := range []bool{true, false} {
+						if err := ctx.Err(); err != nil {
+							return reports, err
+						}
+
+						g := NewGenerator(
+							WithBrowsers(browser),
+							WithOS(os),
+							WithPlatforms(platform),
+							WithVersionRange(version, version),
+							WithH2Only(h2),
+						)
+						agent, err := g.Generate()
+						if err != nil {
+							continue
+						}
+
+						report, err := VerifyAgent(ctx, agent, echoURL)
+						g.ReleaseAgent(agent)
+						if err != nil {
+							return reports, fmt.Errorf("legitagent: %s %d on %s/%s: %w", browser, version, os, platform, err)
+						}
+
+						report.Browser, report.OS, report.Platform, report.Version = browser, os, platform, version
+						reports = append(reports, report)
+					}
+				}
+			}
+		}
+	}
+
+	return reports, nil
+}
+
+func compareFingerprints(expected *Fingerprint, headers [][2]string, observed *EchoResponse) []Drift {
+	var drifts []Drift
+	add := func(layer, field, want, got string) {
+		if want != got {
+			drifts = append(drifts, Drift{Layer: layer, Field: field, Expected: want, Observed: got})
+		}
+	}
+
+	if observed.TLS == nil {
+		add(LayerTLS, "client_hello", "present", "missing")
+	} else {
+		add(LayerTLS, "ja4", expected.TLS.JA4, observed.TLS.JA4)
+		add(LayerTLS, "ja3", normalizedJA3(expected.TLS), normalizedJA3(observed.TLS))
+		add(LayerTLS, "alpn", strings.Join(expected.TLS.ALPN, ","), strings.Join(observed.TLS.ALPN, ","))
+		add(LayerTLS, "server_name", expected.TLS.ServerName, observed.TLS.ServerName)
+	}
+
+	add(LayerHTTP, "protocol", expected.HTTPVersion, observed.HTTPVersion)
+
+	if expected.H2 != nil && observed.H2 != nil {
+		add(LayerH2, "settings", settingsString(expected.H2), settingsString(observed.H2))
+		add(LayerH2, "window_update", strconv.FormatUint(uint64(expected.H2.WindowUpdate), 10), strconv.FormatUint(uint64(observed.H2.WindowUpdate), 10))
+		add(LayerH2, "priorities", prioritiesString(expected.H2), prioritiesString(observed.H2))
+		add(LayerH2, "pseudo_header_order", strings.Join(expected.H2.PseudoHeaderOrder, ","), strings.Join(observed.H2.PseudoHeaderOrder, ","))
+		add(LayerH2, "akamai", expected.H2.Akamai, observed.H2.Akamai)
+	}
+
+	add(LayerHTTP, "user_agent", expected.UserAgent, observed.UserAgent)
+
+	var wantOrder, gotOrder []string
+	for _, h := range headers {
+		wantOrder = append(wantOrder, h[0])
+	}
+	for _, h := range observed.Headers {
+		if h.Name != "host" && h.Name != "connection" {
+			gotOrder = append(gotOrder, h.Name)
+		}
+	}
+	add(LayerHTTP, "header_order", strings.Join(wantOrder, ","), strings.Join(gotOrder, ","))
+
+	for _, h := range headers {
+		got := ""
+		for _, o := range observed.Headers {
+			if o.Name == h[0] {
+				got = o.Value
+				break
+			}
+		}
+		add(LayerHTTP, "header:"+h[0], h[1], got)
+	}
+
+	return drifts
+}
+
+func normalizedJA3(f *TLSFingerprint) string {
+	exts := append([]uint16(nil), f.Extensions...)
+	sort.Slice(exts, func(i, j int) bool { return exts[i] < exts[j] })
+
+	return strings.Join([]string{
+		strconv.Itoa(int(f.Version)),
+		joinUint16(f.CipherSuites, "-", false),
+		joinUint16(exts, "-", false),
+		joinUint16(f.SupportedGroups, "-", false),
+		joinUint16(f.PointFormats, "-", false),
+	}, ",")
+}
+
+func settingsString(f *H2Fingerprint) string {
+	parts := make([]string, len(f.Settings))
+	for i, s := range f.Settings {
+		parts[i] = fmt.Sprintf("%d:%d", s.ID, s.Val)
+	}
+	return strings.Join(parts, ";")
+}
+
+func prioritiesString(f *H2Fingerprint) string {
+	parts := make([]string, len(f.Priorities))
+	for i, p := range f.Priorities {
+		parts[i] = fmt.Sprintf("%d:%t:%d:%d", p.StreamID, p.Exclusive, p.DependsOn, p.Weight)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,124 @@
+package legitagent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestVerifyCombinations(t *testing.T) {
+	s, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("NewEchoServer failed: %v", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	reports, err := VerifyCombinations(ctx, s.URL)
+	if err != nil {
+		t.Fatalf("VerifyCombinations failed: %v", err)
+	}
+	if len(reports) == 0 {
+		t.Fatal("Expected at least one verified combination")
+	}
+
+	for _, r := range reports {
+		for _, d := range r.Drifts {
+			t.Errorf("%s %d on %s/%s (%s): %s", r.Browser, r.Version, r.OS, r.Platform, r.Expected.HTTPVersion, d)
+		}
+	}
+}
+
+func TestVerifyAgentReportsDrift(t *testing.T) {
+	s, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("NewEchoServer failed: %v", err)
+	}
+	defer s.Close()
+
+	g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSWindows11), WithPlatforms(PlatformDesktop))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	report, err := VerifyAgent(context.Background(), agent, s.URL)
+	if err != nil {
+		t.Fatalf("VerifyAgent failed: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Expected no drift, got %v", report.Drifts)
+	}
+
+	report.Expected.H2.WindowUpdate++
+	report.Expected.TLS.JA4 = "t13d0000h2_000000000000_000000000000"
+	drifts := compareFingerprints(report.Expected, profileHeaders(agent), report.Observed)
+
+	layers := make(map[string]bool)
+	for _, d := range drifts {
+		layers[d.Layer+"/"+d.Field] = true
+	}
+	if !layers["tls/ja4"] || !layers["h2/window_update"] {
+		t.Errorf("Expected tls/ja4 and h2/window_update drift, got %v", drifts)
+	}
+
+	observed := *report.Observed
+	observed.Headers = append([]EchoHeader(nil), observed.Headers...)
+	first, last := 0, len(observed.Headers)-1
+	observed.Headers[first], observed.Headers[last] = observed.Headers[last], observed.Headers[first]
+	found := false
+	for _, d := range compareFingerprints(report.Expected, profileHeaders(agent), &observed) {
+		found = found || (d.Layer == LayerHTTP && d.Field == "header_order")
+	}
+	if !found {
+		t.Error("Expected a reordered request to drift on http/header_order")
+	}
+
+	agent.Headers.Set("x-unordered", "1")
+	defer agent.Headers.Del("x-unordered")
+	report, err = VerifyAgent(context.Background(), agent, s.URL)
+	if err != nil {
+		t.Fatalf("VerifyAgent failed: %v", err)
+	}
+	found = false
+	for _, d := range report.Drifts {
+		found = found || (d.Layer == LayerHTTP && d.Field == "header_order")
+	}
+	if !found {
+		t.Errorf("Expected a header outside the profile order to drift, got %v", report.Drifts)
+	}
+}
+
+func TestVerifyAgentUsesClaimedProfile(t *testing.T) {
+	s, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("NewEchoServer failed: %v", err)
+	}
+	defer s.Close()
+
+	g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSWindows11), WithPlatforms(PlatformDesktop))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+	agent.ClientHelloID = utls.HelloFirefox_120
+
+	report, err := VerifyAgent(context.Background(), agent, s.URL)
+	if err != nil {
+		t.Fatalf("VerifyAgent failed: %v", err)
+	}
+
+	found := false
+	for _, d := range report.Drifts {
+		found = found || (d.Layer == LayerTLS && d.Field == "ja4")
+	}
+	if !found {
+		t.Errorf("Expected a Firefox ClientHello under a Chrome UA to drift, got %v", report.Drifts)
+	}
+}
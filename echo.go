@@ -0,0 +1,512 @@
+package legitagent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	maxRecordedHelloBytes = 64 << 10
+	echoHandshakeTimeout  = 10 * time.Second
+	echoIdleTimeout       = 60 * time.Second
+)
+
+type EchoHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type EchoResponse struct {
+	RemoteAddr string       `json:"remote_addr"`
+	Method     string       `json:"method"`
+	Path       string       `json:"path"`
+	Headers    []EchoHeader `json:"headers"`
+	JA3        string       `json:"ja3,omitempty"`
+	JA3Hash    string       `json:"ja3_hash,omitempty"`
+	JA4        string       `json:"ja4,omitempty"`
+	Akamai     string       `json:"akamai,omitempty"`
+	Fingerprint
+}
+
+type EchoServer struct {
+	URL         string
+	Listener    net.Listener
+	Certificate *x509.Certificate
+
+	config *tls.Config
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func NewEchoServer() (*EchoServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("legitagent: could not listen for echo server: %w", err)
+	}
+
+	s, err := ServeEchoListener(l, nil)
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func ServeEchoListener(l net.Listener, config *tls.Config) (*EchoServer, error) {
+	if config == nil {
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}}
+	} else {
+		config = config.Clone()
+	}
+	config.NextProtos = []string{"h2", "http/1.1"}
+
+	s := &EchoServer{
+		URL:      "https://" + l.Addr().String(),
+		Listener: l,
+		config:   config,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	if len(config.Certificates) > 0 {
+		s.Certificate = config.Certificates[0].Leaf
+		if s.Certificate == nil && len(config.Certificates[0].Certificate) > 0 {
+			s.Certificate, _ = x509.ParseCertificate(config.Certificates[0].Certificate[0])
+		}
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+func (s *EchoServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.Listener.Close()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *EchoServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		raw, err := s.Listener.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = raw.Close()
+			return
+		}
+		s.conns[raw] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(raw)
+
+			s.mu.Lock()
+			delete(s.conns, raw)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *EchoServer) handleConn(raw net.Conn) {
+	defer raw.Close()
+
+	rec := &helloRecordingConn{Conn: raw}
+	conn := tls.Server(rec, s.config)
+
+	_ = raw.SetDeadline(time.Now().Add(echoHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		return
+	}
+	_ = raw.SetDeadline(time.Time{})
+
+	base := EchoResponse{RemoteAddr: raw.RemoteAddr().String()}
+	if hello, err := ParseClientHello(rec.ClientHello()); err == nil {
+		base.TLS = hello
+		base.JA3 = hello.JA3
+		base.JA3Hash = hello.JA3Hash
+		base.JA4 = hello.JA4
+	}
+
+	if conn.ConnectionState().NegotiatedProtocol == "h2" {
+		base.HTTPVersion = "h2"
+		_ = serveEchoH2(conn, base)
+		return
+	}
+
+	base.HTTPVersion = "http/1.1"
+	_ = serveEchoHTTP1(conn, base)
+}
+
+func serveEchoHTTP1(conn net.Conn, base EchoResponse) error {
+	br := bufio.NewReader(conn)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(echoIdleTimeout))
+
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 3 {
+			return fmt.Errorf("legitagent: malformed request line %q", line)
+		}
+
+		resp := base
+		resp.Method, resp.Path = parts[0], parts[1]
+
+		keepAlive := parts[2] == "HTTP/1.1"
+		contentLength := 0
+		chunked := false
+
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			name = strings.ToLower(strings.TrimSpace(name))
+			value = strings.TrimSpace(value)
+
+			resp.Headers = append(resp.Headers, EchoHeader{Name: name, Value: value})
+			resp.HeaderOrder = append(resp.HeaderOrder, name)
+
+			switch name {
+			case "user-agent":
+				resp.UserAgent = value
+			case "content-length":
+				contentLength, _ = strconv.Atoi(value)
+			case "transfer-encoding":
+				chunked = strings.Contains(strings.ToLower(value), "chunked")
+			case "connection":
+				if strings.EqualFold(value, "close") {
+					keepAlive = false
+				} else if strings.EqualFold(value, "keep-alive") {
+					keepAlive = true
+				}
+			}
+		}
+
+		if chunked {
+			keepAlive = false
+		} else if contentLength > 0 {
+			if _, err := io.CopyN(io.Discard, br, int64(contentLength)); err != nil {
+				return err
+			}
+		}
+
+		body, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+
+		connection := "keep-alive"
+		if !keepAlive {
+			connection = "close"
+		}
+		if _, err := fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: %s\r\n\r\n", len(body), connection); err != nil {
+			return err
+		}
+		if _, err := conn.Write(body); err != nil {
+			return err
+		}
+
+		if !keepAlive {
+			return nil
+		}
+	}
+}
+
+func serveEchoH2(conn net.Conn, base EchoResponse) error {
+	preface := make([]byte, len(h2ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil {
+		return err
+	}
+	if string(preface) != h2ClientPreface {
+		return errors.New("legitagent: invalid http/2 client preface")
+	}
+
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	framer.MaxHeaderListSize = 1 << 20
+
+	if err := framer.WriteSettings(http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: 100}); err != nil {
+		return err
+	}
+
+	var (
+		settings     []http2.Setting
+		settingsSeen bool
+		windowUpdate uint32
+		priorities   []H2Priority
+		headersSeen  bool
+		maxFrameSize uint32 = 16384
+		pending             = make(map[uint32]EchoResponse)
+		respBuf      bytes.Buffer
+		respEncoder  = hpack.NewEncoder(&respBuf)
+	)
+
+	respond := func(streamID uint32, resp EchoResponse) error {
+		fp := NewH2Fingerprint(settings, windowUpdate, priorities, resp.H2.PseudoHeaderOrder)
+		resp.H2 = fp
+		resp.Akamai = fp.Akamai
+
+		body, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+
+		respBuf.Reset()
+		_ = respEncoder.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		_ = respEncoder.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/json"})
+		_ = respEncoder.WriteField(hpack.HeaderField{Name: "content-length", Value: strconv.Itoa(len(body))})
+		if err := framer.WriteHeaders(http2.HeadersFrameParam{StreamID: streamID, BlockFragment: respBuf.Bytes(), EndHeaders: true}); err != nil {
+			return err
+		}
+
+		for len(body) > int(maxFrameSize) {
+			if err := framer.WriteData(streamID, false, body[:maxFrameSize]); err != nil {
+				return err
+			}
+			body = body[maxFrameSize:]
+		}
+		return framer.WriteData(streamID, true, body)
+	}
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(echoIdleTimeout))
+
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return err
+		}
+
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if !settingsSeen {
+				settingsSeen = true
+				_ = f.ForeachSetting(func(s http2.Setting) error {
+					settings = append(settings, s)
+					return nil
+				})
+			}
+			if v, ok := f.Value(http2.SettingMaxFrameSize); ok && v >= 16384 {
+				maxFrameSize = v
+			}
+			if err := framer.WriteSettingsAck(); err != nil {
+				return err
+			}
+		case *http2.WindowUpdateFrame:
+			if f.StreamID == 0 && !headersSeen && windowUpdate == 0 {
+				windowUpdate = f.Increment
+			}
+		case *http2.PriorityFrame:
+			if !headersSeen {
+				priorities = append(priorities, H2Priority{
+					StreamID:  f.StreamID,
+					Exclusive: f.Exclusive,
+					DependsOn: f.StreamDep,
+					Weight:    f.Weight,
+				})
+			}
+		case *http2.MetaHeadersFrame:
+			headersSeen = true
+
+			resp := base
+			pseudo, _ := splitHeaderFields(f.Fields)
+			resp.H2 = &H2Fingerprint{PseudoHeaderOrder: pseudo}
+			for _, field := range f.Fields {
+				switch field.Name {
+				case ":method":
+					resp.Method = field.Value
+				case ":path":
+					resp.Path = field.Value
+				}
+				if strings.HasPrefix(field.Name, ":") {
+					continue
+				}
+				resp.Headers = append(resp.Headers, EchoHeader{Name: field.Name, Value: field.Value})
+				resp.HeaderOrder = append(resp.HeaderOrder, field.Name)
+				if field.Name == "user-agent" {
+					resp.UserAgent = field.Value
+				}
+			}
+
+			if f.StreamEnded() {
+				if err := respond(f.StreamID, resp); err != nil {
+					return err
+				}
+			} else {
+				pending[f.StreamID] = resp
+			}
+		case *http2.DataFrame:
+			if n := uint32(len(f.Data())); n > 0 {
+				_ = framer.WriteWindowUpdate(0, n)
+				_ = framer.WriteWindowUpdate(f.StreamID, n)
+			}
+			if resp, ok := pending[f.StreamID]; ok && f.StreamEnded() {
+				delete(pending, f.StreamID)
+				if err := respond(f.StreamID, resp); err != nil {
+					return err
+				}
+			}
+		case *http2.RSTStreamFrame:
+			delete(pending, f.StreamID)
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				if err := framer.WritePing(true, f.Data); err != nil {
+					return err
+				}
+			}
+		case *http2.GoAwayFrame:
+			return nil
+		}
+	}
+}
+
+type helloRecordingConn struct {
+	net.Conn
+	mu   sync.Mutex
+	buf  []byte
+	done bool
+}
+
+func (c *helloRecordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.record(p[:n])
+	}
+	return n, err
+}
+
+func (c *helloRecordingConn) record(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= maxRecordedHelloBytes || clientHelloComplete(c.buf) {
+		c.done = true
+	}
+}
+
+func (c *helloRecordingConn) ClientHello() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf
+}
+
+func clientHelloComplete(data []byte) bool {
+	var msg []byte
+	for len(data) >= 5 {
+		if data[0] != 0x16 {
+			return true
+		}
+		n := int(data[3])<<8 | int(data[4])
+		if len(data) < 5+n {
+			return false
+		}
+		msg = append(msg, data[5:5+n]...)
+		data = data[5+n:]
+		if len(msg) >= 4 && len(msg)-4 >= int(msg[1])<<16|int(msg[2])<<8|int(msg[3]) {
+			return true
+		}
+	}
+	return false
+}
+
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("legitagent: could not generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("legitagent: could not generate serial: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"legitagent echo"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("legitagent: could not create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -0,0 +1,137 @@
+package legitagent
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+func echoH2Client(id utls.ClientHelloID) *http.Client {
+	dialTLSContext := func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		rawConn, err := (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		uconn := utls.UClient(rawConn, &utls.Config{ServerName: "localhost", InsecureSkipVerify: true, NextProtos: []string{"h2", "http/1.1"}}, id)
+		if err := uconn.HandshakeContext(ctx); err != nil {
+			_ = rawConn.Close()
+			return nil, err
+		}
+		return uconn, nil
+	}
+
+	return &http.Client{
+		Transport: &http2.Transport{DialTLSContext: dialTLSContext},
+		Timeout:   10 * time.Second,
+	}
+}
+
+func TestEchoServerHTTP2(t *testing.T) {
+	s, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("NewEchoServer failed: %v", err)
+	}
+	defer s.Close()
+
+	g := NewGenerator(WithBrowsers(BrowserChrome), WithVersionRange(140, 140), WithOS(OSWindows11), WithPlatforms(PlatformDesktop))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range agent.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", agent.UserAgent)
+
+	resp, err := echoH2Client(agent.ClientHelloID).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var echo EchoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&echo); err != nil {
+		t.Fatalf("Failed to decode echo response: %v", err)
+	}
+
+	expected, err := agent.Fingerprint("localhost")
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+
+	if echo.HTTPVersion != "h2" || echo.Path != "/echo" || echo.Method != http.MethodGet {
+		t.Errorf("Unexpected request line: %s %s %s", echo.HTTPVersion, echo.Method, echo.Path)
+	}
+	if echo.JA4 != expected.TLS.JA4 {
+		t.Errorf("JA4 mismatch: server saw %s, agent claims %s", echo.JA4, expected.TLS.JA4)
+	}
+	if echo.UserAgent != agent.UserAgent {
+		t.Errorf("User-Agent mismatch: %q", echo.UserAgent)
+	}
+	if echo.H2 == nil || echo.Akamai == "" || len(echo.H2.Settings) == 0 {
+		t.Errorf("Expected an Akamai fingerprint, got %+v", echo.H2)
+	}
+	if len(echo.H2.PseudoHeaderOrder) != 4 {
+		t.Errorf("Expected four pseudo-headers, got %v", echo.H2.PseudoHeaderOrder)
+	}
+}
+
+func TestEchoServerHTTP1(t *testing.T) {
+	s, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("NewEchoServer failed: %v", err)
+	}
+	defer s.Close()
+
+	conn, err := tls.Dial("tcp", s.Listener.Addr().String(), &tls.Config{ServerName: "localhost", InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		if _, err := fmt.Fprintf(conn, "GET /h1/%d HTTP/1.1\r\nHost: localhost\r\nUser-Agent: echo-test\r\nAccept: */*\r\n\r\n", i); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("ReadResponse failed: %v", err)
+		}
+
+		var echo EchoResponse
+		err = json.NewDecoder(resp.Body).Decode(&echo)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode echo response: %v", err)
+		}
+
+		if echo.HTTPVersion != "http/1.1" || echo.Path != fmt.Sprintf("/h1/%d", i) {
+			t.Errorf("Unexpected request: %s %s", echo.HTTPVersion, echo.Path)
+		}
+		if !reflect.DeepEqual(echo.HeaderOrder, []string{"host", "user-agent", "accept"}) {
+			t.Errorf("Unexpected header order: %v", echo.HeaderOrder)
+		}
+		if !strings.HasPrefix(echo.JA4, "t13d") {
+			t.Errorf("Unexpected JA4: %s", echo.JA4)
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package legitagent
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+var (
+	ErrNotClientHello       = errors.New("data does not contain a tls client hello")
+	ErrTruncatedClientHello = errors.New("tls client hello is truncated")
+)
+
+const (
+	extServerName          uint16 = 0x0000
+	extSupportedGroups     uint16 = 0x000a
+	extPointFormats        uint16 = 0x000b
+	extSignatureAlgorithms uint16 = 0x000d
+	extALPN                uint16 = 0x0010
+	extSupportedVersions   uint16 = 0x002b
+)
+
+type TLSFingerprint struct {
+	Version             uint16   `json:"version"`
+	CipherSuites        []uint16 `json:"cipher_suites"`
+	Extensions          []uint16 `json:"extensions"`
+	SupportedGroups     []uint16 `json:"supported_groups,omitempty"`
+	PointFormats        []uint16 `json:"point_formats,omitempty"`
+	SignatureAlgorithms []uint16 `json:"signature_algorithms,omitempty"`
+	SupportedVersions   []uint16 `json:"supported_versions,omitempty"`
+	ALPN                []string `json:"alpn,omitempty"`
+	ServerName          string   `json:"server_name,omitempty"`
+	JA3                 string   `json:"ja3"`
+	JA3Hash             string   `json:"ja3_hash"`
+	JA4                 string   `json:"ja4"`
+}
+
+type H2Priority struct {
+	StreamID  uint32 `json:"stream_id"`
+	Exclusive bool   `json:"exclusive"`
+	DependsOn uint32 `json:"depends_on"`
+	Weight    uint8  `json:"weight"`
+}
+
+type H2Fingerprint struct {
+	Settings          []http2.Setting `json:"settings"`
+	WindowUpdate      uint32          `json:"window_update"`
+	Priorities        []H2Priority    `json:"priorities,omitempty"`
+	PseudoHeaderOrder []string        `json:"pseudo_header_order"`
+	Akamai            string          `json:"akamai"`
+}
+
+type Fingerprint struct {
+	UserAgent   string          `json:"user_agent,omitempty"`
+	HTTPVersion string          `json:"http_version,omitempty"`
+	TLS         *TLSFingerprint `json:"tls,omitempty"`
+	H2          *H2Fingerprint  `json:"h2,omitempty"`
+	HeaderOrder []string        `json:"header_order,omitempty"`
+}
+
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func ParseClientHello(data []byte) (*TLSFingerprint, error) {
+	msg, err := clientHelloMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	r := byteReader{b: msg}
+	if t, _ := r.u8(); t != 0x01 {
+		return nil, ErrNotClientHello
+	}
+	length, ok := r.u24()
+	if !ok || int(length) > len(r.b) {
+		return nil, ErrTruncatedClientHello
+	}
+	r.b = r.b[:length]
+
+	f := &TLSFingerprint{}
+	if f.Version, ok = r.u16(); !ok {
+		return nil, ErrTruncatedClientHello
+	}
+	if _, ok = r.bytes(32); !ok {
+		return nil, ErrTruncatedClientHello
+	}
+	if _, ok = r.vec8(); !ok {
+		return nil, ErrTruncatedClientHello
+	}
+	ciphers, ok := r.vec16()
+	if !ok {
+		return nil, ErrTruncatedClientHello
+	}
+	for cr := (byteReader{b: ciphers}); len(cr.b) >= 2; {
+		c, _ := cr.u16()
+		if !isGREASE(c) {
+			f.CipherSuites = append(f.CipherSuites, c)
+		}
+	}
+	if _, ok = r.vec8(); !ok {
+		return nil, ErrTruncatedClientHello
+	}
+
+	if len(r.b) > 0 {
+		exts, ok := r.vec16()
+		if !ok {
+			return nil, ErrTruncatedClientHello
+		}
+		for er := (byteReader{b: exts}); len(er.b) > 0; {
+			id, ok1 := er.u16()
+			body, ok2 := er.vec16()
+			if !ok1 || !ok2 {
+				return nil, ErrTruncatedClientHello
+			}
+			f.addExtension(id, body)
+		}
+	}
+
+	f.compute()
+	return f, nil
+}
+
+func clientHelloMessage(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrNotClientHello
+	}
+	if data[0] == 0x01 {
+		return data, nil
+	}
+	if data[0] != 0x16 {
+		return nil, ErrNotClientHello
+	}
+
+	var msg []byte
+	for len(data) >= 5 && data[0] == 0x16 {
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+n {
+			msg = append(msg, data[5:]...)
+			break
+		}
+		msg = append(msg, data[5:5+n]...)
+		data = data[5+n:]
+		if len(msg) >= 4 && len(msg)-4 >= int(msg[1])<<16|int(msg[2])<<8|int(msg[3]) {
+			break
+		}
+	}
+
+	if len(msg) < 4 {
+		return nil, ErrTruncatedClientHello
+	}
+	return msg, nil
+}
+
+func (f *TLSFingerprint) addExtension(id uint16, body []byte) {
+	if isGREASE(id) {
+		return
+	}
+	f.Extensions = append(f.Extensions, id)
+
+	r := byteReader{b: body}
+	switch id {
+	case extServerName:
+		list, _ := r.vec16()
+		lr := byteReader{b: list}
+		if t, ok := lr.u8(); ok && t == 0 {
+			if name, ok := lr.vec16(); ok {
+				f.ServerName = string(name)
+			}
+		}
+	case extSupportedGroups:
+		list, _ := r.vec16()
+		for lr := (byteReader{b: list}); len(lr.b) >= 2; {
+			g, _ := lr.u16()
+			if !isGREASE(g) {
+				f.SupportedGroups = append(f.SupportedGroups, g)
+			}
+		}
+	case extPointFormats:
+		list, _ := r.vec8()
+		for _, p := range list {
+			f.PointFormats = append(f.PointFormats, uint16(p))
+		}
+	case extSignatureAlgorithms:
+		list, _ := r.vec16()
+		for lr := (byteReader{b: list}); len(lr.b) >= 2; {
+			s, _ := lr.u16()
+			f.SignatureAlgorithms = append(f.SignatureAlgorithms, s)
+		}
+	case extALPN:
+		list, _ := r.vec16()
+		for lr := (byteReader{b: list}); len(lr.b) > 0; {
+			proto, ok := lr.vec8()
+			if !ok {
+				break
+			}
+			f.ALPN = append(f.ALPN, string(proto))
+		}
+	case extSupportedVersions:
+		list, _ := r.vec8()
+		for lr := (byteReader{b: list}); len(lr.b) >= 2; {
+			v, _ := lr.u16()
+			if !isGREASE(v) {
+				f.SupportedVersions = append(f.SupportedVersions, v)
+			}
+		}
+	}
+}
+
+func (f *TLSFingerprint) compute() {
+	f.JA3 = strings.Join([]string{
+		strconv.Itoa(int(f.Version)),
+		joinUint16(f.CipherSuites, "-", false),
+		joinUint16(f.Extensions, "-", false),
+		joinUint16(f.SupportedGroups, "-", false),
+		joinUint16(f.PointFormats, "-", false),
+	}, ",")
+	sum := md5.Sum([]byte(f.JA3))
+	f.JA3Hash = hex.EncodeToString(sum[:])
+	f.JA4 = f.ja4()
+}
+
+func (f *TLSFingerprint) ja4() string {
+	version := f.Version
+	if len(f.SupportedVersions) > 0 {
+		version = 0
+		for _, v := range f.SupportedVersions {
+			if v > version {
+				version = v
+			}
+		}
+	}
+
+	sni := "i"
+	if f.hasExtension(extServerName) {
+		sni = "d"
+	}
+
+	alpn := "00"
+	if len(f.ALPN) > 0 && f.ALPN[0] != "" {
+		first, last := f.ALPN[0][0], f.ALPN[0][len(f.ALPN[0])-1]
+		if isAlphanumeric(first) && isAlphanumeric(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			h := hex.EncodeToString([]byte(f.ALPN[0]))
+			alpn = string([]byte{h[0], h[len(h)-1]})
+		}
+	}
+
+	ciphers := append([]uint16(nil), f.CipherSuites...)
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+
+	exts := make([]uint16, 0, len(f.Extensions))
+	for _, e := range f.Extensions {
+		if e != extServerName && e != extALPN {
+			exts = append(exts, e)
+		}
+	}
+	sort.Slice(exts, func(i, j int) bool { return exts[i] < exts[j] })
+
+	cipherHash := "000000000000"
+	if len(ciphers) > 0 {
+		cipherHash = truncatedSHA256(joinUint16(ciphers, ",", true))
+	}
+
+	extHash := "000000000000"
+	if len(exts) > 0 {
+		raw := joinUint16(exts, ",", true)
+		if len(f.SignatureAlgorithms) > 0 {
+			raw += "_" + joinUint16(f.SignatureAlgorithms, ",", true)
+		}
+		extHash = truncatedSHA256(raw)
+	}
+
+	return fmt.Sprintf("t%s%s%02d%02d%s_%s_%s",
+		ja4Version(version), sni, min(len(f.CipherSuites), 99), min(len(f.Extensions), 99), alpn, cipherHash, extHash)
+}
+
+func (f *TLSFingerprint) hasExtension(id uint16) bool {
+	for _, e := range f.Extensions {
+		if e == id {
+			return true
+		}
+	}
+	return false
+}
+
+func ja4Version(v uint16) string {
+	switch v {
+	case utls.VersionTLS13:
+		return "13"
+	case utls.VersionTLS12:
+		return "12"
+	case utls.VersionTLS11:
+		return "11"
+	case utls.VersionTLS10:
+		return "10"
+	case 0x0300:
+		return "s3"
+	default:
+		return "00"
+	}
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func joinUint16(values []uint16, sep string, asHex bool) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if asHex {
+			parts[i] = fmt.Sprintf("%04x", v)
+		} else {
+			parts[i] = strconv.Itoa(int(v))
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func truncatedSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func ClientHelloIDFingerprint(id utls.ClientHelloID, serverName string) (*TLSFingerprint, error) {
+	return (&Agent{ClientHelloID: id}).tlsFingerprint(serverName, h2ALPN)
+}
+
+func ClientHelloSpecFingerprint(spec *utls.ClientHelloSpec, serverName string) (*TLSFingerprint, error) {
+	if spec == nil {
+		return nil, errors.New("legitagent: nil client hello spec")
+	}
+	return (&Agent{ClientHelloSpec: spec}).tlsFingerprint(serverName, h2ALPN)
+}
+
+func (a *Agent) tlsFingerprint(serverName string, alpn []string) (*TLSFingerprint, error) {
+	raw, err := a.captureClientHello(serverName, alpn)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClientHello(raw)
+}
+
+func (a *Agent) captureClientHello(serverName string, alpn []string) ([]byte, error) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	uconn, err := a.newUConn(client, &utls.Config{ServerName: serverName, InsecureSkipVerify: true}, alpn)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	go func() {
+		_ = uconn.Handshake()
+		_ = client.Close()
+	}()
+
+	return readClientHelloRecord(server)
+}
+
+func readClientHelloRecord(server net.Conn) ([]byte, error) {
+	if err := server.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		return nil, fmt.Errorf("legitagent: could not capture client hello: %w", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(server, body); err != nil {
+		return nil, fmt.Errorf("legitagent: could not capture client hello: %w", err)
+	}
+
+	return append(header, body...), nil
+}
+
+func NewH2Fingerprint(settings []http2.Setting, windowUpdate uint32, priorities []H2Priority, pseudoHeaderOrder []string) *H2Fingerprint {
+	f := &H2Fingerprint{
+		Settings:          settings,
+		WindowUpdate:      windowUpdate,
+		Priorities:        priorities,
+		PseudoHeaderOrder: pseudoHeaderOrder,
+	}
+	f.Akamai = f.akamai()
+	return f
+}
+
+func (f *H2Fingerprint) akamai() string {
+	settings := make([]string, len(f.Settings))
+	for i, s := range f.Settings {
+		settings[i] = fmt.Sprintf("%d:%d", s.ID, s.Val)
+	}
+
+	windowUpdate := "00"
+	if f.WindowUpdate != 0 {
+		windowUpdate = strconv.FormatUint(uint64(f.WindowUpdate), 10)
+	}
+
+	priorities := "0"
+	if len(f.Priorities) > 0 {
+		parts := make([]string, len(f.Priorities))
+		for i, p := range f.Priorities {
+			exclusive := 0
+			if p.Exclusive {
+				exclusive = 1
+			}
+			parts[i] = fmt.Sprintf("%d:%d:%d:%d", p.StreamID, exclusive, p.DependsOn, int(p.Weight)+1)
+		}
+		priorities = strings.Join(parts, ",")
+	}
+
+	pseudo := make([]string, 0, len(f.PseudoHeaderOrder))
+	for _, h := range f.PseudoHeaderOrder {
+		if len(h) > 1 && h[0] == ':' {
+			pseudo = append(pseudo, h[1:2])
+		}
+	}
+
+	return strings.Join([]string{strings.Join(settings, ";"), windowUpdate, priorities, strings.Join(pseudo, ",")}, "|")
+}
+
+func orderedH2Settings(settings map[http2.SettingID]uint32) []http2.Setting {
+	ordered := make([]http2.Setting, 0, len(settings))
+	for id, val := range settings {
+		ordered = append(ordered, http2.Setting{ID: id, Val: val})
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].ID < ordered[j].ID })
+	return ordered
+}
+
+func (a *Agent) pseudoHeaderOrder() []string {
+	var pseudo []string
+	for _, h := range a.HeaderOrder {
+		if strings.HasPrefix(h, ":") {
+			pseudo = append(pseudo, h)
+		}
+	}
+	if len(pseudo) == 0 {
+		pseudo = []string{":method", ":authority", ":scheme", ":path"}
+	}
+	return pseudo
+}
+
+func (a *Agent) wireHeaderOrder() []string {
+	order := make([]string, 0, len(a.HeaderOrder)+1)
+	for _, h := range a.HeaderOrder {
+		if !strings.HasPrefix(h, ":") {
+			order = append(order, h)
+		}
+	}
+	if a.UserAgent != "" {
+		order = insertByPriority(order, "user-agent")
+	}
+	return order
+}
+
+func insertByPriority(order []string, key string) []string {
+	for _, h := range order {
+		if h == key {
+			return order
+		}
+	}
+
+	p, ok := headerPriority[key]
+	if !ok {
+		return append(order, key)
+	}
+	for i, h := range order {
+		if hp, ok := headerPriority[h]; ok && hp > p {
+			order = append(order[:i], append([]string{key}, order[i:]...)...)
+			return order
+		}
+	}
+	return append(order, key)
+}
+
+func (a *Agent) Fingerprint(serverName string) (*Fingerprint, error) {
+	f := &Fingerprint{
+		UserAgent:   a.UserAgent,
+		HeaderOrder: a.wireHeaderOrder(),
+	}
+
+	var err error
+	if f.TLS, err = a.tlsFingerprint(serverName, a.alpn()); err != nil {
+		return nil, err
+	}
+
+	if a.H2Settings != nil {
+		f.HTTPVersion = "h2"
+		f.H2 = NewH2Fingerprint(orderedH2Settings(a.H2Settings), a.H2WindowUpdate, nil, a.pseudoHeaderOrder())
+	} else {
+		f.HTTPVersion = "http/1.1"
+	}
+
+	return f, nil
+}
+
+type byteReader struct {
+	b []byte
+}
+
+func (r *byteReader) u8() (uint8, bool) {
+	if len(r.b) < 1 {
+		return 0, false
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v, true
+}
+
+func (r *byteReader) u16() (uint16, bool) {
+	if len(r.b) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v, true
+}
+
+func (r *byteReader) u24() (uint32, bool) {
+	if len(r.b) < 3 {
+		return 0, false
+	}
+	v := uint32(r.b[0])<<16 | uint32(r.b[1])<<8 | uint32(r.b[2])
+	r.b = r.b[3:]
+	return v, true
+}
+
+func (r *byteReader) bytes(n int) ([]byte, bool) {
+	if len(r.b) < n {
+		return nil, false
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v, true
+}
+
+func (r *byteReader) vec8() ([]byte, bool) {
+	n, ok := r.u8()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
+
+func (r *byteReader) vec16() ([]byte, bool) {
+	n, ok := r.u16()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
@@ -0,0 +1,89 @@
+package legitagent
+
+import (
+	"strings"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestParseClientHelloMatchesAgentFingerprint(t *testing.T) {
+	for _, id := range []utls.ClientHelloID{utls.HelloChrome_120, utls.HelloFirefox_120, utls.HelloSafari_16_0} {
+		t.Run(id.Client, func(t *testing.T) {
+			raw, err := (&Agent{ClientHelloID: id}).captureClientHello("example.com", h2ALPN)
+			if err != nil {
+				t.Fatalf("Failed to capture client hello: %v", err)
+			}
+
+			parsed, err := ParseClientHello(raw)
+			if err != nil {
+				t.Fatalf("ParseClientHello failed: %v", err)
+			}
+
+			agent := &Agent{ClientHelloID: id, H2Settings: GetChromiumH2Settings()}
+			fp, err := agent.Fingerprint("example.com")
+			if err != nil {
+				t.Fatalf("Fingerprint failed: %v", err)
+			}
+
+			if parsed.JA4 != fp.TLS.JA4 {
+				t.Errorf("JA4 mismatch between wire and agent: %s != %s", parsed.JA4, fp.TLS.JA4)
+			}
+			if !strings.HasPrefix(parsed.JA4, "t13d") {
+				t.Errorf("Expected a TLS 1.3 JA4 with SNI, got %s", parsed.JA4)
+			}
+			if parsed.ServerName != "example.com" {
+				t.Errorf("Expected server name example.com, got %q", parsed.ServerName)
+			}
+			if len(parsed.JA3Hash) != 32 {
+				t.Errorf("Unexpected JA3 hash: %s", parsed.JA3Hash)
+			}
+		})
+	}
+}
+
+func TestParseClientHelloRejectsGarbage(t *testing.T) {
+	if _, err := ParseClientHello([]byte("GET / HTTP/1.1\r\n")); err == nil {
+		t.Error("Expected an error for non-TLS data")
+	}
+	if _, err := ParseClientHello([]byte{0x16, 0x03, 0x01, 0x00, 0x10, 0x01}); err == nil {
+		t.Error("Expected an error for a truncated client hello")
+	}
+}
+
+func TestClientHelloSpecFingerprint(t *testing.T) {
+	fp, err := ClientHelloSpecFingerprint(ChromeLatestSpec(), "example.com")
+	if err != nil {
+		t.Fatalf("ClientHelloSpecFingerprint failed: %v", err)
+	}
+
+	if !strings.HasPrefix(fp.JA4, "t13d1515h2_") {
+		t.Errorf("Unexpected JA4 for ChromeLatestSpec: %s", fp.JA4)
+	}
+
+	again, err := ClientHelloSpecFingerprint(ChromeLatestSpec(), "example.com")
+	if err != nil {
+		t.Fatalf("ClientHelloSpecFingerprint failed: %v", err)
+	}
+	if fp.JA4 != again.JA4 {
+		t.Errorf("JA4 should be stable across shuffled specs: %s != %s", fp.JA4, again.JA4)
+	}
+}
+
+func TestAkamaiFingerprint(t *testing.T) {
+	agent := &Agent{
+		H2Settings:     GetChromiumH2Settings(),
+		H2WindowUpdate: chromiumH2WindowUpdate,
+		HeaderOrder:    []string{":method", ":authority", ":scheme", ":path", "accept"},
+	}
+
+	fp, err := agent.Fingerprint("example.com")
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+
+	expected := "1:65536;2:0;3:1000;4:6291456;5:16384;6:262144|15663105|0|m,a,s,p"
+	if fp.H2.Akamai != expected {
+		t.Errorf("Unexpected Akamai fingerprint.\nGot:  %s\nWant: %s", fp.H2.Akamai, expected)
+	}
+}
@@ -0,0 +1,370 @@
+package legitagent
+
+import (
+	"context"
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+//go:generate go run ./cmd/legitfpdb -o data/fingerprints.json
+
+//go:embed data/fingerprints.json
+var embeddedFingerprintDB []byte
+
+const (
+	FingerprintDBVersion = 1
+
+	FingerprintSourceProfiles = "profiles"
+	FingerprintSourceStdlib   = "stdlib"
+	FingerprintSourceCapture  = "capture"
+
+	fingerprintDBServerName = "example.com"
+)
+
+var ErrFingerprintDBVersion = errors.New("legitagent: unsupported fingerprint database version")
+
+type FingerprintEntry struct {
+	Family     BrowserFamily     `json:"family"`
+	Browser    Browser           `json:"browser,omitempty"`
+	MinVersion int               `json:"min_version,omitempty"`
+	MaxVersion int               `json:"max_version,omitempty"`
+	OS         []OperatingSystem `json:"os,omitempty"`
+	JA3        string            `json:"ja3,omitempty"`
+	JA4        string            `json:"ja4"`
+	Akamai     string            `json:"akamai,omitempty"`
+	Source     string            `json:"source"`
+}
+
+type FingerprintMatch struct {
+	FingerprintEntry
+	Score           int  `json:"score"`
+	MatchJA4        bool `json:"match_ja4"`
+	MatchJA4Ciphers bool `json:"match_ja4_ciphers"`
+	MatchAkamai     bool `json:"match_akamai"`
+}
+
+type FingerprintDatabase struct {
+	Version  int                `json:"version"`
+	Revision string             `json:"revision,omitempty"`
+	Entries  []FingerprintEntry `json:"entries"`
+}
+
+var (
+	defaultFingerprintDBOnce sync.Once
+	defaultFingerprintDB     *FingerprintDatabase
+)
+
+func DefaultFingerprintDatabase() *FingerprintDatabase {
+	defaultFingerprintDBOnce.Do(func() {
+		db, err := LoadFingerprintDatabase(strings.NewReader(string(embeddedFingerprintDB)))
+		if err != nil {
+			db = &FingerprintDatabase{Version: FingerprintDBVersion}
+		}
+		defaultFingerprintDB = db
+	})
+	return defaultFingerprintDB
+}
+
+func LookupFingerprint(ja4, akamai string) []FingerprintMatch {
+	return DefaultFingerprintDatabase().Lookup(ja4, akamai)
+}
+
+func LoadFingerprintDatabase(r io.Reader) (*FingerprintDatabase, error) {
+	db := new(FingerprintDatabase)
+	if err := json.NewDecoder(r).Decode(db); err != nil {
+		return nil, fmt.Errorf("legitagent: could not decode fingerprint database: %w", err)
+	}
+	if db.Version != FingerprintDBVersion {
+		return nil, fmt.Errorf("%w: %d", ErrFingerprintDBVersion, db.Version)
+	}
+	for i, e := range db.Entries {
+		if e.Family == "" || e.JA4 == "" {
+			return nil, fmt.Errorf("legitagent: fingerprint database entry %d has no family or ja4", i)
+		}
+	}
+	return db, nil
+}
+
+func (db *FingerprintDatabase) Lookup(ja4, akamai string) []FingerprintMatch {
+	ciphers := ja4CipherSection(ja4)
+
+	var matches []FingerprintMatch
+	for _, e := range db.Entries {
+		m := FingerprintMatch{FingerprintEntry: e}
+		switch {
+		case ja4 != "" && e.JA4 == ja4:
+			m.MatchJA4 = true
+			m.Score += 2
+		case ciphers != "" && ja4CipherSection(e.JA4) == ciphers:
+			m.MatchJA4Ciphers = true
+			m.Score++
+		}
+		if akamai != "" && e.Akamai == akamai {
+			m.MatchAkamai = true
+			m.Score++
+		}
+		if m.Score > 0 {
+			matches = append(matches, m)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+func (db *FingerprintDatabase) LookupJA3(ja3 string) []FingerprintEntry {
+	normalized := normalizeJA3String(ja3)
+
+	var entries []FingerprintEntry
+	for _, e := range db.Entries {
+		if e.JA3 != "" && e.JA3 == normalized {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (db *FingerprintDatabase) tlsFamily(ja4 string) BrowserFamily {
+	var family BrowserFamily
+	for _, m := range db.Lookup(ja4, "") {
+		switch {
+		case m.MatchJA4:
+			return m.Family
+		case family == "":
+			family = m.Family
+		case family != m.Family:
+			return ""
+		}
+	}
+	return family
+}
+
+func (db *FingerprintDatabase) ImportCapture(rec CaptureRecord) error {
+	if rec.TLS == nil {
+		return errors.New("legitagent: capture has no tls client hello")
+	}
+
+	parsed, err := parseUserAgentString(rec.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	entry := FingerprintEntry{
+		Family:     parsed.Engine,
+		Browser:    parsed.Browser,
+		MinVersion: parsed.Version,
+		MaxVersion: parsed.Version,
+		OS:         []OperatingSystem{publicOS(parsed.OS)},
+		JA3:        normalizedJA3(rec.TLS),
+		JA4:        rec.TLS.JA4,
+		Source:     FingerprintSourceCapture,
+	}
+	if rec.H2 != nil {
+		entry.Akamai = rec.H2.Akamai
+	}
+
+	db.merge(entry)
+	return nil
+}
+
+func (db *FingerprintDatabase) merge(entry FingerprintEntry) {
+	for i := range db.Entries {
+		e := &db.Entries[i]
+		if e.Browser != entry.Browser || e.JA4 != entry.JA4 || e.Akamai != entry.Akamai || e.JA3 != entry.JA3 {
+			continue
+		}
+
+		e.MinVersion = min(e.MinVersion, entry.MinVersion)
+		e.MaxVersion = max(e.MaxVersion, entry.MaxVersion)
+		for _, os := range entry.OS {
+			if !containsOS(e.OS, os) {
+				e.OS = append(e.OS, os)
+			}
+		}
+		sortOS(e.OS)
+		return
+	}
+
+	db.Entries = append(db.Entries, entry)
+}
+
+func BuildFingerprintDatabase() (*FingerprintDatabase, error) {
+	db := &FingerprintDatabase{Version: FingerprintDBVersion}
+	g := NewGenerator()
+	pack := g.ProfilePack()
+
+	browsers := append([]Browser(nil), allRealBrowsers...)
+	sort.Slice(browsers, func(i, j int) bool { return browsers[i] < browsers[j] })
+
+	for _, browser := range browsers {
+		profile := pack.browsers[browser]
+
+		var oses []OperatingSystem
+		for _, c := range g.platformOSCombos(pack, browser) {
+			if isIOSVariant(pack, browser, c.os) {
+				continue
+			}
+			if os := publicOS(c.os); !containsOS(oses, os) {
+				oses = append(oses, os)
+			}
+		}
+		sortOS(oses)
+
+		versions := getVersionKeys(profile.Versions)
+		sort.Ints(versions)
+
+		for _, version := range versions {
+			vp := profile.Versions[version]
+			agent := &Agent{ClientHelloID: vp.TLS.HelloID}
+			if vp.TLS.ClientSpec != nil {
+				agent.ClientHelloSpec = vp.TLS.ClientSpec()
+			}
+			if vp.SupportsH2 {
+				agent.H2Settings = profile.H2Settings()
+			}
+
+			hello, err := agent.tlsFingerprint(fingerprintDBServerName, agent.alpn())
+			if err != nil {
+				return nil, fmt.Errorf("legitagent: %s %d: %w", browser, version, err)
+			}
+
+			entry := FingerprintEntry{
+				Family:     profile.Family,
+				Browser:    browser,
+				MinVersion: version,
+				MaxVersion: version,
+				OS:         append([]OperatingSystem(nil), oses...),
+				JA3:        normalizedJA3(hello),
+				JA4:        hello.JA4,
+				Source:     FingerprintSourceProfiles,
+			}
+			if agent.H2Settings != nil {
+				entry.Akamai = NewH2Fingerprint(orderedH2Settings(agent.H2Settings), profile.H2WindowUpdate, nil, familyPseudoHeaderOrder[profile.Family]).Akamai
+			}
+			db.merge(entry)
+		}
+	}
+
+	hello, err := stdlibClientHelloFingerprint(fingerprintDBServerName)
+	if err != nil {
+		return nil, err
+	}
+	goEntry := FingerprintEntry{Family: goTLSFamily, JA3: normalizedJA3(hello), JA4: hello.JA4, Source: FingerprintSourceStdlib}
+	if h2, err := stdlibH2Fingerprint(); err == nil {
+		goEntry.Akamai = h2.Akamai
+	}
+	db.merge(goEntry)
+
+	return db, nil
+}
+
+func publicOS(os OperatingSystem) OperatingSystem {
+	switch os {
+	case osMacIntel, osMacAppleSilicon:
+		return OSMac
+	case osUbuntu, osFedora:
+		return OSLinux
+	case osAndroidTablet:
+		return OSAndroid
+	case osIPadOS:
+		return OSiOS
+	}
+	return os
+}
+
+func containsOS(list []OperatingSystem, os OperatingSystem) bool {
+	for _, o := range list {
+		if o == os {
+			return true
+		}
+	}
+	return false
+}
+
+func sortOS(list []OperatingSystem) {
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+}
+
+func normalizeJA3String(ja3 string) string {
+	fields := strings.Split(ja3, ",")
+	if len(fields) != 5 {
+		return ja3
+	}
+
+	exts := strings.Split(fields[2], "-")
+	sort.Slice(exts, func(i, j int) bool {
+		if len(exts[i]) != len(exts[j]) {
+			return len(exts[i]) < len(exts[j])
+		}
+		return exts[i] < exts[j]
+	})
+	fields[2] = strings.Join(exts, "-")
+	return strings.Join(fields, ",")
+}
+
+func stdlibClientHelloFingerprint(serverName string) (*TLSFingerprint, error) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		conn := tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true, NextProtos: []string{"h2", "http/1.1"}})
+		_ = conn.Handshake()
+		_ = client.Close()
+	}()
+
+	raw, err := readClientHelloRecord(server)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClientHello(raw)
+}
+
+func stdlibH2Fingerprint() (*H2Fingerprint, error) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	t := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(context.Context, string, string, *tls.Config) (net.Conn, error) {
+			return client, nil
+		},
+	}
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+fingerprintDBServerName+"/", nil)
+		if resp, err := t.RoundTrip(req); err == nil {
+			_ = resp.Body.Close()
+		}
+		_ = client.Close()
+	}()
+
+	if err := server.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return nil, err
+	}
+
+	rec := newH2Recorder()
+	buf := make([]byte, 4096)
+	for len(rec.blocks) == 0 && !rec.failed {
+		n, err := server.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("legitagent: could not capture http/2 preface: %w", err)
+		}
+		rec.feed(buf[:n])
+	}
+
+	if fp := rec.fingerprint(); fp != nil {
+		return fp, nil
+	}
+	return nil, errors.New("legitagent: http/2 preface had no settings frame")
+}
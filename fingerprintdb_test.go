@@ -0,0 +1,121 @@
+package legitagent
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestDefaultFingerprintDatabase(t *testing.T) {
+	db := DefaultFingerprintDatabase()
+	if db.Version != FingerprintDBVersion || len(db.Entries) == 0 {
+		t.Fatalf("Embedded database did not load: version=%d entries=%d", db.Version, len(db.Entries))
+	}
+
+	built, err := BuildFingerprintDatabase()
+	if err != nil {
+		t.Fatalf("BuildFingerprintDatabase failed: %v", err)
+	}
+
+	profileEntries := func(db *FingerprintDatabase) []FingerprintEntry {
+		var entries []FingerprintEntry
+		for _, e := range db.Entries {
+			if e.Source == FingerprintSourceProfiles {
+				entries = append(entries, e)
+			}
+		}
+		return entries
+	}
+	if !reflect.DeepEqual(profileEntries(db), profileEntries(built)) {
+		t.Error("Embedded fingerprint database is out of date with the browser profiles, run go generate")
+	}
+}
+
+func TestLookupFingerprint(t *testing.T) {
+	for _, browser := range allRealBrowsers {
+		g := NewGenerator(WithBrowsers(browser), WithPlatforms(PlatformDesktop))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed for %s: %v", browser, err)
+		}
+
+		fp, err := agent.Fingerprint("example.com")
+		if err != nil {
+			t.Fatalf("Fingerprint failed for %s: %v", browser, err)
+		}
+		parsed, err := parseUserAgentString(agent.UserAgent)
+		if err != nil {
+			t.Fatalf("parseUserAgentString failed for %q: %v", agent.UserAgent, err)
+		}
+		g.ReleaseAgent(agent)
+
+		akamai := ""
+		if fp.H2 != nil {
+			akamai = fp.H2.Akamai
+		}
+
+		matches := LookupFingerprint(fp.TLS.JA4, akamai)
+		if len(matches) == 0 {
+			t.Fatalf("No fingerprint matches for %s (%s)", browser, fp.TLS.JA4)
+		}
+
+		found := false
+		for _, m := range matches {
+			if m.Score < matches[0].Score {
+				break
+			}
+			if m.Browser == browser && m.Family == DefaultProfilePack().browsers[browser].Family && parsed.Version >= m.MinVersion && parsed.Version <= m.MaxVersion {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected a top match for %s %d, got %+v", browser, parsed.Version, matches[0])
+		}
+	}
+
+	if matches := LookupFingerprint("t13d0000h2_000000000000_000000000000", ""); len(matches) != 0 {
+		t.Errorf("Expected no matches for an unknown fingerprint, got %d", len(matches))
+	}
+}
+
+func TestFingerprintDatabaseImportCapture(t *testing.T) {
+	db := &FingerprintDatabase{Version: FingerprintDBVersion}
+
+	ua := "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	hello, err := ClientHelloIDFingerprint(utls.HelloFirefox_120, "example.com")
+	if err != nil {
+		t.Fatalf("ClientHelloIDFingerprint failed: %v", err)
+	}
+
+	rec := CaptureRecord{Fingerprint: Fingerprint{UserAgent: ua, TLS: hello}}
+	if err := db.ImportCapture(rec); err != nil {
+		t.Fatalf("ImportCapture failed: %v", err)
+	}
+	rec.UserAgent = strings.ReplaceAll(strings.ReplaceAll(ua, "128.0", "115.0"), "X11; Linux x86_64", "Windows NT 10.0; Win64; x64")
+	if err := db.ImportCapture(rec); err != nil {
+		t.Fatalf("ImportCapture failed: %v", err)
+	}
+
+	if len(db.Entries) != 1 {
+		t.Fatalf("Expected captures to merge into one entry, got %d", len(db.Entries))
+	}
+	e := db.Entries[0]
+	if e.Family != Gecko || e.MinVersion != 115 || e.MaxVersion != 128 || len(e.OS) != 2 || e.Source != FingerprintSourceCapture {
+		t.Errorf("Unexpected merged entry: %+v", e)
+	}
+
+	if entries := db.LookupJA3(hello.JA3); len(entries) != 1 {
+		t.Errorf("Expected LookupJA3 to find the capture, got %d entries", len(entries))
+	}
+
+	if err := db.ImportCapture(CaptureRecord{Fingerprint: Fingerprint{UserAgent: ua}}); err == nil {
+		t.Error("Expected an error for a capture without a ClientHello")
+	}
+
+	if _, err := LoadFingerprintDatabase(strings.NewReader(`{"version":99,"entries":[]}`)); !errors.Is(err, ErrFingerprintDBVersion) {
+		t.Errorf("Expected ErrFingerprintDBVersion, got %v", err)
+	}
+}
@@ -3,16 +3,14 @@ module github.com/SyNdicateFoundation/legitagent
 go 1.25.0
 
 require (
-	github.com/SyNdicateFoundation/fastrand v1.0.0
 	github.com/refraction-networking/utls v1.8.0
+	golang.org/x/crypto v0.43.0
 	golang.org/x/net v0.46.0
 )
 
 require (
 	github.com/andybalholm/brotli v1.2.0 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
-	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
 )
@@ -0,0 +1,112 @@
+package legitagent
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+const (
+	h1MaxRecordedRequests = 128
+	h1MaxHeadBytes        = 64 << 10
+)
+
+var h1HeadEnd = []byte("\r\n\r\n")
+
+type h1Request struct {
+	Method      string
+	Path        string
+	HeaderOrder []string
+}
+
+type h1Recorder struct {
+	buf      []byte
+	skip     int
+	failed   bool
+	requests []h1Request
+}
+
+func (r *h1Recorder) feed(p []byte) {
+	if r.failed {
+		return
+	}
+
+	if r.skip > 0 {
+		if len(p) <= r.skip {
+			r.skip -= len(p)
+			return
+		}
+		p = p[r.skip:]
+		r.skip = 0
+	}
+	r.buf = append(r.buf, p...)
+
+	for !r.failed {
+		end := bytes.Index(r.buf, h1HeadEnd)
+		if end < 0 {
+			if len(r.buf) > h1MaxHeadBytes {
+				r.failed = true
+			}
+			break
+		}
+
+		bodyLen := r.parseHead(string(r.buf[:end]))
+		r.buf = r.buf[end+len(h1HeadEnd):]
+		if bodyLen >= len(r.buf) {
+			r.skip = bodyLen - len(r.buf)
+			r.buf = r.buf[:0]
+			break
+		}
+		r.buf = r.buf[bodyLen:]
+	}
+
+	if len(r.buf) == 0 {
+		r.buf = nil
+	}
+}
+
+func (r *h1Recorder) parseHead(head string) int {
+	lines := strings.Split(head, "\r\n")
+	parts := strings.Fields(lines[0])
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/1.") {
+		r.failed = true
+		return 0
+	}
+
+	req := h1Request{Method: parts[0], Path: parts[1]}
+	bodyLen := 0
+	chunked := false
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		req.HeaderOrder = append(req.HeaderOrder, name)
+
+		switch name {
+		case "content-length":
+			bodyLen, _ = strconv.Atoi(value)
+		case "transfer-encoding":
+			chunked = strings.Contains(strings.ToLower(value), "chunked")
+		}
+	}
+
+	if len(r.requests) < h1MaxRecordedRequests {
+		r.requests = append(r.requests, req)
+	}
+	if chunked {
+		r.failed = true
+	}
+	return max(bodyLen, 0)
+}
+
+func (r *h1Recorder) findRequest(method, path string) *h1Request {
+	for i := len(r.requests) - 1; i >= 0; i-- {
+		if req := &r.requests[i]; req.Method == method && req.Path == path {
+			return req
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package legitagent
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	h2ClientPreface     = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	h2FrameHeaderLen    = 9
+	h2MaxRecordedBlocks = 128
+)
+
+type h2HeaderBlock struct {
+	StreamID uint32
+	Fields   []hpack.HeaderField
+}
+
+type h2Recorder struct {
+	buf          []byte
+	skip         int
+	prefaceSeen  bool
+	failed       bool
+	settingsSeen bool
+	settings     []http2.Setting
+	windowUpdate uint32
+	priorities   []H2Priority
+	headersSeen  bool
+	decoder      *hpack.Decoder
+	pending      *h2HeaderBlock
+	fragment     []byte
+	blocks       []h2HeaderBlock
+}
+
+func newH2Recorder() *h2Recorder {
+	return &h2Recorder{decoder: hpack.NewDecoder(4096, nil)}
+}
+
+func (r *h2Recorder) feed(p []byte) {
+	if r.failed {
+		return
+	}
+
+	if r.skip > 0 {
+		if len(p) <= r.skip {
+			r.skip -= len(p)
+			return
+		}
+		p = p[r.skip:]
+		r.skip = 0
+	}
+	r.buf = append(r.buf, p...)
+
+	if !r.prefaceSeen {
+		if len(r.buf) < len(h2ClientPreface) {
+			if !strings.HasPrefix(h2ClientPreface, string(r.buf)) {
+				r.failed = true
+			}
+			return
+		}
+		if string(r.buf[:len(h2ClientPreface)]) != h2ClientPreface {
+			r.failed = true
+			return
+		}
+		r.prefaceSeen = true
+		r.buf = r.buf[len(h2ClientPreface):]
+	}
+
+	for len(r.buf) >= h2FrameHeaderLen && !r.failed {
+		length := int(r.buf[0])<<16 | int(r.buf[1])<<8 | int(r.buf[2])
+		frameType := http2.FrameType(r.buf[3])
+		flags := http2.Flags(r.buf[4])
+		streamID := binary.BigEndian.Uint32(r.buf[5:9]) & 0x7fffffff
+
+		if len(r.buf) < h2FrameHeaderLen+length {
+			if frameType == http2.FrameData {
+				r.skip = h2FrameHeaderLen + length - len(r.buf)
+				r.buf = r.buf[:0]
+			}
+			break
+		}
+
+		r.handleFrame(frameType, flags, streamID, r.buf[h2FrameHeaderLen:h2FrameHeaderLen+length])
+		r.buf = r.buf[h2FrameHeaderLen+length:]
+	}
+
+	if len(r.buf) == 0 {
+		r.buf = nil
+	}
+}
+
+func (r *h2Recorder) handleFrame(frameType http2.FrameType, flags http2.Flags, streamID uint32, payload []byte) {
+	switch frameType {
+	case http2.FrameSettings:
+		if flags.Has(http2.FlagSettingsAck) || r.settingsSeen {
+			return
+		}
+		r.settingsSeen = true
+		for i := 0; i+6 <= len(payload); i += 6 {
+			r.settings = append(r.settings, http2.Setting{
+				ID:  http2.SettingID(binary.BigEndian.Uint16(payload[i:])),
+				Val: binary.BigEndian.Uint32(payload[i+2:]),
+			})
+		}
+	case http2.FrameWindowUpdate:
+		if streamID == 0 && !r.headersSeen && r.windowUpdate == 0 && len(payload) >= 4 {
+			r.windowUpdate = binary.BigEndian.Uint32(payload) & 0x7fffffff
+		}
+	case http2.FramePriority:
+		if !r.headersSeen && len(payload) >= 5 {
+			r.priorities = append(r.priorities, parseH2Priority(streamID, payload))
+		}
+	case http2.FrameHeaders:
+		r.headersSeen = true
+		if flags.Has(http2.FlagHeadersPadded) {
+			if len(payload) < 1 || int(payload[0]) > len(payload)-1 {
+				r.failed = true
+				return
+			}
+			payload = payload[1 : len(payload)-int(payload[0])]
+		}
+		if flags.Has(http2.FlagHeadersPriority) {
+			if len(payload) < 5 {
+				r.failed = true
+				return
+			}
+			payload = payload[5:]
+		}
+		r.pending = &h2HeaderBlock{StreamID: streamID}
+		r.fragment = append(r.fragment[:0], payload...)
+		if flags.Has(http2.FlagHeadersEndHeaders) {
+			r.finishHeaderBlock()
+		}
+	case http2.FrameContinuation:
+		if r.pending == nil || r.pending.StreamID != streamID {
+			r.failed = true
+			return
+		}
+		r.fragment = append(r.fragment, payload...)
+		if flags.Has(http2.FlagContinuationEndHeaders) {
+			r.finishHeaderBlock()
+		}
+	}
+}
+
+func (r *h2Recorder) finishHeaderBlock() {
+	fields, err := r.decoder.DecodeFull(r.fragment)
+	if err != nil {
+		r.failed = true
+		return
+	}
+
+	r.pending.Fields = fields
+	r.blocks = append(r.blocks, *r.pending)
+	if len(r.blocks) > h2MaxRecordedBlocks {
+		r.blocks = r.blocks[len(r.blocks)-h2MaxRecordedBlocks:]
+	}
+	r.pending = nil
+	r.fragment = r.fragment[:0]
+}
+
+func parseH2Priority(streamID uint32, payload []byte) H2Priority {
+	dep := binary.BigEndian.Uint32(payload)
+	return H2Priority{
+		StreamID:  streamID,
+		Exclusive: dep&0x80000000 != 0,
+		DependsOn: dep & 0x7fffffff,
+		Weight:    payload[4],
+	}
+}
+
+func (r *h2Recorder) fingerprint() *H2Fingerprint {
+	if !r.settingsSeen {
+		return nil
+	}
+
+	var pseudo []string
+	if len(r.blocks) > 0 {
+		pseudo, _ = splitHeaderFields(r.blocks[0].Fields)
+	}
+
+	return NewH2Fingerprint(r.settings, r.windowUpdate, r.priorities, pseudo)
+}
+
+func splitHeaderFields(fields []hpack.HeaderField) (pseudo, regular []string) {
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, ":") {
+			pseudo = append(pseudo, f.Name)
+		} else {
+			regular = append(regular, f.Name)
+		}
+	}
+	return pseudo, regular
+}
+
+func headerFieldValue(fields []hpack.HeaderField, name string) string {
+	for _, f := range fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
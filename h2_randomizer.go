@@ -1,9 +1,9 @@
 package legitagent
 
 import (
-	"github.com/SyNdicateFoundation/fastrand"
 	"golang.org/x/net/http2"
 	"math"
+	"math/rand/v2"
 )
 
 func randomizeValue(base uint32, percentage float64) uint32 {
@@ -18,7 +18,7 @@ func randomizeValue(base uint32, percentage float64) uint32 {
 	}
 
 	maxX := base + delta
-	return fastrand.Number(minX, maxX)
+	return minX + rand.Uint32N(maxX-minX+1)
 }
 
 func randomizeH2Settings(baseSettings map[http2.SettingID]uint32, profile H2RandomizationProfile) map[http2.SettingID]uint32 {
@@ -44,7 +44,7 @@ func randomizeH2Settings(baseSettings map[http2.SettingID]uint32, profile H2Rand
 		randomized[http2.SettingEnablePush] = 0
 		randomized[http2.SettingInitialWindowSize] = randomizeValue(65535, 0.20)
 		randomized[http2.SettingMaxFrameSize] = randomizeValue(16384, 0.20)
-		randomized[http2.SettingMaxConcurrentStreams] = uint32(math.MaxUint32 - fastrand.IntN(1024))
+		randomized[http2.SettingMaxConcurrentStreams] = uint32(math.MaxUint32 - rand.IntN(1024))
 	default:
 	}
 
@@ -11,6 +11,7 @@ import (
 func TestH2RandomizationProfileNone(t *testing.T) {
 	g := NewGenerator(
 		WithBrowsers(BrowserChrome),
+		WithPlatforms(PlatformDesktop),
 		WithH2Randomization(H2RandomizationProfileNone),
 	)
 	agent, err := g.Generate()
@@ -28,6 +29,7 @@ func TestH2RandomizationProfileNone(t *testing.T) {
 func TestH2RandomizationProfileNormal(t *testing.T) {
 	g := NewGenerator(
 		WithBrowsers(BrowserChrome),
+		WithPlatforms(PlatformDesktop),
 		WithH2Randomization(H2RandomizationProfileNormal),
 	)
 
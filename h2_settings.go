@@ -2,6 +2,13 @@ package legitagent
 
 import "golang.org/x/net/http2"
 
+const (
+	chromiumH2WindowUpdate uint32 = 15663105
+	geckoH2WindowUpdate    uint32 = 12517377
+	webKitH2WindowUpdate   uint32 = 10485760
+	goH2WindowUpdate       uint32 = 1073741824
+)
+
 func GetChromiumH2Settings() map[http2.SettingID]uint32 {
 	return map[http2.SettingID]uint32{
 		http2.SettingHeaderTableSize:      65536,
@@ -34,3 +41,12 @@ func GetWebKitH2Settings() map[http2.SettingID]uint32 {
 		http2.SettingMaxHeaderListSize:    16384,
 	}
 }
+
+func GetGoH2Settings() map[http2.SettingID]uint32 {
+	return map[http2.SettingID]uint32{
+		http2.SettingEnablePush:        0,
+		http2.SettingInitialWindowSize: 4194304,
+		http2.SettingMaxFrameSize:      16384,
+		http2.SettingMaxHeaderListSize: 10485760,
+	}
+}
@@ -0,0 +1,212 @@
+package legitagent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var ErrNoHAREntries = errors.New("legitagent: HAR file has no requests from a supported browser")
+
+var harSkippedHeaders = map[string]bool{
+	"cookie":         true,
+	"content-length": true,
+	"user-agent":     true,
+}
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			ResourceType string `json:"_resourceType"`
+			Request      struct {
+				Method      string `json:"method"`
+				URL         string `json:"url"`
+				HTTPVersion string `json:"httpVersion"`
+				Headers     []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type HAREntry struct {
+	Method       string
+	URL          string
+	HTTPVersion  string
+	ResourceType string
+	RequestType  RequestType
+	Agent        *Agent
+}
+
+type ProfileUpdate struct {
+	Browser           Browser     `json:"browser"`
+	Version           int         `json:"version"`
+	RequestType       RequestType `json:"request_type"`
+	HTTPVersion       string      `json:"http_version"`
+	PseudoHeaderOrder []string    `json:"pseudo_header_order,omitempty"`
+	HeaderOrder       []string    `json:"header_order"`
+	Headers           [][2]string `json:"headers"`
+}
+
+func FromHAR(r io.Reader) ([]HAREntry, error) {
+	var har harFile
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("legitagent: could not decode HAR: %w", err)
+	}
+
+	var entries []HAREntry
+	for _, e := range har.Log.Entries {
+		headers := make([][2]string, 0, len(e.Request.Headers))
+		for _, h := range e.Request.Headers {
+			headers = append(headers, [2]string{strings.ToLower(h.Name), h.Value})
+		}
+
+		agent, err := agentFromHARHeaders(headers, harHTTPVersion(e.Request.HTTPVersion))
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, HAREntry{
+			Method:       e.Request.Method,
+			URL:          e.Request.URL,
+			HTTPVersion:  harHTTPVersion(e.Request.HTTPVersion),
+			ResourceType: e.ResourceType,
+			RequestType:  requestTypeFromHeaders(e.ResourceType, agent.Headers),
+			Agent:        agent,
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoHAREntries
+	}
+	return entries, nil
+}
+
+func agentFromHARHeaders(headers [][2]string, httpVersion string) (*Agent, error) {
+	agent := &Agent{Headers: make(http.Header)}
+
+	var pseudo, regular []string
+	for _, h := range headers {
+		name, value := h[0], h[1]
+		switch {
+		case strings.HasPrefix(name, ":"):
+			pseudo = append(pseudo, name)
+		case hopByHopHeaders[name], harSkippedHeaders[name]:
+			if name == "user-agent" {
+				agent.UserAgent = value
+				regular = append(regular, name)
+			}
+		default:
+			agent.Headers.Add(name, value)
+			if !containsString(regular, name) {
+				regular = append(regular, name)
+			}
+		}
+	}
+
+	info, err := ParseUserAgent(agent.UserAgent)
+	switch {
+	case err != nil:
+		return nil, err
+	case info.Browser == "":
+		return nil, ErrUnsupportedBrowser
+	}
+
+	profile := DefaultProfilePack().browsers[info.Browser]
+	versionProf, _, err := findClosestVersionProfile(profile.Versions, info.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pseudo) == 0 {
+		pseudo = familyPseudoHeaderOrder[profile.Family]
+	}
+	agent.HeaderOrder = append(append([]string(nil), pseudo...), regular...)
+	agent.ClientHelloID = versionProf.TLS.HelloID
+	if httpVersion != "http/1.1" {
+		agent.H2Settings = profile.H2Settings()
+		agent.H2WindowUpdate = profile.H2WindowUpdate
+	}
+
+	return agent, nil
+}
+
+func harHTTPVersion(v string) string {
+	switch strings.ToLower(v) {
+	case "h2", "http/2", "http/2.0":
+		return "h2"
+	case "h3", "http/3", "http/3.0":
+		return "h3"
+	}
+	return "http/1.1"
+}
+
+func requestTypeFromHeaders(resourceType string, h http.Header) RequestType {
+	switch resourceType {
+	case "document":
+		return RequestTypeNavigate
+	case "xhr", "fetch", "eventsource", "websocket":
+		return RequestTypeXHR
+	case "":
+	default:
+		return RequestTypeSubresource
+	}
+
+	switch h.Get("sec-fetch-mode") {
+	case "navigate":
+		return RequestTypeNavigate
+	case "cors", "same-origin":
+		return RequestTypeXHR
+	case "no-cors":
+		return RequestTypeSubresource
+	}
+	if strings.HasPrefix(h.Get("accept"), "text/html") {
+		return RequestTypeNavigate
+	}
+	return RequestTypeSubresource
+}
+
+func ProfileUpdatesFromHAR(entries []HAREntry) []ProfileUpdate {
+	var updates []ProfileUpdate
+	seen := make(map[string]bool)
+
+	for _, e := range entries {
+		info, err := ParseUserAgent(e.Agent.UserAgent)
+		if err != nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d/%s/%s", info.Browser, info.Version, e.RequestType, e.HTTPVersion)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		u := ProfileUpdate{
+			Browser:     info.Browser,
+			Version:     info.Version,
+			RequestType: e.RequestType,
+			HTTPVersion: e.HTTPVersion,
+		}
+		if e.HTTPVersion != "http/1.1" {
+			u.PseudoHeaderOrder = e.Agent.pseudoHeaderOrder()
+		}
+		for _, h := range e.Agent.HeaderOrder {
+			if strings.HasPrefix(h, ":") {
+				continue
+			}
+			u.HeaderOrder = append(u.HeaderOrder, h)
+			if h != "user-agent" {
+				u.Headers = append(u.Headers, [2]string{h, e.Agent.Headers.Get(h)})
+			}
+		}
+		updates = append(updates, u)
+	}
+
+	return updates
+}
@@ -0,0 +1,134 @@
+package legitagent
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+const testHAR = `{"log": {"version": "1.2", "entries": [
+	{"_resourceType": "document", "request": {"method": "GET", "url": "https://example.com/", "httpVersion": "http/2.0", "headers": [
+		{"name": ":method", "value": "GET"},
+		{"name": ":authority", "value": "example.com"},
+		{"name": ":scheme", "value": "https"},
+		{"name": ":path", "value": "/"},
+		{"name": "sec-ch-ua", "value": "\"Chromium\";v=\"124\", \"Google Chrome\";v=\"124\", \"Not-A.Brand\";v=\"99\""},
+		{"name": "sec-ch-ua-mobile", "value": "?0"},
+		{"name": "sec-ch-ua-platform", "value": "\"Windows\""},
+		{"name": "upgrade-insecure-requests", "value": "1"},
+		{"name": "user-agent", "value": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"},
+		{"name": "accept", "value": "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		{"name": "sec-fetch-site", "value": "none"},
+		{"name": "sec-fetch-mode", "value": "navigate"},
+		{"name": "sec-fetch-dest", "value": "document"},
+		{"name": "accept-encoding", "value": "gzip, deflate, br, zstd"},
+		{"name": "accept-language", "value": "en-US,en;q=0.9"},
+		{"name": "cookie", "value": "session=secret"}
+	]}},
+	{"_resourceType": "fetch", "request": {"method": "GET", "url": "https://example.com/api", "httpVersion": "h2", "headers": [
+		{"name": ":method", "value": "GET"},
+		{"name": ":authority", "value": "example.com"},
+		{"name": ":scheme", "value": "https"},
+		{"name": ":path", "value": "/api"},
+		{"name": "user-agent", "value": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"},
+		{"name": "accept", "value": "*/*"},
+		{"name": "sec-fetch-mode", "value": "cors"}
+	]}},
+	{"request": {"method": "GET", "url": "http://example.org/", "httpVersion": "HTTP/1.1", "headers": [
+		{"name": "Host", "value": "example.org"},
+		{"name": "User-Agent", "value": "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"},
+		{"name": "Accept", "value": "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		{"name": "Connection", "value": "keep-alive"},
+		{"name": "Sec-Fetch-Mode", "value": "navigate"}
+	]}},
+	{"request": {"method": "GET", "url": "https://example.com/robots.txt", "httpVersion": "h2", "headers": [
+		{"name": "user-agent", "value": "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"}
+	]}}
+]}}`
+
+func TestFromHAR(t *testing.T) {
+	entries, err := FromHAR(strings.NewReader(testHAR))
+	if err != nil {
+		t.Fatalf("FromHAR failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 browser entries, got %d", len(entries))
+	}
+
+	t.Run("Chrome Document", func(t *testing.T) {
+		e := entries[0]
+		if e.RequestType != RequestTypeNavigate || e.HTTPVersion != "h2" || e.URL != "https://example.com/" {
+			t.Errorf("Unexpected entry: %+v", e)
+		}
+
+		want := []string{":method", ":authority", ":scheme", ":path", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+			"upgrade-insecure-requests", "user-agent", "accept", "sec-fetch-site", "sec-fetch-mode", "sec-fetch-dest",
+			"accept-encoding", "accept-language"}
+		if !reflect.DeepEqual(e.Agent.HeaderOrder, want) {
+			t.Errorf("Header order mismatch:\ngot  %v\nwant %v", e.Agent.HeaderOrder, want)
+		}
+		if e.Agent.Headers.Get("cookie") != "" {
+			t.Error("Expected cookies to be dropped")
+		}
+		if e.Agent.ClientHelloID != utls.HelloChrome_120 || h2SettingsFamily(e.Agent.H2Settings) != Chromium {
+			t.Errorf("Unexpected network profile: %v %v", e.Agent.ClientHelloID, e.Agent.H2Settings)
+		}
+		if issues := Validate(e.Agent); HasErrors(issues) {
+			t.Errorf("Expected a consistent agent, got %v", issues)
+		}
+	})
+
+	t.Run("Request Types", func(t *testing.T) {
+		if entries[1].RequestType != RequestTypeXHR {
+			t.Errorf("Expected fetch entry to be xhr, got %s", entries[1].RequestType)
+		}
+		if entries[2].RequestType != RequestTypeNavigate {
+			t.Errorf("Expected sec-fetch-mode fallback to navigate, got %s", entries[2].RequestType)
+		}
+	})
+
+	t.Run("Firefox HTTP/1.1", func(t *testing.T) {
+		e := entries[2]
+		if e.HTTPVersion != "http/1.1" || e.Agent.H2Settings != nil {
+			t.Errorf("Expected an HTTP/1.1 agent, got %s %v", e.HTTPVersion, e.Agent.H2Settings)
+		}
+		if e.Agent.ClientHelloID != utls.HelloFirefox_120 {
+			t.Errorf("Expected Firefox TLS, got %v", e.Agent.ClientHelloID)
+		}
+		if e.Agent.Headers.Get("connection") != "" || e.Agent.Headers.Get("host") != "" {
+			t.Errorf("Expected hop-by-hop headers to be dropped, got %v", e.Agent.Headers)
+		}
+		if got := e.Agent.pseudoHeaderOrder(); !reflect.DeepEqual(got, familyPseudoHeaderOrder[Gecko]) {
+			t.Errorf("Expected Gecko pseudo-header order, got %v", got)
+		}
+	})
+
+	t.Run("Profile Updates", func(t *testing.T) {
+		updates := ProfileUpdatesFromHAR(append(entries, entries[0]))
+		if len(updates) != 3 {
+			t.Fatalf("Expected 3 deduplicated updates, got %d", len(updates))
+		}
+		u := updates[0]
+		if u.Browser != BrowserChrome || u.Version != 124 || u.RequestType != RequestTypeNavigate {
+			t.Errorf("Unexpected update: %+v", u)
+		}
+		if !reflect.DeepEqual(u.PseudoHeaderOrder, []string{":method", ":authority", ":scheme", ":path"}) || u.HeaderOrder[0] != "sec-ch-ua" {
+			t.Errorf("Unexpected orders: %v %v", u.PseudoHeaderOrder, u.HeaderOrder)
+		}
+		if updates[2].PseudoHeaderOrder != nil {
+			t.Errorf("Expected no pseudo-headers for HTTP/1.1, got %v", updates[2].PseudoHeaderOrder)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := FromHAR(strings.NewReader(`{"log": {"entries": []}}`)); !errors.Is(err, ErrNoHAREntries) {
+			t.Errorf("Expected ErrNoHAREntries, got %v", err)
+		}
+		if _, err := FromHAR(strings.NewReader(`not json`)); err == nil {
+			t.Error("Expected a decode error")
+		}
+	})
+}
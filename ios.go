@@ -0,0 +1,108 @@
+package legitagent
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type iosBrowserVariant struct {
+	token        string
+	versionToken bool
+	safariToken  string
+}
+
+var iosBrowserVariants = map[Browser]iosBrowserVariant{
+	BrowserChrome:  {token: "CriOS", safariToken: "604.1"},
+	BrowserEdge:    {token: "EdgiOS", versionToken: true, safariToken: "605.1.15"},
+	BrowserFirefox: {token: "FxiOS", safariToken: "605.1.15"},
+	BrowserOpera:   {token: "OPT", versionToken: true, safariToken: "604.1"},
+	BrowserBrave:   {},
+}
+
+var iosOperaVersions = []struct {
+	chromium int
+	version  string
+}{
+	{133, "5.3.0"},
+	{124, "5.1.3"},
+	{120, "5.0.1"},
+	{0, "4.5.1"},
+}
+
+func iosEdgeVersion(fullVersion string) string {
+	parts := strings.Split(fullVersion, ".")
+	if len(parts) != 4 {
+		return fullVersion
+	}
+	return strings.Join([]string{parts[0], parts[2], parts[3]}, ".")
+}
+
+func isIOSVariant(pack *ProfilePack, browser Browser, os OperatingSystem) bool {
+	if (os != OSiOS && os != osIPadOS) || browser == BrowserSafari {
+		return false
+	}
+	if _, ok := pack.browsers[BrowserSafari]; !ok {
+		return false
+	}
+	_, ok := iosBrowserVariants[browser]
+	return ok
+}
+
+func iosWebKitProfile(pack *ProfilePack, osProf OSProfile) (BrowserProfile, VersionProfile, error) {
+	safari := pack.browsers[BrowserSafari]
+	major, _, _ := strings.Cut(osProf.Version, ".")
+	v, err := strconv.Atoi(major)
+	if err != nil {
+		v = math.MaxInt
+	}
+
+	vp, _, err := findClosestVersionProfile(safari.Versions, v)
+	if err != nil {
+		if versions := getVersionKeys(safari.Versions); len(versions) > 0 {
+			sort.Ints(versions)
+			vp, err = safari.Versions[versions[0]], nil
+		}
+	}
+	return safari, vp, err
+}
+
+func iosUserAgent(browser Browser, osProf OSProfile, safariVersion VersionProfile, version int, fullVersion string, browserVersion VersionProfile) string {
+	variant := iosBrowserVariants[browser]
+	major, _, _ := strings.Cut(osProf.Version, ".")
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Mozilla/5.0 (%s) AppleWebKit/%s (KHTML, like Gecko) ", osProf.PlatformToken, safariVersion.WebKitVersion)
+
+	if variant.token == "" {
+		fmt.Fprintf(&sb, "%s %s Safari/604.1",
+			SafariVersionGenerator(BrowserProfile{}, osProf, safariVersion, ""),
+			SafariMobileTokenGenerator(BrowserProfile{}, osProf, safariVersion, ""))
+		return sb.String()
+	}
+
+	if variant.versionToken {
+		fmt.Fprintf(&sb, "Version/%s.0 ", major)
+	}
+
+	switch browser {
+	case BrowserFirefox:
+		fmt.Fprintf(&sb, "%s/%s", variant.token, browserVersion.GeckoRevision)
+	case BrowserEdge:
+		fmt.Fprintf(&sb, "%s/%s", variant.token, iosEdgeVersion(fullVersion))
+	case BrowserOpera:
+		for _, o := range iosOperaVersions {
+			if version >= o.chromium {
+				fmt.Fprintf(&sb, "%s/%s", variant.token, o.version)
+				break
+			}
+		}
+	default:
+		fmt.Fprintf(&sb, "%s/%s", variant.token, fullVersion)
+	}
+
+	fmt.Fprintf(&sb, " %s Safari/%s", SafariMobileTokenGenerator(BrowserProfile{}, osProf, safariVersion, ""), variant.safariToken)
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package legitagent
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestIOSBrowserVariants(t *testing.T) {
+	tokens := map[Browser]string{
+		BrowserChrome:  " CriOS/",
+		BrowserEdge:    " EdgiOS/",
+		BrowserFirefox: " FxiOS/",
+		BrowserOpera:   " OPT/",
+		BrowserBrave:   " Safari/604.1",
+	}
+
+	for browser, token := range tokens {
+		t.Run(string(browser), func(t *testing.T) {
+			g := NewGenerator(WithBrowsers(browser), WithOS(OSiOS), WithH2Only(true), WithValidation(ValidationReject))
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			defer g.ReleaseAgent(agent)
+
+			ua := agent.UserAgent
+			if !strings.Contains(ua, token) || !strings.Contains(ua, "AppleWebKit/605.1.15") || strings.Contains(ua, "Chrome/") || strings.Contains(ua, "Firefox/") {
+				t.Errorf("Expected a WebKit iOS UA with %q, got %q", token, ua)
+			}
+			if agent.ClientHints != nil || agent.Headers.Get("sec-ch-ua") != "" {
+				t.Errorf("iOS browsers must not send client hints, got %v", agent.Headers)
+			}
+			if family := clientHelloFamily(agent); family != WebKit {
+				t.Errorf("Expected a WebKit ClientHello, got %s", family)
+			}
+			if family := h2SettingsFamily(agent.H2Settings); family != WebKit {
+				t.Errorf("Expected WebKit HTTP/2 SETTINGS, got %s", family)
+			}
+			if issues := Validate(agent); HasErrors(issues) {
+				t.Errorf("Unexpected validation issues: %v", issues)
+			}
+		})
+	}
+
+	t.Run("Edge Version", func(t *testing.T) {
+		if got := iosEdgeVersion("124.0.2478.71"); got != "124.2478.71" {
+			t.Errorf("Expected EdgiOS/124.2478.71, got EdgiOS/%s", got)
+		}
+
+		g := NewGenerator(WithBrowsers(BrowserEdge), WithOS(OSiOS))
+		for range 20 {
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if !regexp.MustCompile(`EdgiOS/1\d\d\.\d{4}\.\d+ Mobile/`).MatchString(agent.UserAgent) {
+				t.Errorf("Expected a three-part EdgiOS version, got %q", agent.UserAgent)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+
+	t.Run("Parse", func(t *testing.T) {
+		ua := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 EdgiOS/128.2739.60 Mobile/15E148 Safari/605.1.15"
+		info, err := ParseUserAgent(ua)
+		if err != nil {
+			t.Fatalf("ParseUserAgent failed: %v", err)
+		}
+		if info.Browser != BrowserEdge || info.Engine != WebKit || info.Version != 128 || info.OS != OSiOS {
+			t.Errorf("Unexpected parse of an EdgiOS UA: %+v", info)
+		}
+
+		g := NewGenerator()
+		agent, err := g.FromUserAgent(ua, RequestTypeNavigate)
+		if err != nil {
+			t.Fatalf("FromUserAgent failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		if agent.ClientHints != nil || clientHelloFamily(agent) != WebKit {
+			t.Errorf("Expected a WebKit agent without client hints, got %v %v", agent.ClientHelloID, agent.ClientHints)
+		}
+
+		static, err := FromUserAgentString(ua, RequestTypeNavigate)
+		if err != nil {
+			t.Fatalf("FromUserAgentString failed: %v", err)
+		}
+		if h2SettingsFamily(static.H2Settings) != WebKit || static.Headers.Get("sec-ch-ua") != "" {
+			t.Errorf("Expected a WebKit static agent, got %v %v", static.H2Settings, static.Headers)
+		}
+	})
+}
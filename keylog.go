@@ -0,0 +1,327 @@
+package legitagent
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	tlsRecordHandshake = 22
+	tlsRecordCCS       = 20
+	tlsRecordAppData   = 23
+)
+
+var tls13HelloRetryRandom = [32]byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+type tlsKeyLog map[[32]byte]map[string][]byte
+
+func (k tlsKeyLog) parse(data []byte) {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		random, err := hex.DecodeString(fields[1])
+		if err != nil || len(random) != 32 {
+			continue
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			continue
+		}
+
+		key := [32]byte(random)
+		if k[key] == nil {
+			k[key] = make(map[string][]byte)
+		}
+		k[key][fields[0]] = secret
+	}
+}
+
+type tlsRecord struct {
+	header  []byte
+	payload []byte
+}
+
+func (r tlsRecord) contentType() byte {
+	return r.header[0]
+}
+
+func splitTLSRecords(data []byte) []tlsRecord {
+	var records []tlsRecord
+	for len(data) >= 5 {
+		n := int(binary.BigEndian.Uint16(data[3:]))
+		if len(data) < 5+n {
+			break
+		}
+		records = append(records, tlsRecord{header: data[:5], payload: data[5 : 5+n]})
+		data = data[5+n:]
+	}
+	return records
+}
+
+func tlsHandshakeMessages(records []tlsRecord, msgType byte) [][]byte {
+	var buf []byte
+	for _, r := range records {
+		if r.contentType() == tlsRecordCCS {
+			continue
+		}
+		if r.contentType() != tlsRecordHandshake {
+			break
+		}
+		buf = append(buf, r.payload...)
+	}
+
+	var messages [][]byte
+	for len(buf) >= 4 {
+		n := int(buf[1])<<16 | int(buf[2])<<8 | int(buf[3])
+		if len(buf) < 4+n {
+			break
+		}
+		if buf[0] == msgType {
+			messages = append(messages, buf[4:4+n])
+		}
+		buf = buf[4+n:]
+	}
+	return messages
+}
+
+type tlsServerHello struct {
+	version uint16
+	random  [32]byte
+	suite   uint16
+}
+
+func parseServerHello(records []tlsRecord) (tlsServerHello, bool) {
+	for _, body := range tlsHandshakeMessages(records, 2) {
+		if len(body) < 35 {
+			continue
+		}
+		sh := tlsServerHello{version: binary.BigEndian.Uint16(body), random: [32]byte(body[2:34])}
+		if sh.random == tls13HelloRetryRandom {
+			continue
+		}
+
+		p := body[34:]
+		sid := int(p[0])
+		if len(p) < 1+sid+3 {
+			continue
+		}
+		p = p[1+sid:]
+		sh.suite = binary.BigEndian.Uint16(p)
+		p = p[3:]
+
+		if len(p) >= 2 {
+			exts := p[2:min(len(p), 2+int(binary.BigEndian.Uint16(p)))]
+			for len(exts) >= 4 {
+				typ, n := binary.BigEndian.Uint16(exts), int(binary.BigEndian.Uint16(exts[2:]))
+				if len(exts) < 4+n {
+					break
+				}
+				if typ == 0x002b && n == 2 {
+					sh.version = binary.BigEndian.Uint16(exts[4:])
+				}
+				exts = exts[4+n:]
+			}
+		}
+		return sh, true
+	}
+	return tlsServerHello{}, false
+}
+
+func decryptTLSClientStream(client, server []byte, keys tlsKeyLog) []byte {
+	records := splitTLSRecords(client)
+	hellos := tlsHandshakeMessages(records, 1)
+	if len(hellos) == 0 || len(hellos[0]) < 34 {
+		return nil
+	}
+	clientRandom := [32]byte(hellos[0][2:34])
+	secrets := keys[clientRandom]
+	if secrets == nil {
+		return nil
+	}
+
+	sh, ok := parseServerHello(splitTLSRecords(server))
+	if !ok {
+		return nil
+	}
+	if sh.version == tls.VersionTLS13 {
+		return decryptTLS13Records(records, sh.suite, secrets["CLIENT_TRAFFIC_SECRET_0"])
+	}
+	return decryptTLS12Records(records, sh, clientRandom, secrets["CLIENT_RANDOM"])
+}
+
+func decryptTLS13Records(records []tlsRecord, suite uint16, secret []byte) []byte {
+	var h func() hash.Hash
+	keyLen := 32
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		h, keyLen = sha256.New, 16
+	case tls.TLS_AES_256_GCM_SHA384:
+		h = sha512.New384
+	case tls.TLS_CHACHA20_POLY1305_SHA256:
+		h = sha256.New
+	default:
+		return nil
+	}
+	if len(secret) != h().Size() {
+		return nil
+	}
+
+	aead, err := newTLSAEAD(suite == tls.TLS_CHACHA20_POLY1305_SHA256, hkdfExpandLabel(h, secret, "key", keyLen))
+	if err != nil {
+		return nil
+	}
+	iv := hkdfExpandLabel(h, secret, "iv", aead.NonceSize())
+
+	var plain []byte
+	var seq uint64
+	for _, r := range records {
+		if r.contentType() != tlsRecordAppData {
+			continue
+		}
+		out, err := aead.Open(nil, tlsNonce(iv, seq), r.payload, r.header)
+		if err != nil {
+			if seq > 0 {
+				break
+			}
+			continue
+		}
+		seq++
+
+		out = bytes.TrimRight(out, "\x00")
+		if len(out) > 0 && out[len(out)-1] == tlsRecordAppData {
+			plain = append(plain, out[:len(out)-1]...)
+		}
+	}
+	return plain
+}
+
+func decryptTLS12Records(records []tlsRecord, sh tlsServerHello, clientRandom [32]byte, master []byte) []byte {
+	var h func() hash.Hash
+	var keyLen, ivLen int
+	switch sh.suite {
+	case tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_GCM_SHA256:
+		h, keyLen, ivLen = sha256.New, 16, 4
+	case tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_RSA_WITH_AES_256_GCM_SHA384:
+		h, keyLen, ivLen = sha512.New384, 32, 4
+	case tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256:
+		h, keyLen, ivLen = sha256.New, 32, 12
+	default:
+		return nil
+	}
+	if len(master) != 48 {
+		return nil
+	}
+
+	block := tls12PRF(h, master, "key expansion", append(sh.random[:], clientRandom[:]...), 2*keyLen+2*ivLen)
+	aead, err := newTLSAEAD(ivLen == 12, block[:keyLen])
+	if err != nil {
+		return nil
+	}
+	iv := block[2*keyLen : 2*keyLen+ivLen]
+
+	var plain []byte
+	var seq uint64
+	encrypted := false
+	for _, r := range records {
+		if r.contentType() == tlsRecordCCS {
+			encrypted = true
+			continue
+		}
+		if !encrypted {
+			continue
+		}
+
+		var nonce []byte
+		payload := r.payload
+		if ivLen == 4 {
+			if len(payload) < 8 {
+				break
+			}
+			nonce = append(bytes.Clone(iv), payload[:8]...)
+			payload = payload[8:]
+		} else {
+			nonce = tlsNonce(iv, seq)
+		}
+		if len(payload) < aead.Overhead() {
+			break
+		}
+
+		ad := make([]byte, 13)
+		binary.BigEndian.PutUint64(ad, seq)
+		copy(ad[8:], r.header[:3])
+		binary.BigEndian.PutUint16(ad[11:], uint16(len(payload)-aead.Overhead()))
+
+		out, err := aead.Open(nil, nonce, payload, ad)
+		if err != nil {
+			break
+		}
+		seq++
+		if r.contentType() == tlsRecordAppData {
+			plain = append(plain, out...)
+		}
+	}
+	return plain
+}
+
+func newTLSAEAD(chacha bool, key []byte) (cipher.AEAD, error) {
+	if chacha {
+		return chacha20poly1305.New(key)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func tlsNonce(iv []byte, seq uint64) []byte {
+	nonce := bytes.Clone(iv)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+	}
+	return nonce
+}
+
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, n int) []byte {
+	info := []byte{byte(n >> 8), byte(n), byte(len("tls13 ") + len(label))}
+	info = append(info, "tls13 "+label...)
+	info = append(info, 0)
+	out, _ := hkdf.Expand(h, secret, string(info), n)
+	return out
+}
+
+func tls12PRF(h func() hash.Hash, secret []byte, label string, seed []byte, n int) []byte {
+	seed = append([]byte(label), seed...)
+	mac := hmac.New(h, secret)
+
+	var out []byte
+	a := seed
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+	}
+	return out[:n]
+}
@@ -2,12 +2,13 @@ package legitagent
 
 import (
 	"fmt"
+	"math/rand/v2"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
-	"github.com/SyNdicateFoundation/fastrand"
 	utls "github.com/refraction-networking/utls"
 	"golang.org/x/net/http2"
 )
@@ -19,6 +20,10 @@ type Agent struct {
 	ClientHelloSpec *utls.ClientHelloSpec
 	ClientHelloID   utls.ClientHelloID
 	H2Settings      map[http2.SettingID]uint32
+	H2WindowUpdate  uint32
+	ClientHints     *ClientHints
+	Device          *Device
+	Network         *Network
 }
 
 type Generator struct {
@@ -31,6 +36,8 @@ type Generator struct {
 	requestType            RequestType
 	headerSorter           HeaderSorter
 	fullFingerprint        bool
+	uaReduction            bool
+	networkProfiles        []NetworkProfile
 	h2Only                 bool
 	fingerprintProfile     FingerprintProfile
 	h2RandomizationProfile H2RandomizationProfile
@@ -40,6 +47,9 @@ type Generator struct {
 	acceptEnabled          bool
 	agentPool              sync.Pool
 	zeroHeader             bool
+	validationMode         ValidationMode
+	profilePack            atomic.Pointer[ProfilePack]
+	profilePackErr         error
 }
 
 var allRealOS = []OperatingSystem{
@@ -64,6 +74,11 @@ var allRealBrowsers = []Browser{
 var allRealPlatforms = []Platform{
 	PlatformDesktop,
 	PlatformMobile,
+	PlatformTablet,
+}
+var tabletOSes = map[OperatingSystem]OperatingSystem{
+	OSAndroid: osAndroidTablet,
+	OSiOS:     osIPadOS,
 }
 var macArchitectures = []OperatingSystem{
 	osMacIntel,
@@ -100,12 +115,11 @@ func NewGenerator(opts ...Option) *Generator {
 		browsers:               []Browser{BrowserRandom},
 		platforms:              []Platform{PlatformRandom},
 		os:                     []OperatingSystem{OSRandom},
-		minVersion:             114,
-		maxVersion:             141,
 		languageProfiles:       defaultLanguages,
 		requestType:            RequestTypeNavigate,
 		headerSorter:           PriorityHeaderSorter,
 		fullFingerprint:        false,
+		uaReduction:            true,
 		h2Only:                 true,
 		fingerprintProfile:     FingerprintProfileNormal,
 		h2RandomizationProfile: H2RandomizationProfileNone,
@@ -127,26 +141,70 @@ func NewGenerator(opts ...Option) *Generator {
 }
 
 func (g *Generator) Generate() (*Agent, error) {
+	if g.validationMode == ValidationOff {
+		return g.generate()
+	}
+
+	attempts := 1
+	if g.validationMode == ValidationRegenerate {
+		attempts = maxValidationAttempts
+	}
+
+	var issues []Issue
+	for i := 0; i < attempts; i++ {
+		agent, err := g.generate()
+		if err != nil {
+			return nil, err
+		}
+
+		issues = Validate(agent)
+		if !HasErrors(issues) {
+			return agent, nil
+		}
+		g.ReleaseAgent(agent)
+	}
+
+	return nil, &ValidationError{Issues: issues}
+}
+
+func (g *Generator) SetProfilePack(p *ProfilePack) {
+	g.profilePack.Store(p)
+}
+
+func (g *Generator) ProfilePack() *ProfilePack {
+	if p := g.profilePack.Load(); p != nil {
+		return p.withRegistry()
+	}
+	return DefaultProfilePack()
+}
+
+func (g *Generator) generate() (*Agent, error) {
+	if g.profilePackErr != nil {
+		return nil, g.profilePackErr
+	}
+	pack := g.ProfilePack()
+
 	agent := g.agentPool.Get().(*Agent)
 	agent.Headers = make(http.Header)
 
 	if g.useBotAgents {
 		var eligibleBots []botProfile
 		if len(g.botAgentTypes) == 0 {
-			eligibleBots = allBotProfiles
+			eligibleBots = pack.allBots
 		} else {
 			for _, botName := range g.botAgentTypes {
-				if profiles, ok := botProfileCategories[botName]; ok {
+				if profiles, ok := pack.botCategories[botName]; ok {
 					eligibleBots = append(eligibleBots, profiles...)
 				}
 			}
 		}
 
 		if len(eligibleBots) == 0 {
+			g.ReleaseAgent(agent)
 			return nil, fmt.Errorf("legitagent: no bot profiles found for the specified types: %v", g.botAgentTypes)
 		}
 
-		chosenProfile := fastrand.Choice(eligibleBots)
+		chosenProfile := randomChoice(eligibleBots)
 
 		agent.UserAgent = chosenProfile.UserAgent
 		agent.ClientHelloID = chosenProfile.HelloID
@@ -164,37 +222,39 @@ func (g *Generator) Generate() (*Agent, error) {
 
 		if g.h2Only {
 			agent.H2Settings = GetChromiumH2Settings()
+			agent.H2WindowUpdate = chromiumH2WindowUpdate
 		} else {
 			agent.H2Settings = nil
+			agent.H2WindowUpdate = 0
 		}
 
 		return agent, nil
 	}
 
-	browser, err := g.resolveBrowser()
+	browser, err := g.resolveBrowser(pack)
 	if err != nil {
 		g.ReleaseAgent(agent)
 		return nil, err
 	}
 
-	profile := browserProfiles[browser]
+	profile := pack.browsers[browser]
 
-	chosenPlatform, chosenOS, err := g.resolvePlatformAndOS(browser)
+	chosenPlatform, chosenOS, err := g.resolvePlatformAndOS(pack, browser)
 	if err != nil {
 		g.ReleaseAgent(agent)
 		return nil, err
 	}
 
-	platformProf := platformProfiles[chosenPlatform]
-	osProf := osProfiles[chosenOS]
+	platformProf, _ := pack.platform(chosenPlatform)
+	osProf := pack.os[chosenOS]
 
 	allVersions := getVersionKeys(profile.Versions)
 	var possibleVersions []int
 
-	if g.minVersion != 114 || g.maxVersion != 141 {
+	if g.minVersion > 0 || g.maxVersion > 0 {
 		possibleVersions = make([]int, 0, len(allVersions))
 		for _, v := range allVersions {
-			if v >= g.minVersion && v <= g.maxVersion {
+			if v >= g.minVersion && (g.maxVersion == 0 || v <= g.maxVersion) {
 				possibleVersions = append(possibleVersions, v)
 			}
 		}
@@ -214,18 +274,62 @@ func (g *Generator) Generate() (*Agent, error) {
 		finalVersions = possibleVersions
 	}
 
+	if len(osProf.Versions) > 0 {
+		compatible := make([]int, 0, len(finalVersions))
+		for _, v := range finalVersions {
+			if osProf.supports(browser, v, profile.Versions[v].Released) {
+				compatible = append(compatible, v)
+			}
+		}
+		finalVersions = compatible
+	}
+
 	if len(finalVersions) == 0 {
+		g.ReleaseAgent(agent)
 		return nil, fmt.Errorf("legitagent: no available browser versions for %s that meet the specified criteria", browser)
 	}
 
-	version := fastrand.Choice(finalVersions)
+	version := randomChoice(finalVersions)
 	versionProf := profile.Versions[version]
+	osProf = osProf.pickVersion(browser, version, versionProf.Released, "")
 
 	fullVersion := ""
 	if profile.ChromiumBased {
-		fullVersion = fmt.Sprintf("%d.0.%d.%d", version, versionProf.BuildNumber, fastrand.IntN(999))
+		fullVersion = fmt.Sprintf("%d.0.%d.%d", version, versionProf.BuildNumber, rand.IntN(999))
+	}
+
+	device := pack.pickDevice(chosenPlatform, chosenOS, "")
+	if device != nil && device.Model != "" {
+		osProf.PlatformToken = strings.Replace(osProf.PlatformToken, "{device_model}", device.Model, 1)
+	}
+	if device != nil && device.AndroidVersion > 0 {
+		osProf.PlatformToken = strings.Replace(osProf.PlatformToken, "{android_version}", strconv.Itoa(device.AndroidVersion), 1)
+		osProf.Version = device.platformVersion()
+	}
+
+	if isIOSVariant(pack, browser, chosenOS) {
+		safari, safariVersion, err := iosWebKitProfile(pack, osProf)
+		if err != nil {
+			g.ReleaseAgent(agent)
+			return nil, err
+		}
+		agent.UserAgent = iosUserAgent(browser, osProf, safariVersion, version, fullVersion, versionProf)
+		g.fillAgent(agent, safari, osProf, platformProf, version, "", device, safariVersion, g.requestType)
+		return agent, nil
 	}
 
+	if token, ok := reducedPlatformTokens[chosenOS]; ok && g.uaReduction && profile.ChromiumBased && version >= uaReductionMinVersion {
+		agent.UserAgent = reducedUserAgent(profile, token, platformProf.MobileHint == "?1", version, version)
+	} else {
+		agent.UserAgent = buildUserAgent(profile, osProf, platformProf, versionProf, fullVersion)
+	}
+
+	g.fillAgent(agent, profile, osProf, platformProf, version, fullVersion, device, versionProf, g.requestType)
+
+	return agent, nil
+}
+
+func buildUserAgent(profile BrowserProfile, osProf OSProfile, platformProf PlatformProfile, versionProf VersionProfile, fullVersion string) string {
 	sb := builderPool.Get().(*strings.Builder)
 	defer func() {
 		sb.Reset()
@@ -246,23 +350,46 @@ func (g *Generator) Generate() (*Agent, error) {
 		}
 	}
 
-	agent.UserAgent = sb.String()
+	return sb.String()
+}
 
+func (g *Generator) fillAgent(agent *Agent, profile BrowserProfile, osProf OSProfile, platformProf PlatformProfile, version int, fullVersion string, device *Device, versionProf VersionProfile, requestType RequestType) {
 	headerSorter := g.headerSorter
 
 	if g.fingerprintProfile == FingerprintProfileMaximum {
 		headerSorter = ShuffledPriorityHeaderSorter
 	}
 
+	var hints map[string]string
+	if profile.ChromiumBased {
+		hints = buildClientHints(profile, osProf, platformProf, version, fullVersion, versionProf.chromiumFullVersion(fullVersion), device)
+	}
+
+	agent.Device = device
+
+	agent.Network = nil
+	if len(g.networkProfiles) > 0 && osProf.IsMobile {
+		agent.Network = newNetwork(randomChoice(g.networkProfiles))
+		if hints != nil {
+			for k, v := range agent.Network.clientHints() {
+				hints[k] = v
+			}
+		}
+	}
+
+	agent.ClientHints = nil
+	if hints != nil {
+		agent.ClientHints = NewClientHints(hints)
+	}
+
 	if !g.zeroHeader {
 		agent.Headers, agent.HeaderOrder = g.buildHeaders(
 			profile,
-			osProf,
 			platformProf,
-			version,
-			fullVersion,
+			hints,
 			versionProf,
 			headerSorter,
+			requestType,
 		)
 	} else {
 		agent.Headers = nil
@@ -271,22 +398,29 @@ func (g *Generator) Generate() (*Agent, error) {
 
 	if g.h2Only {
 		agent.H2Settings = profile.H2Settings()
+		agent.H2WindowUpdate = profile.H2WindowUpdate
 		if g.h2RandomizationProfile != H2RandomizationProfileNone {
 			agent.H2Settings = randomizeH2Settings(agent.H2Settings, g.h2RandomizationProfile)
 		}
 	} else {
 		agent.H2Settings = nil
+		agent.H2WindowUpdate = 0
 	}
 
+	var spec *utls.ClientHelloSpec
 	if g.fingerprintProfile == FingerprintProfileMaximum {
-		agent.ClientHelloSpec = ChromeLatestSpec()
+		spec = maximumClientHelloSpec(profile.Family, versionProf.TLS)
+	}
+	if spec != nil {
+		agent.ClientHelloSpec = spec
 		agent.ClientHelloID = utls.ClientHelloID{}
 	} else {
 		agent.ClientHelloID = versionProf.TLS.HelloID
 		agent.ClientHelloSpec = nil
+		if versionProf.TLS.ClientSpec != nil {
+			agent.ClientHelloSpec = versionProf.TLS.ClientSpec()
+		}
 	}
-
-	return agent, nil
 }
 
 func (g *Generator) ReleaseAgent(a *Agent) {
@@ -303,10 +437,14 @@ func (g *Generator) ReleaseAgent(a *Agent) {
 	a.ClientHelloSpec = nil
 	a.ClientHelloID = utls.ClientHelloID{}
 	a.H2Settings = nil
+	a.H2WindowUpdate = 0
+	a.ClientHints = nil
+	a.Device = nil
+	a.Network = nil
 	g.agentPool.Put(a)
 }
 
-func (g *Generator) resolveBrowser() (Browser, error) {
+func (g *Generator) resolveBrowser(pack *ProfilePack) (Browser, error) {
 	var potentialBrowsers []Browser
 	hasRandom := false
 
@@ -317,7 +455,7 @@ func (g *Generator) resolveBrowser() (Browser, error) {
 		}
 	}
 	if hasRandom {
-		potentialBrowsers = allRealBrowsers
+		potentialBrowsers = pack.browserList
 	} else {
 		potentialBrowsers = g.browsers
 	}
@@ -326,28 +464,44 @@ func (g *Generator) resolveBrowser() (Browser, error) {
 		return "", fmt.Errorf("legitagent: no browsers configured for generation")
 	}
 
-	return fastrand.Choice(potentialBrowsers), nil
+	return randomChoice(potentialBrowsers), nil
+}
+
+type platformOSCombo struct {
+	platform Platform
+	os       OperatingSystem
 }
 
-func (g *Generator) resolvePlatformAndOS(browser Browser) (Platform, OperatingSystem, error) {
-	type combo struct {
-		platform Platform
-		os       OperatingSystem
+func (g *Generator) resolvePlatformAndOS(pack *ProfilePack, browser Browser) (Platform, OperatingSystem, error) {
+	validCombos := g.platformOSCombos(pack, browser)
+	if len(validCombos) == 0 {
+		return "", "", fmt.Errorf("no compatible platform/OS combination found for browser %s with the current settings", browser)
 	}
 
-	validCombos := make([]combo, 0, len(allRealPlatforms)*len(allRealOS))
+	chosenCombo := randomChoice(validCombos)
+
+	return chosenCombo.platform, chosenCombo.os, nil
+}
 
+func (g *Generator) platformOSCombos(pack *ProfilePack, browser Browser) []platformOSCombo {
 	userPlatforms := g.platforms
 	if len(userPlatforms) == 1 && userPlatforms[0] == PlatformRandom {
-		userPlatforms = allRealPlatforms
+		userPlatforms = pack.platformNames()
 	}
+	validCombos := make([]platformOSCombo, 0, len(userPlatforms)*len(pack.osList))
 
 	userOSes := g.os
 	if len(userOSes) == 1 && userOSes[0] == OSRandom {
-		userOSes = allRealOS
+		userOSes = pack.osList
 	}
 
+	family := pack.browsers[browser].Family
 	for _, p := range userPlatforms {
+		platformProf, ok := pack.platform(p)
+		if !ok || len(platformProf.ComponentGenerators[family]) == 0 {
+			continue
+		}
+		mobile := platformProf.MobileHint == "?1"
 		for _, o := range userOSes {
 			var concreteOSes []OperatingSystem
 
@@ -356,61 +510,54 @@ func (g *Generator) resolvePlatformAndOS(browser Browser) (Platform, OperatingSy
 			} else {
 				concreteOSes = append(concreteOSes, o)
 			}
+			if tablet, ok := tabletOSes[o]; ok && !containsOS(userOSes, tablet) {
+				concreteOSes = append(concreteOSes, tablet)
+			}
 
 			for _, concreteOS := range concreteOSes {
-				osProfile, osProfileExists := osProfiles[concreteOS]
+				osProf, osProfileExists := pack.os[concreteOS]
 				if !osProfileExists {
 					continue
 				}
 
-				if (p == PlatformMobile) != osProfile.IsMobile {
+				if platformProf.IsTablet != osProf.IsTablet || (!osProf.IsTablet && mobile != osProf.IsMobile) {
 					continue
 				}
 
 				isValidForBrowser := false
-				switch browser {
-				case BrowserSafari:
-					if (p == PlatformMobile && concreteOS == OSiOS) || (p == PlatformDesktop && osProfile.Name == "macOS") {
-						isValidForBrowser = true
-					}
-				case BrowserFirefox:
-					if (p == PlatformMobile && concreteOS == OSAndroid) || (p == PlatformDesktop && concreteOS != OSiOS && concreteOS != OSAndroid) {
+				switch family {
+				case WebKit:
+					if concreteOS == OSiOS || concreteOS == osIPadOS || osProf.Name == "macOS" {
 						isValidForBrowser = true
 					}
 				default:
-					isValidForBrowser = true
+					isValidForBrowser = (concreteOS != OSiOS && concreteOS != osIPadOS) || isIOSVariant(pack, browser, concreteOS)
 				}
 
 				if isValidForBrowser {
-					validCombos = append(validCombos, combo{p, concreteOS})
+					validCombos = append(validCombos, platformOSCombo{p, concreteOS})
 				}
 			}
 		}
 	}
 
-	if len(validCombos) == 0 {
-		return "", "", fmt.Errorf("no compatible platform/OS combination found for browser %s with the current settings", browser)
-	}
-
-	chosenCombo := fastrand.Choice(validCombos)
-
-	return chosenCombo.platform, chosenCombo.os, nil
+	return validCombos
 }
 
-func (g *Generator) buildHeaders(browser browserProfile, os osProfile, platform platformProfile, version int, fullVersion string, versionProf versionProfile, sorter HeaderSorter) (http.Header, []string) {
+func (g *Generator) buildHeaders(browser BrowserProfile, platform PlatformProfile, hints map[string]string, versionProf VersionProfile, sorter HeaderSorter, requestType RequestType) (http.Header, []string) {
 	headerMap := make(map[string]string, 16)
 
 	var acceptTemplate [][]AcceptHeaderPart
-	if g.requestType == RequestTypeXHR {
+	if requestType == RequestTypeXHR {
 		acceptTemplate = versionProf.AcceptHeaderPatternsXHR
 	} else {
 		acceptTemplate = versionProf.AcceptHeaderPatterns
 	}
 
-	languageTemplate := fastrand.Choice(g.languageProfiles)
+	languageTemplate := randomChoice(g.languageProfiles)
 
 	if g.acceptEnabled {
-		headerMap["accept"] = buildAcceptHeader(fastrand.Choice(acceptTemplate))
+		headerMap["accept"] = buildAcceptHeader(randomChoice(acceptTemplate))
 	}
 	if g.acceptEncodingEnabled {
 		headerMap["accept-encoding"] = generateAcceptEncoding()
@@ -418,40 +565,33 @@ func (g *Generator) buildHeaders(browser browserProfile, os osProfile, platform
 
 	headerMap["accept-language"] = buildAcceptHeader(languageTemplate)
 
-	if browser.ChromiumBased {
-		headerMap["sec-ch-ua"] = buildSecChUa(browser.Brand, strconv.Itoa(version), false, true)
-		headerMap["sec-ch-ua-mobile"] = platform.MobileHint
-		headerMap["sec-ch-ua-platform"] = fmt.Sprintf(`"%s"`, os.Name)
+	if hints != nil {
+		for _, k := range lowEntropyClientHints {
+			headerMap[k] = hints[k]
+		}
 
 		if g.fullFingerprint {
-			headerMap["sec-ch-ua-full-version-list"] = buildSecChUa(browser.Brand, fullVersion, true, true)
-			if os.Version != "" {
-				headerMap["sec-ch-ua-platform-version"] = fmt.Sprintf(`"%s"`, os.Version)
-			}
-
-			if os.Arch != "" {
-				headerMap["sec-ch-ua-arch"] = fmt.Sprintf(`"%s"`, os.Arch)
-			}
-
-			if os.BitnessHint != "" {
-				headerMap["sec-ch-ua-bitness"] = fmt.Sprintf(`"%s"`, os.BitnessHint)
+			for _, k := range highEntropyClientHints {
+				if v, ok := hints[k]; ok {
+					headerMap[k] = v
+				}
 			}
 		}
 	}
 
 	if g.fingerprintProfile == FingerprintProfileExtreme {
 		for k := range headerMap {
-			if strings.HasPrefix(k, "sec-") && fastrand.Bool() {
+			if strings.HasPrefix(k, "sec-") && rand.IntN(2) == 0 {
 				delete(headerMap, k)
 			}
 		}
 	}
 
-	if g.requestType == RequestTypeNavigate && browser.Brand == "Brave" {
+	if requestType == RequestTypeNavigate && browser.Brand == "Brave" {
 		headerMap["sec-gpc"] = "1"
 	}
 
-	switch g.requestType {
+	switch requestType {
 	case RequestTypeNavigate:
 		headerMap["sec-fetch-dest"] = "document"
 		headerMap["sec-fetch-mode"] = "navigate"
@@ -459,7 +599,7 @@ func (g *Generator) buildHeaders(browser browserProfile, os osProfile, platform
 		headerMap["sec-fetch-user"] = "?1"
 		headerMap["upgrade-insecure-requests"] = "1"
 	case RequestTypeSubresource:
-		headerMap["sec-fetch-dest"] = fastrand.Choice(subresourceDests)
+		headerMap["sec-fetch-dest"] = randomChoice(subresourceDests)
 		headerMap["sec-fetch-mode"] = "no-cors"
 		headerMap["sec-fetch-site"] = "same-origin"
 	case RequestTypeXHR:
@@ -475,7 +615,7 @@ func (g *Generator) buildHeaders(browser browserProfile, os osProfile, platform
 	}
 
 	sorter(keys)
-	orderedKeys := append([]string{":method", ":authority", ":scheme", ":path"}, keys...)
+	orderedKeys := append(append([]string(nil), familyPseudoHeaderOrder[browser.Family]...), keys...)
 
 	for _, k := range keys {
 		header.Set(k, headerMap[k])
@@ -484,53 +624,41 @@ func (g *Generator) buildHeaders(browser browserProfile, os osProfile, platform
 	return header, orderedKeys
 }
 
-func buildSecChUa(brand, version string, isFull, randomize bool) string {
-	var greaseBrand string
-	if randomize {
-		greaseBrand = fastrand.Choice(greaseBrands)
-	} else {
-		greaseBrand = `"Not/A)Brand";v="8"`
-	}
+func buildSecChUa(brand, brandVersion, chromiumVersion string, isFull bool) string {
+	major, _, _ := strings.Cut(chromiumVersion, ".")
+	seed, _ := strconv.Atoi(major)
 
-	parts := strings.SplitN(greaseBrand, `;v=`, 2)
-	greaseKey := parts[0]
-	var greaseVersion string
+	greaseBrand := "Not" + greaseBrandChars[seed%len(greaseBrandChars)] + "A" + greaseBrandChars[(seed+1)%len(greaseBrandChars)] + "Brand"
+	greaseVersion := greaseBrandVersions[seed%len(greaseBrandVersions)]
 	if isFull {
-		greaseVersion = `"99.0.0.0"`
+		greaseVersion += ".0.0.0"
 	} else {
-		greaseVersion = parts[1]
+		brandVersion, _, _ = strings.Cut(brandVersion, ".")
+		chromiumVersion = major
 	}
 
-	v := version
-	if !isFull {
-		if maj := strings.Split(version, "."); len(maj) > 0 {
-			v = maj[0]
-		}
+	brands := [3]string{
+		fmt.Sprintf(`"%s";v="%s"`, greaseBrand, greaseVersion),
+		fmt.Sprintf(`"Chromium";v="%s"`, chromiumVersion),
+		fmt.Sprintf(`"%s";v="%s"`, brand, brandVersion),
 	}
 
-	brands := make([]string, 0, 3)
-	brands = append(
-		brands,
-		fmt.Sprintf(`"Chromium";v="%s"`, v),
-		fmt.Sprintf(`"%s";v="%s"`, brand, v),
-		fmt.Sprintf(`%s;v=%s`, greaseKey, greaseVersion),
-	)
-
-	if randomize {
-		fastrand.Shuffle(len(brands), func(i, j int) { brands[i], brands[j] = brands[j], brands[i] })
+	var shuffled [3]string
+	for i, pos := range brandListOrders[seed%len(brandListOrders)] {
+		shuffled[pos] = brands[i]
 	}
 
-	return strings.Join(brands, ", ")
+	return strings.Join(shuffled[:], ", ")
 }
 
 func generateAcceptEncoding() string {
 	encodings := []string{"gzip", "deflate", "br"}
 
-	fastrand.Shuffle(len(encodings), func(i, j int) {
+	rand.Shuffle(len(encodings), func(i, j int) {
 		encodings[i], encodings[j] = encodings[j], encodings[i]
 	})
 
-	if fastrand.IntN(2) == 1 {
+	if rand.IntN(2) == 1 {
 		return strings.Join(encodings, ", ") + ", zstd"
 	}
 
@@ -559,7 +687,7 @@ func buildAcceptHeader(parts []AcceptHeaderPart) string {
 		}
 
 		if part.Q > 0 {
-			currentQ -= fastrand.Float64() * 0.1
+			currentQ -= rand.Float64() * 0.1
 			if currentQ < 0.1 {
 				currentQ = 0.1
 			}
@@ -570,7 +698,7 @@ func buildAcceptHeader(parts []AcceptHeaderPart) string {
 	return sb.String()
 }
 
-func getVersionKeys(m map[int]versionProfile) []int {
+func getVersionKeys(m map[int]VersionProfile) []int {
 	keys := make([]int, 0, len(m))
 	for k := range m {
 		keys = append(keys, k)
@@ -12,15 +12,19 @@ func TestBrowserSpecificGeneration(t *testing.T) {
 			WithVersionRange(140, 140),
 			WithOS(OSWindows11),
 			WithPlatforms(PlatformDesktop),
+			WithFullFingerprint(true),
 		)
 
 		agent, err := g.Generate()
 		if err != nil {
 			t.Fatalf("Generate failed: %v", err)
 		}
-		if !strings.Contains(agent.UserAgent, "Chrome/140.0.7255") {
+		if !strings.Contains(agent.UserAgent, "Chrome/140.0.0.0") {
 			t.Errorf("Expected Chrome 140 UA, got: %s", agent.UserAgent)
 		}
+		if !strings.Contains(agent.Headers.Get("sec-ch-ua-full-version-list"), `v="140.0.7255.`) {
+			t.Errorf("Expected the Chrome 140 build in sec-ch-ua-full-version-list, got: %s", agent.Headers.Get("sec-ch-ua-full-version-list"))
+		}
 	})
 
 	t.Run("Firefox", func(t *testing.T) {
@@ -46,6 +50,7 @@ func TestBrowserSpecificGeneration(t *testing.T) {
 			WithBrowsers(BrowserFirefox),
 			WithVersionRange(127, 127),
 			WithPlatforms(PlatformMobile),
+			WithOS(OSAndroid),
 		)
 
 		agent, err := g.Generate()
@@ -126,6 +131,79 @@ func TestFullFingerprintOption(t *testing.T) {
 	})
 }
 
+func TestUserAgentReductionOption(t *testing.T) {
+	t.Run("Reduced Android (Default)", func(t *testing.T) {
+		g := NewGenerator(
+			WithBrowsers(BrowserEdge),
+			WithOS(OSAndroid),
+			WithPlatforms(PlatformMobile),
+			WithVersionRange(128, 128),
+			WithFullFingerprint(true),
+		)
+
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+
+		want := "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/128.0.0.0 Mobile Safari/537.36 Edg/128.0.0.0"
+		if agent.UserAgent != want {
+			t.Errorf("Expected reduced UA %q, got %q", want, agent.UserAgent)
+		}
+		if model := agent.Headers.Get("sec-ch-ua-model"); model == "" || model == `"K"` {
+			t.Errorf("Expected the device model in sec-ch-ua-model, got %q", model)
+		}
+		if !strings.Contains(agent.Headers.Get("sec-ch-ua-full-version-list"), `v="128.0.2739.`) {
+			t.Errorf("Expected the real build in sec-ch-ua-full-version-list, got %q", agent.Headers.Get("sec-ch-ua-full-version-list"))
+		}
+		if issues := Validate(agent); HasErrors(issues) {
+			t.Errorf("Expected a consistent agent, got %v", issues)
+		}
+
+		info, err := ParseUserAgent(agent.UserAgent)
+		if err != nil || info.DeviceModel != "" || info.Version != 128 {
+			t.Errorf("Unexpected parse of the reduced UA: %+v (%v)", info, err)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		g := NewGenerator(
+			WithBrowsers(BrowserChrome),
+			WithOS(OSWindows11),
+			WithPlatforms(PlatformDesktop),
+			WithVersionRange(140, 140),
+			WithUserAgentReduction(false),
+		)
+
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if !strings.Contains(agent.UserAgent, "Chrome/140.0.7255.") {
+			t.Errorf("Expected the full build in the UA, got %q", agent.UserAgent)
+		}
+	})
+}
+
+func TestBuildSecChUa(t *testing.T) {
+	cases := []struct {
+		brand, version, chromium string
+		full                     bool
+		want                     string
+	}{
+		{"Google Chrome", "124", "124", false, `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+		{"Google Chrome", "128", "128", false, `"Chromium";v="128", "Not;A=Brand";v="24", "Google Chrome";v="128"`},
+		{"Google Chrome", "131.0.6778.86", "131.0.6778.86", true, `"Google Chrome";v="131.0.6778.86", "Chromium";v="131.0.6778.86", "Not_A Brand";v="24.0.0.0"`},
+		{"Microsoft Edge", "120", "120", false, `"Not_A Brand";v="8", "Chromium";v="120", "Microsoft Edge";v="120"`},
+		{"Microsoft Edge", "128.0.2739.79", "128.0.6636.79", true, `"Chromium";v="128.0.6636.79", "Not;A=Brand";v="24.0.0.0", "Microsoft Edge";v="128.0.2739.79"`},
+	}
+	for _, c := range cases {
+		if got := buildSecChUa(c.brand, c.version, c.chromium, c.full); got != c.want {
+			t.Errorf("buildSecChUa(%q, %q, %q, %v):\ngot  %s\nwant %s", c.brand, c.version, c.chromium, c.full, got, c.want)
+		}
+	}
+}
+
 func TestRandomOptions(t *testing.T) {
 	t.Run("OSRandom", func(t *testing.T) {
 		g := NewGenerator(
@@ -186,7 +264,7 @@ func TestRandomOptions(t *testing.T) {
 
 		platforms := make(map[string]bool)
 
-		for i := 0; i < 50; i++ {
+		for i := 0; i < 200; i++ {
 			agent, err := g.Generate()
 			if err != nil {
 				t.Fatalf("Generate failed: %v", err)
@@ -0,0 +1,139 @@
+package legitagent
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+func FromHTTPRequest(r *http.Request, capturedHello []byte) (*Agent, error) {
+	agent := &Agent{UserAgent: r.UserAgent(), Headers: make(http.Header, len(r.Header))}
+	for k, v := range r.Header {
+		if lk := strings.ToLower(k); hopByHopHeaders[lk] || lk == "user-agent" || lk == "content-length" {
+			continue
+		}
+		agent.Headers[k] = append([]string(nil), v...)
+	}
+
+	var profile BrowserProfile
+	var versionProf VersionProfile
+	known := false
+	if info, err := ParseUserAgent(agent.UserAgent); err == nil && info.Browser != "" {
+		profile = DefaultProfilePack().browsers[info.Browser]
+		if vp, _, err := findClosestVersionProfile(profile.Versions, info.Version); err == nil {
+			versionProf, known = vp, true
+		}
+	}
+
+	cc, _ := r.Context().Value(captureContextKey).(*consistencyConn)
+	if len(capturedHello) == 0 && cc != nil {
+		capturedHello = cc.ClientHello()
+	}
+
+	switch {
+	case len(capturedHello) > 0:
+		spec, err := clientHelloSpecFromRaw(capturedHello)
+		if err != nil {
+			return nil, err
+		}
+		agent.ClientHelloSpec = spec
+	case known:
+		agent.ClientHelloID = versionProf.TLS.HelloID
+	default:
+		return nil, fmt.Errorf("%w: no ClientHello was captured for %q", ErrUnsupportedBrowser, agent.UserAgent)
+	}
+
+	var pseudo, regular []string
+	if cc != nil && r.ProtoMajor == 2 {
+		cc.mu.Lock()
+		if cc.h2 != nil {
+			if fp := cc.h2.fingerprint(); fp != nil {
+				agent.H2Settings = make(map[http2.SettingID]uint32, len(fp.Settings))
+				for _, s := range fp.Settings {
+					agent.H2Settings[s.ID] = s.Val
+				}
+				agent.H2WindowUpdate = fp.WindowUpdate
+			}
+			if block := cc.h2.findBlock(r.Method, r.URL.RequestURI()); block != nil {
+				pseudo, regular = splitHeaderFields(block.Fields)
+			}
+		}
+		cc.mu.Unlock()
+	}
+	if cc != nil && r.ProtoMajor == 1 {
+		cc.mu.Lock()
+		if cc.h1 != nil {
+			if req := cc.h1.findRequest(r.Method, r.RequestURI); req != nil {
+				regular = append([]string(nil), req.HeaderOrder...)
+			}
+		}
+		cc.mu.Unlock()
+	}
+
+	if agent.H2Settings == nil && r.ProtoMajor == 2 && known {
+		agent.H2Settings = profile.H2Settings()
+		agent.H2WindowUpdate = profile.H2WindowUpdate
+	}
+
+	if len(regular) > 0 {
+		kept := make([]string, 0, len(regular))
+		for _, h := range regular {
+			if h == "user-agent" || agent.Headers.Get(h) != "" {
+				kept = append(kept, h)
+			}
+		}
+		regular = kept
+	} else {
+		for k := range agent.Headers {
+			regular = append(regular, strings.ToLower(k))
+		}
+		PriorityHeaderSorter(regular)
+	}
+
+	if len(pseudo) == 0 {
+		pseudo = familyPseudoHeaderOrder[Chromium]
+		if known {
+			pseudo = familyPseudoHeaderOrder[profile.Family]
+		}
+	}
+	agent.HeaderOrder = append(append([]string(nil), pseudo...), regular...)
+
+	return agent, nil
+}
+
+func clientHelloSpecFromRaw(data []byte) (*utls.ClientHelloSpec, error) {
+	msg, err := clientHelloMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, 5, 5+len(msg))
+	record[0] = 0x16
+	binary.BigEndian.PutUint16(record[1:3], 0x0301)
+	binary.BigEndian.PutUint16(record[3:5], uint16(len(msg)))
+	record = append(record, msg...)
+
+	spec, err := (&utls.Fingerprinter{}).RawClientHello(record)
+	if err != nil {
+		return nil, fmt.Errorf("legitagent: could not build spec from ClientHello: %w", err)
+	}
+
+	for _, ext := range spec.Extensions {
+		if _, ok := ext.(*utls.SNIExtension); ok {
+			return spec, nil
+		}
+	}
+
+	i := 0
+	if len(spec.Extensions) > 0 {
+		if _, ok := spec.Extensions[0].(*utls.UtlsGREASEExtension); ok {
+			i = 1
+		}
+	}
+	spec.Extensions = append(spec.Extensions[:i], append([]utls.TLSExtension{&utls.SNIExtension{}}, spec.Extensions[i:]...)...)
+	return spec, nil
+}
@@ -0,0 +1,113 @@
+package legitagent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestFromHTTPRequest(t *testing.T) {
+	url := startCaptureServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent, err := FromHTTPRequest(r, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fp, err := agent.Fingerprint("example.com")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(fp)
+	}))
+
+	for _, browser := range []Browser{BrowserChrome, BrowserFirefox, BrowserSafari} {
+		t.Run(string(browser), func(t *testing.T) {
+			g := NewGenerator(WithBrowsers(browser), WithPlatforms(PlatformDesktop), WithOS(OSMac))
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			defer g.ReleaseAgent(agent)
+
+			want, err := agent.Fingerprint("example.com")
+			if err != nil {
+				t.Fatalf("Fingerprint failed: %v", err)
+			}
+
+			resp, err := (&http.Client{Transport: &Transport{Agent: agent, InsecureSkipVerify: true}}).Get(url)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Mirror failed with status %d", resp.StatusCode)
+			}
+
+			got := new(Fingerprint)
+			if err := json.NewDecoder(resp.Body).Decode(got); err != nil {
+				t.Fatalf("Failed to decode fingerprint: %v", err)
+			}
+
+			if got.TLS.JA4 != want.TLS.JA4 {
+				t.Errorf("JA4 mismatch: got %s, want %s", got.TLS.JA4, want.TLS.JA4)
+			}
+			if got.H2 == nil || got.H2.Akamai != want.H2.Akamai {
+				t.Errorf("Akamai mismatch: got %+v, want %s", got.H2, want.H2.Akamai)
+			}
+			if g, w := strings.Join(got.HeaderOrder, ","), strings.Join(want.HeaderOrder, ","); g != w {
+				t.Errorf("Header order mismatch:\n got: %s\nwant: %s", g, w)
+			}
+			if got.UserAgent != agent.UserAgent {
+				t.Errorf("Expected user agent %q, got %q", agent.UserAgent, got.UserAgent)
+			}
+		})
+	}
+
+	t.Run("Explicit ClientHello", func(t *testing.T) {
+		source := &Agent{ClientHelloID: utls.HelloFirefox_120, H2Settings: GetGeckoH2Settings()}
+		raw, err := source.captureClientHello("example.com", source.alpn())
+		if err != nil {
+			t.Fatalf("captureClientHello failed: %v", err)
+		}
+		want, err := ParseClientHello(raw)
+		if err != nil {
+			t.Fatalf("ParseClientHello failed: %v", err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		r.ProtoMajor, r.ProtoMinor = 2, 0
+		r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+		r.Header.Set("Accept", "*/*")
+		r.Header.Set("Connection", "keep-alive")
+
+		agent, err := FromHTTPRequest(r, raw)
+		if err != nil {
+			t.Fatalf("FromHTTPRequest failed: %v", err)
+		}
+		got, err := agent.tlsFingerprint("example.com", agent.alpn())
+		if err != nil {
+			t.Fatalf("tlsFingerprint failed: %v", err)
+		}
+		if got.JA4 != want.JA4 {
+			t.Errorf("JA4 mismatch: got %s, want %s", got.JA4, want.JA4)
+		}
+		if h2SettingsFamily(agent.H2Settings) != Gecko || agent.Headers.Get("Connection") != "" || agent.Headers.Get("Accept") != "*/*" {
+			t.Errorf("Unexpected mirrored agent: %+v", agent)
+		}
+		if issues := Validate(agent); HasErrors(issues) {
+			t.Errorf("Expected a consistent mirrored agent, got %v", issues)
+		}
+
+		r.Header.Set("User-Agent", "curl/8.4.0")
+
+		if _, err := FromHTTPRequest(r, nil); !errors.Is(err, ErrUnsupportedBrowser) {
+			t.Errorf("Expected ErrUnsupportedBrowser without a ClientHello, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package legitagent
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+)
+
+const (
+	maxNetworkRTT      = 3000
+	maxNetworkDownlink = 10
+)
+
+type Network struct {
+	Profile  NetworkProfile `json:"profile"`
+	ECT      string         `json:"ect"`
+	RTT      int            `json:"rtt"`
+	Downlink float64        `json:"downlink"`
+	SaveData bool           `json:"save_data,omitempty"`
+}
+
+type networkConditions struct {
+	ect      string
+	rtt      [2]int
+	downlink [2]float64
+	saveData int
+}
+
+var networkConditionsByProfile = map[NetworkProfile]networkConditions{
+	NetworkWiFi: {ect: "4g", rtt: [2]int{20, 100}, downlink: [2]float64{5, 50}},
+	Network4G:   {ect: "4g", rtt: [2]int{50, 250}, downlink: [2]float64{2, 20}, saveData: 5},
+	Network3G:   {ect: "3g", rtt: [2]int{300, 900}, downlink: [2]float64{0.4, 1.6}, saveData: 20},
+}
+
+func newNetwork(profile NetworkProfile) *Network {
+	c, ok := networkConditionsByProfile[profile]
+	if !ok {
+		return nil
+	}
+
+	rtt := c.rtt[0] + rand.IntN(c.rtt[1]-c.rtt[0]+1)
+	downlink := c.downlink[0] + rand.Float64()*(c.downlink[1]-c.downlink[0])
+
+	return &Network{
+		Profile:  profile,
+		ECT:      c.ect,
+		RTT:      roundNetworkRTT(rtt),
+		Downlink: roundNetworkDownlink(downlink),
+		SaveData: c.saveData > 0 && rand.IntN(100) < c.saveData,
+	}
+}
+
+func roundNetworkRTT(ms int) int {
+	rounded := int(math.Round(float64(ms)/50) * 50)
+	return min(rounded, maxNetworkRTT)
+}
+
+func roundNetworkDownlink(mbps float64) float64 {
+	rounded := math.Round(mbps*40) / 40
+	return min(rounded, maxNetworkDownlink)
+}
+
+func (n *Network) clientHints() map[string]string {
+	hints := map[string]string{
+		"ect":      n.ECT,
+		"rtt":      strconv.Itoa(n.RTT),
+		"downlink": strconv.FormatFloat(n.Downlink, 'f', -1, 64),
+	}
+	if n.SaveData {
+		hints["save-data"] = "on"
+	}
+	return hints
+}
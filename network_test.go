@@ -0,0 +1,56 @@
+package legitagent
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestNetworkProfiles(t *testing.T) {
+	g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSAndroid), WithPlatforms(PlatformMobile), WithNetworkProfiles(Network3G, "5g"))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	n := agent.Network
+	if n == nil || n.Profile != Network3G || n.ECT != "3g" {
+		t.Fatalf("Expected a 3g network, got %+v", n)
+	}
+	if n.RTT%50 != 0 || n.RTT < 300 || n.RTT > 900 || n.Downlink < 0.4 || n.Downlink > 1.6 {
+		t.Errorf("Network conditions out of range: %+v", n)
+	}
+	if agent.Headers.Get("rtt") != "" || agent.Headers.Get("ect") != "" {
+		t.Error("Expected network hints not to be sent unsolicited")
+	}
+
+	h := http.Header{}
+	h.Set("Accept-CH", "ECT, RTT, Downlink")
+	agent.ClientHints.Record("https://example.com", h)
+	sent := agent.ClientHints.Header("https://example.com")
+	if sent.Get("ect") != "3g" || sent.Get("rtt") != strconv.Itoa(n.RTT) || sent.Get("downlink") != strconv.FormatFloat(n.Downlink, 'f', -1, 64) {
+		t.Errorf("Unexpected network hints after Accept-CH: %v", sent)
+	}
+
+	desktop, err := NewGenerator(WithBrowsers(BrowserChrome), WithPlatforms(PlatformDesktop), WithNetworkProfiles(NetworkWiFi)).Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if desktop.Network != nil {
+		t.Errorf("Expected no network profile on desktop, got %+v", desktop.Network)
+	}
+}
+
+func TestNetworkRounding(t *testing.T) {
+	for in, want := range map[int]int{0: 0, 24: 0, 26: 50, 174: 150, 175: 200, 5000: 3000} {
+		if got := roundNetworkRTT(in); got != want {
+			t.Errorf("roundNetworkRTT(%d) = %d, want %d", in, got, want)
+		}
+	}
+	for in, want := range map[float64]float64{0.01: 0, 1.4375: 1.45, 1.43: 1.425, 9.99: 10, 42: 10} {
+		if got := roundNetworkDownlink(in); got != want {
+			t.Errorf("roundNetworkDownlink(%v) = %v, want %v", in, got, want)
+		}
+	}
+}
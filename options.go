@@ -1,6 +1,7 @@
 package legitagent
 
 import (
+	"io/fs"
 	"strconv"
 	"strings"
 )
@@ -23,6 +24,7 @@ const (
 	PlatformRandom  Platform = "random"
 	PlatformDesktop Platform = "desktop"
 	PlatformMobile  Platform = "mobile"
+	PlatformTablet  Platform = "tablet"
 )
 
 type OperatingSystem string
@@ -40,6 +42,16 @@ const (
 	osMacAppleSilicon OperatingSystem = "mac_apple_silicon"
 	osUbuntu          OperatingSystem = "ubuntu"
 	osFedora          OperatingSystem = "fedora"
+	osAndroidTablet   OperatingSystem = "android_tablet"
+	osIPadOS          OperatingSystem = "ipados"
+)
+
+type NetworkProfile string
+
+const (
+	NetworkWiFi NetworkProfile = "wifi"
+	Network4G   NetworkProfile = "4g"
+	Network3G   NetworkProfile = "3g"
 )
 
 type RequestType string
@@ -193,3 +205,38 @@ func WithZeroHeader(enabled bool) Option {
 		g.zeroHeader = enabled
 	}
 }
+
+func WithProfilePack(fsys fs.FS) Option {
+	return func(g *Generator) {
+		pack, err := LoadProfilePack(fsys)
+		if err != nil {
+			g.profilePackErr = err
+			return
+		}
+		g.profilePackErr = nil
+		g.profilePack.Store(pack)
+	}
+}
+
+func WithValidation(mode ValidationMode) Option {
+	return func(g *Generator) {
+		g.validationMode = mode
+	}
+}
+
+func WithUserAgentReduction(enabled bool) Option {
+	return func(g *Generator) {
+		g.uaReduction = enabled
+	}
+}
+
+func WithNetworkProfiles(profiles ...NetworkProfile) Option {
+	return func(g *Generator) {
+		g.networkProfiles = nil
+		for _, p := range profiles {
+			if _, ok := networkConditionsByProfile[p]; ok {
+				g.networkProfiles = append(g.networkProfiles, p)
+			}
+		}
+	}
+}
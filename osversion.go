@@ -0,0 +1,83 @@
+package legitagent
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type OSVersion struct {
+	Version  string
+	Token    string
+	Released time.Time
+	Browsers map[Browser][2]int
+}
+
+func (v OSVersion) supports(browser Browser, version int) bool {
+	r, ok := v.Browsers[browser]
+	if !ok {
+		return true
+	}
+	return version >= r[0] && (r[1] == 0 || version <= r[1])
+}
+
+const osVersionWindow = 4 * 365 * 24 * time.Hour
+
+func (o OSProfile) compatibleVersions(browser Browser, version int, released time.Time) []OSVersion {
+	var versions, dated []OSVersion
+	for _, v := range o.Versions {
+		if _, ok := v.Browsers[browser]; ok || released.IsZero() {
+			if v.supports(browser, version) {
+				versions = append(versions, v)
+			}
+			continue
+		}
+		dated = append(dated, v)
+	}
+	if len(dated) == 0 {
+		return versions
+	}
+
+	sort.SliceStable(dated, func(i, j int) bool { return dated[i].Released.Before(dated[j].Released) })
+	newest := -1
+	for i, v := range dated {
+		if !v.Released.After(released) {
+			newest = i
+		}
+	}
+	if newest == -1 {
+		return append(versions, dated[0])
+	}
+
+	cutoff := released.Add(-osVersionWindow)
+	for i, v := range dated[:newest+1] {
+		if i == newest || !v.Released.Before(cutoff) {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+func (o OSProfile) supports(browser Browser, version int, released time.Time) bool {
+	return len(o.Versions) == 0 || len(o.compatibleVersions(browser, version, released)) > 0
+}
+
+func (o OSProfile) pickVersion(browser Browser, version int, released time.Time, hint string) OSProfile {
+	candidates := o.compatibleVersions(browser, version, released)
+	if len(candidates) == 0 {
+		return o
+	}
+
+	for _, v := range candidates {
+		if hint != "" && v.Version == hint {
+			return o.withVersion(v)
+		}
+	}
+	return o.withVersion(randomChoice(candidates))
+}
+
+func (o OSProfile) withVersion(v OSVersion) OSProfile {
+	o.PlatformToken = strings.Replace(o.PlatformToken, "{os_version}", v.Token, 1)
+	o.Version = v.Version
+	return o
+}
@@ -0,0 +1,114 @@
+package legitagent
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOSVersions(t *testing.T) {
+	t.Run("Compatibility", func(t *testing.T) {
+		for _, v := range DefaultProfilePack().os[osMacIntel].compatibleVersions(BrowserSafari, 17, time.Time{}) {
+			if !strings.HasPrefix(v.Version, "13.") && !strings.HasPrefix(v.Version, "14.") {
+				t.Errorf("Safari 17 should not run on macOS %s", v.Version)
+			}
+		}
+		if len(DefaultProfilePack().os[osMacIntel].compatibleVersions(BrowserChrome, 140, time.Time{})) != len(DefaultProfilePack().OSVersions(osMacIntel)) {
+			t.Error("Expected Chrome to run on every macOS version")
+		}
+	})
+
+	t.Run("Release Dates", func(t *testing.T) {
+		pack := DefaultProfilePack()
+		for _, browser := range []Browser{BrowserChrome, BrowserEdge, BrowserFirefox} {
+			for version, vp := range pack.browsers[browser].Versions {
+				for _, os := range []OperatingSystem{OSWindows, OSWindows11, osMacIntel} {
+					for _, v := range pack.os[os].compatibleVersions(browser, version, vp.Released) {
+						if v.Released.After(vp.Released) {
+							t.Errorf("%s %d (%s) paired with %s %s released %s", browser, version, vp.Released.Format(time.DateOnly), os, v.Version, v.Released.Format(time.DateOnly))
+						}
+					}
+				}
+			}
+		}
+
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSWindows11), WithVersionRange(114, 114), WithFullFingerprint(true))
+		for i := 0; i < 20; i++ {
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if got := agent.ClientHints.Values["sec-ch-ua-platform-version"]; got == `"19.0.0"` {
+				t.Errorf("Chrome 114 should not run on Windows 11 24H2, got %s", got)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+
+	t.Run("iOS Safari", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserSafari), WithOS(OSiOS), WithPlatforms(PlatformMobile))
+		for i := 0; i < 20; i++ {
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			ua := agent.UserAgent
+			start := strings.Index(ua, "iPhone OS ") + len("iPhone OS ")
+			parts := strings.Split(ua[start:strings.Index(ua, " like Mac")], "_")
+			if want := "Version/" + parts[0] + "." + parts[1] + " "; !strings.Contains(ua, want) {
+				t.Errorf("Expected the Safari version to track iOS with %q, got %q", want, ua)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+
+	t.Run("ChromeOS", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSChromeOS), WithVersionRange(120, 120), WithUserAgentReduction(false), WithFullFingerprint(true))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		if !strings.Contains(agent.UserAgent, "CrOS x86_64 15662.64.0)") {
+			t.Errorf("Expected the ChromeOS 120 build in the UA, got %q", agent.UserAgent)
+		}
+		if got := agent.ClientHints.Values["sec-ch-ua-platform-version"]; got != `"15662.64.0"` {
+			t.Errorf("Expected sec-ch-ua-platform-version \"15662.64.0\", got %s", got)
+		}
+
+		for _, browser := range []Browser{BrowserEdge, BrowserOpera, BrowserBrave} {
+			g := NewGenerator(WithBrowsers(browser), WithOS(OSChromeOS), WithVersionRange(120, 120), WithUserAgentReduction(false))
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate %s failed: %v", browser, err)
+			}
+			if !strings.Contains(agent.UserAgent, "CrOS x86_64 15662.64.0)") {
+				t.Errorf("Expected the ChromeOS 120 build in the %s UA, got %q", browser, agent.UserAgent)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+
+	t.Run("Windows", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSWindows11), WithFullFingerprint(true))
+		seen := make(map[string]bool)
+		for i := 0; i < 50; i++ {
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			seen[agent.ClientHints.Values["sec-ch-ua-platform-version"]] = true
+			g.ReleaseAgent(agent)
+		}
+		for v := range seen {
+			if v != `"14.0.0"` && v != `"15.0.0"` && v != `"19.0.0"` {
+				t.Errorf("Unexpected Windows 11 platform version %s", v)
+			}
+		}
+		if len(seen) < 2 {
+			t.Errorf("Expected the Windows 11 platform version to vary, got %v", seen)
+		}
+	})
+}
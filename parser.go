@@ -5,11 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
-
-	utls "github.com/refraction-networking/utls"
 )
 
 var (
@@ -20,141 +17,304 @@ var (
 	uaRegexes = []struct {
 		Browser Browser
 		Regex   *regexp.Regexp
+		Engine  BrowserFamily
 	}{
-		{BrowserSafari, regexp.MustCompile(`Version/(\d+)\..*Safari/`)},
-		{BrowserEdge, regexp.MustCompile(`Edg/(\d+)\.\d+`)},
-		{BrowserOpera, regexp.MustCompile(`OPR/(\d+)\.\d+`)},
-		{BrowserBrave, regexp.MustCompile(`Brave/(\d+)\.\d+`)},
-		{BrowserChrome, regexp.MustCompile(`Chrome/(\d+)\.\d+`)},
-		{BrowserFirefox, regexp.MustCompile(`Firefox/(\d+)\.\d+`)},
+		{BrowserChrome, regexp.MustCompile(`CriOS/(\d+(?:\.\d+)*)`), WebKit},
+		{BrowserEdge, regexp.MustCompile(`EdgiOS/(\d+(?:\.\d+)*)`), WebKit},
+		{BrowserFirefox, regexp.MustCompile(`FxiOS/(\d+(?:\.\d+)*)`), WebKit},
+		{BrowserOpera, regexp.MustCompile(`OPT/(\d+(?:\.\d+)*)`), WebKit},
+		{BrowserEdge, regexp.MustCompile(`Edg/(\d+(?:\.\d+)*)`), ""},
+		{BrowserOpera, regexp.MustCompile(`OPR/(\d+(?:\.\d+)*)`), ""},
+		{BrowserBrave, regexp.MustCompile(`Brave/(\d+(?:\.\d+)*)`), ""},
+		{BrowserChrome, regexp.MustCompile(`Chrome/(\d+(?:\.\d+)*)`), ""},
+		{BrowserFirefox, regexp.MustCompile(`Firefox/(\d+(?:\.\d+)*)`), ""},
+		{BrowserSafari, regexp.MustCompile(`Version/(\d+(?:\.\d+)*).*Safari/`), ""},
 	}
+
+	windowsVersionRegex  = regexp.MustCompile(`Windows NT (\d+\.\d+)`)
+	androidVersionRegex  = regexp.MustCompile(`Android (\d+(?:\.\d+)*)`)
+	appleVersionRegex    = regexp.MustCompile(`(?:iPhone OS|CPU OS|Mac OS X) (\d+(?:[_.]\d+)*)`)
+	chromeOSVersionRegex = regexp.MustCompile(`CrOS \S+ (\d+(?:\.\d+)*)`)
 )
 
-var parserStableChromeProfiles = map[int]utls.ClientHelloID{
-	120: utls.HelloChrome_120,
-	131: utls.HelloChrome_131,
-	133: utls.HelloChrome_133,
+type UserAgentInfo struct {
+	UserAgent   string          `json:"user_agent"`
+	Browser     Browser         `json:"browser,omitempty"`
+	Engine      BrowserFamily   `json:"engine,omitempty"`
+	Version     int             `json:"version,omitempty"`
+	FullVersion string          `json:"full_version,omitempty"`
+	OS          OperatingSystem `json:"os,omitempty"`
+	OSVersion   string          `json:"os_version,omitempty"`
+	DeviceModel string          `json:"device_model,omitempty"`
+	Platform    Platform        `json:"platform,omitempty"`
+	Bot         string          `json:"bot,omitempty"`
+
+	profileOS OperatingSystem
 }
-var parserStableChromeVersions []int
 
-func init() {
-	if len(parserStableChromeVersions) == 0 {
-		for v := range parserStableChromeProfiles {
-			parserStableChromeVersions = append(parserStableChromeVersions, v)
+func (i UserAgentInfo) IsBot() bool {
+	return i.Bot != ""
+}
+
+func ParseUserAgent(ua string) (UserAgentInfo, error) {
+	info := UserAgentInfo{UserAgent: ua, Bot: detectBot(ua)}
+
+	browser, engine, fullVersion := detectRegisteredBrowser(ua)
+	if browser == "" {
+		for _, re := range uaRegexes {
+			if match := re.Regex.FindStringSubmatch(ua); len(match) > 1 {
+				browser, engine, fullVersion = re.Browser, DefaultProfilePack().browsers[re.Browser].Family, match[1]
+				if re.Engine != "" {
+					engine = re.Engine
+				}
+				break
+			}
 		}
-		sort.Ints(parserStableChromeVersions)
 	}
+	if browser != "" {
+		major, _, _ := strings.Cut(fullVersion, ".")
+		v, err := strconv.Atoi(major)
+		if err != nil {
+			return info, fmt.Errorf("could not parse version from ua string: %w", err)
+		}
+		info.Browser = browser
+		info.Engine = engine
+		info.Version = v
+		info.FullVersion = fullVersion
+	}
+
+	parseUserAgentPlatform(ua, &info)
+
+	switch {
+	case info.IsBot():
+		return info, nil
+	case info.Browser == "":
+		return info, ErrUnsupportedBrowser
+	case info.OS == "":
+		return info, ErrUnsupportedOS
+	}
+	return info, nil
 }
 
-func findClosestChromeProfileForParser(targetVersion int) utls.ClientHelloID {
-	bestVersion := -1
-	for _, v := range parserStableChromeVersions {
-		if v <= targetVersion && v > bestVersion {
-			bestVersion = v
+func parseUserAgentPlatform(ua string, info *UserAgentInfo) {
+	if os, mobile, ok := detectRegisteredOS(ua); ok {
+		info.profileOS = os
+		info.Platform = PlatformDesktop
+		if mobile {
+			info.Platform = PlatformMobile
 		}
+		info.OS = os
+		return
 	}
-	if bestVersion != -1 {
-		return parserStableChromeProfiles[bestVersion]
+
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPod"), strings.Contains(ua, "iPad"):
+		info.profileOS = OSiOS
+		info.Platform = PlatformMobile
+		info.DeviceModel = "iPhone"
+		switch {
+		case strings.Contains(ua, "iPad"):
+			info.profileOS = osIPadOS
+			info.Platform = PlatformTablet
+			info.DeviceModel = "iPad"
+		case strings.Contains(ua, "iPod"):
+			info.DeviceModel = "iPod"
+		}
+		if m := appleVersionRegex.FindStringSubmatch(ua); len(m) > 1 {
+			info.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+	case strings.Contains(ua, "Android"):
+		info.profileOS = osAndroidTablet
+		info.Platform = PlatformTablet
+		if strings.Contains(ua, "Mobile") {
+			info.profileOS = OSAndroid
+			info.Platform = PlatformMobile
+		}
+		if m := androidVersionRegex.FindStringSubmatch(ua); len(m) > 1 {
+			info.OSVersion = m[1]
+		}
+		info.DeviceModel = androidDeviceModel(ua)
+	case strings.Contains(ua, "CrOS"):
+		info.profileOS = OSChromeOS
+		info.Platform = PlatformDesktop
+		if m := chromeOSVersionRegex.FindStringSubmatch(ua); len(m) > 1 {
+			info.OSVersion = m[1]
+		}
+	case strings.Contains(ua, "Windows"):
+		info.profileOS = OSWindows
+		info.Platform = PlatformDesktop
+		if m := windowsVersionRegex.FindStringSubmatch(ua); len(m) > 1 {
+			info.OSVersion = m[1]
+		}
+	case strings.Contains(ua, "Macintosh"):
+		info.profileOS = osMacIntel
+		if strings.Contains(ua, "ARM Mac") {
+			info.profileOS = osMacAppleSilicon
+		}
+		info.Platform = PlatformDesktop
+		if m := appleVersionRegex.FindStringSubmatch(ua); len(m) > 1 {
+			info.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+	case strings.Contains(ua, "Linux"), strings.Contains(ua, "X11"):
+		info.profileOS = OSLinux
+		switch {
+		case strings.Contains(ua, "Ubuntu"):
+			info.profileOS = osUbuntu
+		case strings.Contains(ua, "Fedora"):
+			info.profileOS = osFedora
+		}
+		info.Platform = PlatformDesktop
+	default:
+		return
 	}
-	return parserStableChromeProfiles[parserStableChromeVersions[0]]
+
+	info.OS = publicOS(info.profileOS)
+}
+
+func androidDeviceModel(ua string) string {
+	start := strings.IndexByte(ua, '(')
+	end := strings.IndexByte(ua, ')')
+	if start < 0 || end < start {
+		return ""
+	}
+
+	parts := strings.Split(ua[start+1:end], ";")
+	for i, part := range parts {
+		if !strings.HasPrefix(strings.TrimSpace(part), "Android") || i+1 >= len(parts) {
+			continue
+		}
+		model := strings.TrimSpace(parts[i+1])
+		model, _, _ = strings.Cut(model, " Build/")
+		switch {
+		case model == "K", model == "Mobile", model == "Tablet", model == "wv", strings.HasPrefix(model, "rv:"):
+			return ""
+		}
+		return model
+	}
+	return ""
 }
 
 type parsedUA struct {
 	Browser Browser
+	Engine  BrowserFamily
 	Version int
 	OS      OperatingSystem
 }
 
-func parseUserAgentString(ua string) (*parsedUA, error) {
-	var p parsedUA
-
-	for _, re := range uaRegexes {
-		if match := re.Regex.FindStringSubmatch(ua); len(match) > 1 {
-			p.Browser = re.Browser
-			v, err := strconv.Atoi(match[1])
-			if err != nil {
-				return nil, fmt.Errorf("could not parse version from ua string: %w", err)
-			}
-			p.Version = v
-			break
-		}
-	}
-	if p.Browser == "" {
-		return nil, ErrUnsupportedBrowser
+func (ua *parsedUA) engineProfile() BrowserProfile {
+	browsers := DefaultProfilePack().browsers
+	profile := browsers[ua.Browser]
+	if ua.Engine == WebKit && profile.Family != WebKit {
+		return browsers[BrowserSafari]
 	}
+	return profile
+}
 
+func parseUserAgentString(ua string) (*parsedUA, error) {
+	info, err := ParseUserAgent(ua)
 	switch {
-	case strings.Contains(ua, "Windows NT 10.0"):
-		p.OS = OSWindows11
-	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
-		p.OS = OSiOS
-	case strings.Contains(ua, "Macintosh"):
-		p.OS = osMacIntel
-	case strings.Contains(ua, "Linux"):
-		p.OS = OSLinux
-	case strings.Contains(ua, "Android"):
-		p.OS = OSAndroid
-	case strings.Contains(ua, "CrOS"):
-		p.OS = OSChromeOS
-	default:
+	case err != nil:
+		return nil, err
+	case info.Browser == "":
+		return nil, ErrUnsupportedBrowser
+	case info.OS == "":
 		return nil, ErrUnsupportedOS
 	}
 
-	return &p, nil
+	return &parsedUA{Browser: info.Browser, Engine: info.Engine, Version: info.Version, OS: info.profileOS}, nil
 }
 
+var defaultGenerator = NewGenerator()
+
 func FromUserAgentString(userAgentString string, requestType RequestType) (*Agent, error) {
-	ua, err := parseUserAgentString(userAgentString)
-	if err != nil {
+	return defaultGenerator.FromUserAgent(userAgentString, requestType)
+}
+
+func (g *Generator) FromUserAgent(userAgentString string, requestType RequestType) (*Agent, error) {
+	if g.profilePackErr != nil {
+		return nil, g.profilePackErr
+	}
+	pack := g.ProfilePack()
+
+	info, err := ParseUserAgent(userAgentString)
+	switch {
+	case err != nil:
 		return nil, err
+	case info.Browser == "":
+		return nil, ErrUnsupportedBrowser
+	case info.OS == "":
+		return nil, ErrUnsupportedOS
 	}
 
-	profile, ok := browserProfiles[ua.Browser]
+	profile, ok := pack.browsers[info.Browser]
 	if !ok {
 		return nil, ErrUnsupportedBrowser
 	}
-
-	osProf, ok := osProfiles[ua.OS]
+	osProf, ok := pack.os[info.profileOS]
 	if !ok {
 		return nil, ErrUnsupportedOS
 	}
+	osProf = osProf.pickVersion(info.Browser, info.Version, profile.Versions[info.Version].Released, info.OSVersion)
+	if info.profileOS == OSiOS && info.OSVersion != "" {
+		osProf.Version = info.OSVersion
+	}
 
 	platform := PlatformDesktop
-
-	if ua.OS == OSAndroid || ua.OS == OSiOS {
-		platform = PlatformMobile
+	if info.Platform == PlatformMobile || info.Platform == PlatformTablet {
+		platform = info.Platform
 	}
 
-	platformProf, ok := platformProfiles[platform]
-	if !ok {
-		return nil, fmt.Errorf("internal error: no platform profile for %s", platform)
+	var versionProf VersionProfile
+	if info.Engine == WebKit && isIOSVariant(pack, info.Browser, info.profileOS) {
+		profile, versionProf, err = iosWebKitProfile(pack, osProf)
+	} else {
+		versionProf, _, err = findClosestVersionProfile(profile.Versions, info.Version)
 	}
-
-	versionProf, _, err := findClosestVersionProfile(profile.Versions, ua.Version)
 	if err != nil {
 		return nil, err
 	}
 
 	fullVersion := ""
 	if profile.ChromiumBased {
-		fullVersion = fmt.Sprintf("%d.0.%d.0", ua.Version, versionProf.BuildNumber)
+		fullVersion = info.FullVersion
+		if strings.Count(fullVersion, ".") != 3 || strings.HasSuffix(fullVersion, ".0.0.0") {
+			fullVersion = fmt.Sprintf("%d.0.%d.0", info.Version, versionProf.BuildNumber)
+		}
 	}
 
-	headers, headerOrder := buildStaticHeaders(profile, osProf, platformProf, ua.Version, fullVersion, versionProf, requestType)
+	attempts := 1
+	if g.validationMode == ValidationRegenerate {
+		attempts = maxValidationAttempts
+	}
+
+	agent := g.agentPool.Get().(*Agent)
+	agent.UserAgent = userAgentString
+
+	var issues []Issue
+	for i := 0; i < attempts; i++ {
+		device := pack.pickDevice(platform, info.profileOS, info.DeviceModel)
+		if device != nil && device.AndroidVersion > 0 {
+			major, _, _ := strings.Cut(info.OSVersion, ".")
+			if v, err := strconv.Atoi(major); err == nil && info.DeviceModel != "" {
+				device.setAndroidVersion(v)
+			}
+			osProf.Version = device.platformVersion()
+		}
+		g.fillAgent(agent, profile, osProf, platformProfiles[platform], info.Version, fullVersion, device, versionProf, requestType)
 
-	helloID := findClosestChromeProfileForParser(ua.Version)
+		if g.validationMode == ValidationOff {
+			return agent, nil
+		}
+		if issues = Validate(agent); !HasErrors(issues) {
+			return agent, nil
+		}
+	}
 
-	return &Agent{
-		UserAgent:       userAgentString,
-		Headers:         headers,
-		HeaderOrder:     headerOrder,
-		ClientHelloSpec: nil,
-		ClientHelloID:   helloID,
-		H2Settings:      GetChromiumH2Settings(),
-	}, nil
+	g.ReleaseAgent(agent)
+	return nil, &ValidationError{Issues: issues}
 }
 
-func findClosestVersionProfile(versions map[int]versionProfile, targetVersion int) (versionProfile, int, error) {
+func findClosestVersionProfile(versions map[int]VersionProfile, targetVersion int) (VersionProfile, int, error) {
 	closestVersion := -1
 	for v := range versions {
 		if v <= targetVersion && v > closestVersion {
@@ -163,13 +323,13 @@ func findClosestVersionProfile(versions map[int]versionProfile, targetVersion in
 	}
 
 	if closestVersion == -1 {
-		return versionProfile{}, 0, ErrUnsupportedVersion
+		return VersionProfile{}, 0, ErrUnsupportedVersion
 	}
 
 	return versions[closestVersion], closestVersion, nil
 }
 
-func buildStaticHeaders(browser browserProfile, os osProfile, platform platformProfile, version int, fullVersion string, versionProf versionProfile, requestType RequestType) (http.Header, []string) {
+func buildStaticHeaders(browser BrowserProfile, os OSProfile, platform PlatformProfile, version int, fullVersion string, versionProf VersionProfile, requestType RequestType) (http.Header, []string) {
 	headerMap := make(map[string]string)
 
 	sb := builderPool.Get().(*strings.Builder)
@@ -212,10 +372,10 @@ func buildStaticHeaders(browser browserProfile, os osProfile, platform platformP
 	headerMap["accept-language"] = "en-US,en;q=0.9"
 
 	if browser.ChromiumBased {
-		headerMap["sec-ch-ua"] = buildSecChUa(browser.Brand, strconv.Itoa(version), false, false)
+		headerMap["sec-ch-ua"] = buildSecChUa(browser.Brand, strconv.Itoa(version), strconv.Itoa(version), false)
 		headerMap["sec-ch-ua-mobile"] = platform.MobileHint
 		headerMap["sec-ch-ua-platform"] = fmt.Sprintf(`"%s"`, os.Name)
-		headerMap["sec-ch-ua-full-version-list"] = buildSecChUa(browser.Brand, fullVersion, true, false)
+		headerMap["sec-ch-ua-full-version-list"] = buildSecChUa(browser.Brand, fullVersion, versionProf.chromiumFullVersion(fullVersion), true)
 		if os.Version != "" {
 			headerMap["sec-ch-ua-platform-version"] = fmt.Sprintf(`"%s"`, os.Version)
 		}
@@ -247,7 +407,7 @@ func buildStaticHeaders(browser browserProfile, os osProfile, platform platformP
 	}
 
 	PriorityHeaderSorter(keys)
-	orderedKeys := append([]string{":method", ":authority", ":scheme", ":path"}, keys...)
+	orderedKeys := append(append([]string(nil), familyPseudoHeaderOrder[browser.Family]...), keys...)
 	for _, k := range keys {
 		header.Set(k, headerMap[k])
 	}
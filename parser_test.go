@@ -9,6 +9,14 @@ import (
 )
 
 func TestFromUserAgentString(t *testing.T) {
+	profileHelloID := func(browser Browser, version int) utls.ClientHelloID {
+		vp, _, err := findClosestVersionProfile(DefaultProfilePack().browsers[browser].Versions, version)
+		if err != nil {
+			t.Fatalf("No %s profile for %d: %v", browser, version, err)
+		}
+		return vp.TLS.HelloID
+	}
+
 	t.Run("Successful Chrome Parse", func(t *testing.T) {
 		ua := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36"
 		agent, err := FromUserAgentString(ua, RequestTypeNavigate)
@@ -18,8 +26,8 @@ func TestFromUserAgentString(t *testing.T) {
 		if agent.UserAgent != ua {
 			t.Errorf("Expected UserAgent to be identical, got %s", agent.UserAgent)
 		}
-		if agent.ClientHelloID != utls.HelloChrome_133 {
-			t.Error("Expected ClientHelloID for Chrome 138 to be HelloChrome_133")
+		if want := profileHelloID(BrowserChrome, 138); agent.ClientHelloID != want {
+			t.Errorf("Expected ClientHelloID %s for Chrome 138, got %s", want.Str(), agent.ClientHelloID.Str())
 		}
 		if !strings.Contains(agent.Headers.Get("sec-ch-ua"), `"Google Chrome";v="138"`) {
 			t.Errorf("sec-ch-ua header is incorrect: %s", agent.Headers.Get("sec-ch-ua"))
@@ -32,8 +40,8 @@ func TestFromUserAgentString(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
-		if agent.ClientHelloID != utls.HelloChrome_120 {
-			t.Error("Expected ClientHelloID for Chrome 125 to be HelloChrome_120")
+		if want := profileHelloID(BrowserChrome, 125); agent.ClientHelloID != want {
+			t.Errorf("Expected ClientHelloID %s for Chrome 125, got %s", want.Str(), agent.ClientHelloID.Str())
 		}
 	})
 
@@ -46,8 +54,11 @@ func TestFromUserAgentString(t *testing.T) {
 		if agent.Headers.Get("sec-ch-ua") != "" {
 			t.Error("Firefox should not have sec-ch-ua headers")
 		}
-		if agent.ClientHelloID != utls.HelloChrome_120 {
-			t.Errorf("Incorrect TLS profile for Firefox, expected closest Chrome profile (120)")
+		if clientHelloFamily(agent) != Gecko || h2SettingsFamily(agent.H2Settings) != Gecko {
+			t.Errorf("Expected Gecko TLS and HTTP/2 layers for Firefox, got %s", agent.ClientHelloID.Str())
+		}
+		if issues := Validate(agent); HasErrors(issues) {
+			t.Errorf("Unexpected validation issues: %v", issues)
 		}
 	})
 
@@ -63,8 +74,8 @@ func TestFromUserAgentString(t *testing.T) {
 			t.Errorf("Expected UserAgent to be identical, got %s", agent.UserAgent)
 		}
 
-		if agent.ClientHelloID != utls.HelloChrome_120 {
-			t.Errorf("Incorrect TLS profile for Safari, expected oldest stable Chrome profile")
+		if clientHelloFamily(agent) != WebKit || h2SettingsFamily(agent.H2Settings) != WebKit {
+			t.Errorf("Expected WebKit TLS and HTTP/2 layers for Safari, got %s", agent.ClientHelloID.Str())
 		}
 	})
 
@@ -84,3 +95,196 @@ func TestFromUserAgentString(t *testing.T) {
 		}
 	})
 }
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want UserAgentInfo
+		err  error
+	}{
+		{
+			name: "Chrome Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.7204.101 Safari/537.36",
+			want: UserAgentInfo{Browser: BrowserChrome, Engine: Chromium, Version: 138, FullVersion: "138.0.7204.101", OS: OSWindows, OSVersion: "10.0", Platform: PlatformDesktop},
+		},
+		{
+			name: "Chrome Android Phone",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: BrowserChrome, Engine: Chromium, Version: 124, FullVersion: "124.0.6367.82", OS: OSAndroid, OSVersion: "14", DeviceModel: "Pixel 7", Platform: PlatformMobile},
+		},
+		{
+			name: "Chrome Android Tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X710 Build/TP1A.220624.014) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.43 Safari/537.36",
+			want: UserAgentInfo{Browser: BrowserChrome, Engine: Chromium, Version: 120, FullVersion: "120.0.6099.43", OS: OSAndroid, OSVersion: "13", DeviceModel: "SM-X710", Platform: PlatformTablet},
+		},
+		{
+			name: "Android WebView",
+			ua:   "Mozilla/5.0 (Linux; Android 12; SM-A525F; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/120.0.6099.43 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: BrowserChrome, Engine: Chromium, Version: 120, FullVersion: "120.0.6099.43", OS: OSAndroid, OSVersion: "12", DeviceModel: "SM-A525F", Platform: PlatformMobile},
+		},
+		{
+			name: "Firefox Android",
+			ua:   "Mozilla/5.0 (Android 14; Mobile; rv:128.0) Gecko/128.0 Firefox/128.0",
+			want: UserAgentInfo{Browser: BrowserFirefox, Engine: Gecko, Version: 128, FullVersion: "128.0", OS: OSAndroid, OSVersion: "14", Platform: PlatformMobile},
+		},
+		{
+			name: "Firefox Ubuntu",
+			ua:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+			want: UserAgentInfo{Browser: BrowserFirefox, Engine: Gecko, Version: 127, FullVersion: "127.0", OS: OSLinux, Platform: PlatformDesktop},
+		},
+		{
+			name: "Safari macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+			want: UserAgentInfo{Browser: BrowserSafari, Engine: WebKit, Version: 17, FullVersion: "17.5", OS: OSMac, OSVersion: "10.15.7", Platform: PlatformDesktop},
+		},
+		{
+			name: "Safari iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Browser: BrowserSafari, Engine: WebKit, Version: 17, FullVersion: "17.5", OS: OSiOS, OSVersion: "17.5.1", DeviceModel: "iPhone", Platform: PlatformMobile},
+		},
+		{
+			name: "Safari iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Browser: BrowserSafari, Engine: WebKit, Version: 16, FullVersion: "16.6", OS: OSiOS, OSVersion: "16.6", DeviceModel: "iPad", Platform: PlatformTablet},
+		},
+		{
+			name: "Edge Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36 Edg/141.0.3537.57",
+			want: UserAgentInfo{Browser: BrowserEdge, Engine: Chromium, Version: 141, FullVersion: "141.0.3537.57", OS: OSWindows, OSVersion: "10.0", Platform: PlatformDesktop},
+		},
+		{
+			name: "Opera Without Minor Version",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.6723.1 Safari/537.36 OPR/116",
+			want: UserAgentInfo{Browser: BrowserOpera, Engine: Chromium, Version: 116, FullVersion: "116", OS: OSWindows, OSVersion: "10.0", Platform: PlatformDesktop},
+		},
+		{
+			name: "Chrome OS",
+			ua:   "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/128.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: BrowserChrome, Engine: Chromium, Version: 128, FullVersion: "128.0.0.0", OS: OSChromeOS, OSVersion: "14541.0.0", Platform: PlatformDesktop},
+		},
+		{
+			name: "Googlebot Smartphone",
+			ua:   "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: UserAgentInfo{Browser: BrowserChrome, Engine: Chromium, Version: 120, FullVersion: "120.0.0.0", OS: OSAndroid, OSVersion: "6.0.1", DeviceModel: "Nexus 5X", Platform: PlatformMobile, Bot: BotGoogle},
+		},
+		{
+			name: "GPTBot",
+			ua:   "GPTBot/1.0 (+http://openai.com/gptbot)",
+			want: UserAgentInfo{Bot: BotGPT},
+		},
+		{
+			name: "Unknown Bot Variant",
+			ua:   "Mozilla/5.0 (compatible; SemrushBot/7~bl; +http://www.semrush.com/bot.html)",
+			want: UserAgentInfo{Bot: BotSemrush},
+		},
+		{
+			name: "Unsupported Browser",
+			ua:   "curl/8.4.0",
+			want: UserAgentInfo{},
+			err:  ErrUnsupportedBrowser,
+		},
+		{
+			name: "Unsupported OS",
+			ua:   "Mozilla/5.0 (PlayStation; PlayStation 5/2.26) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0 Safari/605.1.15",
+			want: UserAgentInfo{Browser: BrowserSafari, Engine: WebKit, Version: 13, FullVersion: "13.0"},
+			err:  ErrUnsupportedOS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseUserAgent(tt.ua)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+
+			tt.want.UserAgent = tt.ua
+			got.profileOS = ""
+			if got != tt.want {
+				t.Errorf("ParseUserAgent mismatch\n got: %+v\nwant: %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Bot Profiles", func(t *testing.T) {
+		for category, profiles := range botProfileCategories {
+			for _, p := range profiles {
+				info, err := ParseUserAgent(p.UserAgent)
+				if err != nil || info.Bot != category {
+					t.Errorf("Expected %q to be detected as %s, got %q (err %v)", p.UserAgent, category, info.Bot, err)
+				}
+			}
+		}
+	})
+
+	t.Run("Generated Agents", func(t *testing.T) {
+		g := NewGenerator()
+		for i := 0; i < 500; i++ {
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			info, err := ParseUserAgent(agent.UserAgent)
+			if err != nil || info.Engine != clientHelloFamily(agent) || info.IsBot() {
+				t.Fatalf("Unexpected parse of %q: %+v (err %v)", agent.UserAgent, info, err)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+}
+
+func TestGeneratorFromUserAgent(t *testing.T) {
+	t.Run("Family Correct Layers", func(t *testing.T) {
+		g := NewGenerator(WithLanguages("de-DE,de;q=0.9"), WithValidation(ValidationRegenerate))
+		for _, tt := range []struct {
+			ua      string
+			helloID utls.ClientHelloID
+			family  BrowserFamily
+		}{
+			{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0", utls.HelloFirefox_120, Gecko},
+			{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", utls.HelloSafari_16_0, WebKit},
+			{"Mozilla/5.0 (Linux; Android 14; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36", utls.HelloChrome_120, Chromium},
+		} {
+			agent, err := g.FromUserAgent(tt.ua, RequestTypeNavigate)
+			if err != nil {
+				t.Fatalf("FromUserAgent(%q) failed: %v", tt.ua, err)
+			}
+			if agent.UserAgent != tt.ua || agent.ClientHelloID != tt.helloID || h2SettingsFamily(agent.H2Settings) != tt.family {
+				t.Errorf("Unexpected layers for %q: %v %v", tt.ua, agent.ClientHelloID, agent.H2Settings)
+			}
+			if lang := agent.Headers.Get("accept-language"); !strings.HasPrefix(lang, "de-DE,de;q=") {
+				t.Errorf("Expected generator languages, got %q", lang)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+
+	t.Run("Request Type And Options", func(t *testing.T) {
+		g := NewGenerator(WithFingerprintProfile(FingerprintProfileMaximum), WithH2Randomization(H2RandomizationProfileNormal))
+
+		agent, err := g.FromUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36", RequestTypeXHR)
+		if err != nil {
+			t.Fatalf("FromUserAgent failed: %v", err)
+		}
+		if agent.Headers.Get("sec-fetch-mode") != "cors" || agent.ClientHelloSpec == nil {
+			t.Errorf("Expected an XHR agent with a randomized spec, got %v", agent.Headers)
+		}
+		g.ReleaseAgent(agent)
+
+		agent, err = g.FromUserAgent("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", RequestTypeNavigate)
+		if err != nil {
+			t.Fatalf("FromUserAgent failed: %v", err)
+		}
+		if agent.ClientHelloSpec == nil || clientHelloFamily(agent) != Gecko {
+			t.Error("Expected Firefox to keep its own ClientHello under the maximum profile")
+		}
+		g.ReleaseAgent(agent)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		if _, err := NewGenerator().FromUserAgent("curl/8.4.0", RequestTypeNavigate); !errors.Is(err, ErrUnsupportedBrowser) {
+			t.Errorf("Expected ErrUnsupportedBrowser, got %v", err)
+		}
+	})
+}
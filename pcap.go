@@ -0,0 +1,588 @@
+package legitagent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownCaptureFormat = errors.New("unknown capture file format")
+
+const (
+	pcapMagicMicro     = 0xa1b2c3d4
+	pcapMagicNano      = 0xa1b23c4d
+	pcapngBlockSHB     = 0x0a0d0d0a
+	pcapngBlockIDB     = 0x00000001
+	pcapngBlockPB      = 0x00000002
+	pcapngBlockSPB     = 0x00000003
+	pcapngBlockEPB     = 0x00000006
+	pcapngBlockDSB     = 0x0000000a
+	pcapngSecretsTLSKL = 0x544c534b
+	pcapngByteOrder    = 0x1a2b3c4d
+	pcapngOptTSResol   = 9
+	maxCaptureBlockLen = 64 << 20
+	maxStreamBytes     = 1 << 20
+	maxPendingSegments = 1024
+)
+
+const (
+	linkTypeNull     uint32 = 0
+	linkTypeEthernet uint32 = 1
+	linkTypeRawAlt   uint32 = 12
+	linkTypeRaw      uint32 = 101
+	linkTypeLinuxSLL uint32 = 113
+	linkTypeIPv4     uint32 = 228
+	linkTypeIPv6     uint32 = 229
+	linkTypeSLL2     uint32 = 276
+)
+
+type CaptureRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Client    string    `json:"client"`
+	Server    string    `json:"server"`
+	Fingerprint
+}
+
+type capturedPacket struct {
+	timestamp time.Time
+	linkType  uint32
+	data      []byte
+}
+
+type tcpStream struct {
+	client  string
+	server  string
+	first   time.Time
+	started bool
+	next    uint32
+	data    []byte
+	pending map[uint32][]byte
+}
+
+func ReadCaptureFile(name string) ([]CaptureRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCapture(f)
+}
+
+func ReadCaptureFileWithKeyLog(name, keyLogName string) ([]CaptureRecord, error) {
+	if keyLogName == "" {
+		return ReadCaptureFile(name)
+	}
+
+	keyLog, err := os.Open(keyLogName)
+	if err != nil {
+		return nil, err
+	}
+	defer keyLog.Close()
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCaptureWithKeyLog(f, keyLog)
+}
+
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	return ReadCaptureWithKeyLog(r, nil)
+}
+
+func ReadCaptureWithKeyLog(r, keyLog io.Reader) ([]CaptureRecord, error) {
+	keys := make(tlsKeyLog)
+	if keyLog != nil {
+		data, err := io.ReadAll(keyLog)
+		if err != nil {
+			return nil, fmt.Errorf("legitagent: could not read key log: %w", err)
+		}
+		keys.parse(data)
+	}
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("legitagent: could not read capture header: %w", err)
+	}
+
+	streams := make(map[string]*tcpStream)
+	var order []*tcpStream
+	handle := func(p capturedPacket) {
+		order = handlePacket(streams, order, p)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(magic) == pcapngBlockSHB:
+		err = readPcapng(br, handle, keys)
+	case binary.LittleEndian.Uint32(magic) == pcapMagicMicro, binary.BigEndian.Uint32(magic) == pcapMagicMicro,
+		binary.LittleEndian.Uint32(magic) == pcapMagicNano, binary.BigEndian.Uint32(magic) == pcapMagicNano:
+		err = readPcap(br, handle)
+	default:
+		return nil, ErrUnknownCaptureFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].first.Before(order[j].first) })
+
+	records := make([]CaptureRecord, 0, len(order))
+	for _, s := range order {
+		fp := analyzeClientStream(s.data)
+		if fp == nil {
+			continue
+		}
+		if reply := streams[s.server+">"+s.client]; fp.TLS != nil && reply != nil && len(keys) > 0 {
+			if plain := decryptTLSClientStream(s.data, reply.data, keys); len(plain) > 0 {
+				analyzeHTTPStream(plain, fp, "h2")
+			}
+		}
+		records = append(records, CaptureRecord{Timestamp: s.first, Client: s.client, Server: s.server, Fingerprint: *fp})
+	}
+
+	return records, nil
+}
+
+func readPcap(r io.Reader, handle func(capturedPacket)) error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("legitagent: truncated pcap header: %w", err)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(header)
+	if magic != pcapMagicMicro && magic != pcapMagicNano {
+		order = binary.BigEndian
+		magic = order.Uint32(header)
+	}
+	nano := magic == pcapMagicNano
+	linkType := order.Uint32(header[20:]) & 0x0fffffff
+
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("legitagent: truncated pcap record: %w", err)
+		}
+
+		sec := int64(order.Uint32(record))
+		frac := int64(order.Uint32(record[4:]))
+		capLen := order.Uint32(record[8:])
+		if capLen > maxCaptureBlockLen {
+			return fmt.Errorf("legitagent: pcap record too large (%d bytes)", capLen)
+		}
+
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("legitagent: truncated pcap packet: %w", err)
+		}
+
+		if !nano {
+			frac *= int64(time.Microsecond)
+		}
+		handle(capturedPacket{timestamp: time.Unix(sec, frac).UTC(), linkType: linkType, data: data})
+	}
+}
+
+type pcapngInterface struct {
+	linkType uint32
+	tsUnit   float64
+}
+
+func readPcapng(r io.Reader, handle func(capturedPacket), keys tlsKeyLog) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var interfaces []pcapngInterface
+	head := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(r, head); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("legitagent: truncated pcapng block: %w", err)
+		}
+
+		blockType := order.Uint32(head)
+		if binary.LittleEndian.Uint32(head) == pcapngBlockSHB {
+			blockType = pcapngBlockSHB
+		}
+
+		var body []byte
+		if blockType == pcapngBlockSHB {
+			bom := make([]byte, 4)
+			if _, err := io.ReadFull(r, bom); err != nil {
+				return fmt.Errorf("legitagent: truncated pcapng section header: %w", err)
+			}
+			if binary.LittleEndian.Uint32(bom) == pcapngByteOrder {
+				order = binary.LittleEndian
+			} else {
+				order = binary.BigEndian
+			}
+			body = bom
+			interfaces = interfaces[:0]
+		}
+
+		total := order.Uint32(head[4:])
+		if total < 12 || total > maxCaptureBlockLen || total%4 != 0 {
+			return fmt.Errorf("legitagent: invalid pcapng block length %d", total)
+		}
+		rest := make([]byte, int(total)-8-len(body))
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return fmt.Errorf("legitagent: truncated pcapng block: %w", err)
+		}
+		body = append(body, rest[:len(rest)-4]...)
+
+		switch blockType {
+		case pcapngBlockIDB:
+			if len(body) < 8 {
+				return errors.New("legitagent: truncated pcapng interface block")
+			}
+			iface := pcapngInterface{linkType: uint32(order.Uint16(body)), tsUnit: 1e-6}
+			for opts := body[8:]; len(opts) >= 4; {
+				code, length := order.Uint16(opts), int(order.Uint16(opts[2:]))
+				if code == 0 || len(opts) < 4+length {
+					break
+				}
+				if code == pcapngOptTSResol && length >= 1 {
+					resol := opts[4]
+					if resol&0x80 != 0 {
+						iface.tsUnit = math.Pow(2, -float64(resol&0x7f))
+					} else {
+						iface.tsUnit = math.Pow(10, -float64(resol))
+					}
+				}
+				opts = opts[4+(length+3)&^3:]
+			}
+			interfaces = append(interfaces, iface)
+		case pcapngBlockEPB:
+			if len(body) < 20 {
+				return errors.New("legitagent: truncated pcapng packet block")
+			}
+			id := order.Uint32(body)
+			if int(id) >= len(interfaces) {
+				continue
+			}
+			iface := interfaces[id]
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			capLen := int(order.Uint32(body[12:]))
+			if capLen > len(body)-20 {
+				capLen = len(body) - 20
+			}
+			handle(capturedPacket{timestamp: pcapngTime(ts, iface.tsUnit), linkType: iface.linkType, data: body[20 : 20+capLen]})
+		case pcapngBlockPB:
+			if len(body) < 20 {
+				return errors.New("legitagent: truncated pcapng packet block")
+			}
+			id := int(order.Uint16(body))
+			if id >= len(interfaces) {
+				continue
+			}
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			capLen := int(order.Uint32(body[12:]))
+			if capLen > len(body)-20 {
+				capLen = len(body) - 20
+			}
+			handle(capturedPacket{timestamp: pcapngTime(ts, interfaces[id].tsUnit), linkType: interfaces[id].linkType, data: body[20 : 20+capLen]})
+		case pcapngBlockSPB:
+			if len(body) < 4 || len(interfaces) == 0 {
+				continue
+			}
+			handle(capturedPacket{linkType: interfaces[0].linkType, data: body[4:]})
+		case pcapngBlockDSB:
+			if len(body) < 8 || order.Uint32(body) != pcapngSecretsTLSKL {
+				continue
+			}
+			length := int(order.Uint32(body[4:]))
+			if length > len(body)-8 {
+				length = len(body) - 8
+			}
+			keys.parse(body[8 : 8+length])
+		}
+	}
+}
+
+func pcapngTime(ts uint64, unit float64) time.Time {
+	seconds := float64(ts) * unit
+	sec := math.Floor(seconds)
+	return time.Unix(int64(sec), int64((seconds-sec)*1e9)).UTC()
+}
+
+func handlePacket(streams map[string]*tcpStream, order []*tcpStream, p capturedPacket) []*tcpStream {
+	src, dst, proto, payload, ok := decodeNetworkLayer(p.linkType, p.data)
+	if !ok || proto != 6 || len(payload) < 20 {
+		return order
+	}
+
+	dataOffset := int(payload[12]>>4) * 4
+	if dataOffset < 20 || dataOffset > len(payload) {
+		return order
+	}
+	srcPort := binary.BigEndian.Uint16(payload)
+	dstPort := binary.BigEndian.Uint16(payload[2:])
+	seq := binary.BigEndian.Uint32(payload[4:])
+	syn := payload[13]&0x02 != 0
+	body := payload[dataOffset:]
+
+	client := net.JoinHostPort(src.String(), strconv.Itoa(int(srcPort)))
+	server := net.JoinHostPort(dst.String(), strconv.Itoa(int(dstPort)))
+	key := client + ">" + server
+
+	s, ok := streams[key]
+	if !ok {
+		s = &tcpStream{client: client, server: server, first: p.timestamp, pending: make(map[uint32][]byte)}
+		streams[key] = s
+		order = append(order, s)
+	}
+
+	if syn {
+		s.started = true
+		s.next = seq + 1
+		return order
+	}
+	if len(body) == 0 {
+		return order
+	}
+	if !s.started {
+		s.started = true
+		s.next = seq
+	}
+
+	s.addSegment(seq, body)
+	return order
+}
+
+func (s *tcpStream) addSegment(seq uint32, body []byte) {
+	if len(s.data) >= maxStreamBytes {
+		return
+	}
+
+	diff := int32(seq - s.next)
+	switch {
+	case diff < 0:
+		if int(-diff) >= len(body) {
+			return
+		}
+		body = body[-diff:]
+	case diff > 0:
+		if len(s.pending) < maxPendingSegments {
+			s.pending[seq] = append([]byte(nil), body...)
+		}
+		return
+	}
+
+	s.data = append(s.data, body...)
+	s.next += uint32(len(body))
+
+	for len(s.pending) > 0 {
+		progressed := false
+		for pseq, pbody := range s.pending {
+			d := int32(pseq - s.next)
+			if d > 0 {
+				continue
+			}
+			delete(s.pending, pseq)
+			if int(-d) < len(pbody) {
+				s.data = append(s.data, pbody[-d:]...)
+				s.next += uint32(len(pbody) + int(d))
+			}
+			progressed = true
+		}
+		if !progressed {
+			break
+		}
+	}
+}
+
+func decodeNetworkLayer(linkType uint32, data []byte) (src, dst net.IP, proto uint8, payload []byte, ok bool) {
+	var etherType uint16
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, nil, 0, nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		for etherType == 0x8100 || etherType == 0x88a8 {
+			if len(data) < 4 {
+				return nil, nil, 0, nil, false
+			}
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, nil, 0, nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:])
+		data = data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return nil, nil, 0, nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data)
+		data = data[20:]
+	case linkTypeNull:
+		if len(data) < 4 {
+			return nil, nil, 0, nil, false
+		}
+		data = data[4:]
+	case linkTypeRaw, linkTypeRawAlt, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return nil, nil, 0, nil, false
+	}
+
+	if etherType == 0 && len(data) > 0 {
+		switch data[0] >> 4 {
+		case 4:
+			etherType = 0x0800
+		case 6:
+			etherType = 0x86dd
+		}
+	}
+
+	switch etherType {
+	case 0x0800:
+		if len(data) < 20 {
+			return nil, nil, 0, nil, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		fragment := binary.BigEndian.Uint16(data[6:])
+		if ihl < 20 || total < ihl || len(data) < ihl || fragment&0x3fff != 0 {
+			return nil, nil, 0, nil, false
+		}
+		if total < len(data) {
+			data = data[:total]
+		}
+		return net.IP(data[12:16]), net.IP(data[16:20]), data[9], data[ihl:], true
+	case 0x86dd:
+		if len(data) < 40 {
+			return nil, nil, 0, nil, false
+		}
+		next := data[6]
+		length := int(binary.BigEndian.Uint16(data[4:]))
+		src, dst = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40:]
+		if length < len(data) {
+			data = data[:length]
+		}
+		for next == 0 || next == 43 || next == 60 {
+			if len(data) < 8 {
+				return nil, nil, 0, nil, false
+			}
+			extLen := (int(data[1]) + 1) * 8
+			if len(data) < extLen {
+				return nil, nil, 0, nil, false
+			}
+			next = data[0]
+			data = data[extLen:]
+		}
+		return src, dst, next, data, true
+	}
+
+	return nil, nil, 0, nil, false
+}
+
+func analyzeClientStream(data []byte) *Fingerprint {
+	if len(data) >= 6 && data[0] == 0x16 && data[1] == 0x03 {
+		hello, err := ParseClientHello(data)
+		if err != nil {
+			return nil
+		}
+		return &Fingerprint{TLS: hello}
+	}
+	return analyzeHTTPStream(data, new(Fingerprint), "h2c")
+}
+
+func analyzeHTTPStream(data []byte, fp *Fingerprint, h2Version string) *Fingerprint {
+	if bytes.HasPrefix(data, []byte(h2ClientPreface)) {
+		fp.HTTPVersion = h2Version
+		return analyzeH2Stream(data, fp, h2Version)
+	}
+
+	headers, rest, ok := parseHTTP1Head(data)
+	if !ok {
+		return nil
+	}
+
+	fp.HTTPVersion = "http/1.1"
+	for _, h := range headers {
+		fp.HeaderOrder = append(fp.HeaderOrder, h[0])
+		if h[0] == "user-agent" {
+			fp.UserAgent = h[1]
+		}
+	}
+
+	if i := bytes.Index(rest, []byte(h2ClientPreface)); i >= 0 {
+		return analyzeH2Stream(rest[i:], fp, h2Version)
+	}
+
+	return fp
+}
+
+func analyzeH2Stream(data []byte, fp *Fingerprint, version string) *Fingerprint {
+	rec := newH2Recorder()
+	rec.feed(data)
+
+	h2 := rec.fingerprint()
+	if h2 == nil {
+		return fp
+	}
+
+	fp.HTTPVersion = version
+	fp.H2 = h2
+	if len(rec.blocks) > 0 {
+		_, fp.HeaderOrder = splitHeaderFields(rec.blocks[0].Fields)
+		fp.UserAgent = headerFieldValue(rec.blocks[0].Fields, "user-agent")
+	}
+	return fp
+}
+
+func parseHTTP1Head(data []byte) (headers [][2]string, rest []byte, ok bool) {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, nil, false
+	}
+
+	lines := strings.Split(string(data[:end]), "\r\n")
+	parts := strings.Fields(lines[0])
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/1.") || !isHTTPToken(parts[0]) {
+		return nil, nil, false
+	}
+
+	for _, line := range lines[1:] {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		headers = append(headers, [2]string{strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)})
+	}
+
+	return headers, data[end+4:], true
+}
+
+func isHTTPToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,349 @@
+package legitagent
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+type testSegment struct {
+	seq     uint32
+	flags   byte
+	payload []byte
+}
+
+func buildTestPacket(sport, dport uint16, seg testSegment) []byte {
+	return buildTestIPPacket(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), sport, dport, seg)
+}
+
+func buildTestIPPacket(src, dst net.IP, sport, dport uint16, seg testSegment) []byte {
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp, sport)
+	binary.BigEndian.PutUint16(tcp[2:], dport)
+	binary.BigEndian.PutUint32(tcp[4:], seg.seq)
+	tcp[12] = 5 << 4
+	tcp[13] = seg.flags
+	tcp = append(tcp, seg.payload...)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip[8] = 64
+	ip[9] = 6
+	copy(ip[12:], src.To4())
+	copy(ip[16:], dst.To4())
+
+	eth := make([]byte, 14)
+	binary.BigEndian.PutUint16(eth[12:], 0x0800)
+
+	return append(append(eth, ip...), tcp...)
+}
+
+func writeTestPcap(packets [][]byte) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, pcapMagicMicro)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeEthernet)
+	buf.Write(header)
+
+	for i, p := range packets {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record, uint32(1700000000+i))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(p)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(p)))
+		buf.Write(record)
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func writeTestPcapng(packets [][]byte, keyLog []byte) []byte {
+	var buf bytes.Buffer
+	block := func(blockType uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		total := uint32(12 + len(body))
+		_ = binary.Write(&buf, binary.LittleEndian, blockType)
+		_ = binary.Write(&buf, binary.LittleEndian, total)
+		buf.Write(body)
+		_ = binary.Write(&buf, binary.LittleEndian, total)
+	}
+
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb, pcapngByteOrder)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	block(pcapngBlockSHB, shb)
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb, uint16(linkTypeEthernet))
+	binary.LittleEndian.PutUint32(idb[4:], 65535)
+	block(pcapngBlockIDB, idb)
+
+	if keyLog != nil {
+		dsb := make([]byte, 8)
+		binary.LittleEndian.PutUint32(dsb, pcapngSecretsTLSKL)
+		binary.LittleEndian.PutUint32(dsb[4:], uint32(len(keyLog)))
+		block(pcapngBlockDSB, append(dsb, keyLog...))
+	}
+
+	for _, p := range packets {
+		epb := make([]byte, 20)
+		binary.LittleEndian.PutUint32(epb[12:], uint32(len(p)))
+		binary.LittleEndian.PutUint32(epb[16:], uint32(len(p)))
+		block(pcapngBlockEPB, append(epb, p...))
+	}
+	return buf.Bytes()
+}
+
+func buildTestH2cStream(t *testing.T) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(h2ClientPreface)
+
+	framer := http2.NewFramer(&buf, nil)
+	settings := orderedH2Settings(GetChromiumH2Settings())
+	if err := framer.WriteSettings(settings...); err != nil {
+		t.Fatal(err)
+	}
+	if err := framer.WriteWindowUpdate(0, chromiumH2WindowUpdate); err != nil {
+		t.Fatal(err)
+	}
+
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, f := range []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":path", Value: "/"},
+		{Name: "user-agent", Value: "test-agent/1.0"},
+		{Name: "accept", Value: "*/*"},
+	} {
+		if err := enc.WriteField(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: block.Bytes(), EndStream: true, EndHeaders: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadCaptureTLS(t *testing.T) {
+	hello, err := (&Agent{ClientHelloID: utls.HelloChrome_120}).captureClientHello("example.com", h2ALPN)
+	if err != nil {
+		t.Fatalf("Failed to capture client hello: %v", err)
+	}
+
+	mid := len(hello) / 2
+	packets := [][]byte{
+		buildTestPacket(50000, 443, testSegment{seq: 999, flags: 0x02}),
+		buildTestPacket(50000, 443, testSegment{seq: 1000 + uint32(mid), flags: 0x18, payload: hello[mid:]}),
+		buildTestPacket(50000, 443, testSegment{seq: 1000, flags: 0x18, payload: hello[:mid]}),
+		buildTestPacket(50000, 443, testSegment{seq: 1000, flags: 0x18, payload: hello[:mid]}),
+	}
+
+	records, err := ReadCapture(bytes.NewReader(writeTestPcap(packets)))
+	if err != nil {
+		t.Fatalf("ReadCapture failed: %v", err)
+	}
+	if len(records) != 1 || records[0].TLS == nil {
+		t.Fatalf("Expected one TLS record, got %+v", records)
+	}
+
+	expected, err := ClientHelloIDFingerprint(utls.HelloChrome_120, "example.com")
+	if err != nil {
+		t.Fatalf("ClientHelloIDFingerprint failed: %v", err)
+	}
+	if records[0].TLS.JA4 != expected.JA4 {
+		t.Errorf("JA4 mismatch: got %s, want %s", records[0].TLS.JA4, expected.JA4)
+	}
+	if records[0].Client != "10.0.0.1:50000" || records[0].Server != "10.0.0.2:443" {
+		t.Errorf("Unexpected endpoints: %s -> %s", records[0].Client, records[0].Server)
+	}
+}
+
+func TestReadCapturePcapngH2c(t *testing.T) {
+	stream := buildTestH2cStream(t)
+	packets := [][]byte{
+		buildTestPacket(50001, 80, testSegment{seq: 1, flags: 0x18, payload: stream[:30]}),
+		buildTestPacket(50001, 80, testSegment{seq: 31, flags: 0x18, payload: stream[30:]}),
+	}
+
+	records, err := ReadCapture(bytes.NewReader(writeTestPcapng(packets, nil)))
+	if err != nil {
+		t.Fatalf("ReadCapture failed: %v", err)
+	}
+	if len(records) != 1 || records[0].H2 == nil {
+		t.Fatalf("Expected one h2c record, got %+v", records)
+	}
+
+	agent := &Agent{
+		UserAgent:      "test-agent/1.0",
+		H2Settings:     GetChromiumH2Settings(),
+		H2WindowUpdate: chromiumH2WindowUpdate,
+		HeaderOrder:    []string{":method", ":authority", ":scheme", ":path", "accept"},
+	}
+	expected, err := agent.Fingerprint("")
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+
+	if records[0].H2.Akamai != expected.H2.Akamai {
+		t.Errorf("Akamai mismatch: got %s, want %s", records[0].H2.Akamai, expected.H2.Akamai)
+	}
+	if records[0].UserAgent != "test-agent/1.0" {
+		t.Errorf("Unexpected user agent: %q", records[0].UserAgent)
+	}
+	if !reflect.DeepEqual(records[0].HeaderOrder, expected.HeaderOrder) {
+		t.Errorf("Header order mismatch: got %v, want %v", records[0].HeaderOrder, expected.HeaderOrder)
+	}
+}
+
+type recordingConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.written.Write(p)
+	return c.Conn.Write(p)
+}
+
+func recordTLSSession(t *testing.T, config *tls.Config, payload []byte) (packets [][]byte, keyLog []byte) {
+	t.Helper()
+
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatalf("selfSignedCertificate failed: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+
+	server := new(recordingConn)
+	done := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer c.Close()
+		server.Conn = c
+		tc := tls.Server(server, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}})
+		_, err = io.ReadFull(tc, make([]byte, len(payload)))
+		done <- err
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	var keys bytes.Buffer
+	client := &recordingConn{Conn: c}
+	config.InsecureSkipVerify = true
+	config.KeyLogWriter = &keys
+	tc := tls.Client(client, config)
+	if _, err := tc.Write(payload); err != nil {
+		t.Fatalf("TLS write failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("TLS server failed: %v", err)
+	}
+
+	clientIP, serverIP := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	segment := func(src, dst net.IP, sport, dport uint16, data []byte) {
+		seq := uint32(1)
+		for len(data) > 0 {
+			n := min(len(data), 1400)
+			packets = append(packets, buildTestIPPacket(src, dst, sport, dport, testSegment{seq: seq, flags: 0x18, payload: data[:n]}))
+			seq += uint32(n)
+			data = data[n:]
+		}
+	}
+	segment(clientIP, serverIP, 50002, 443, client.written.Bytes())
+	segment(serverIP, clientIP, 443, 50002, server.written.Bytes())
+
+	return packets, keys.Bytes()
+}
+
+func TestReadCaptureKeyLog(t *testing.T) {
+	h2Stream := buildTestH2cStream(t)
+	h1Request := []byte("GET / HTTP/1.1\r\nHost: example.com\r\nUser-Agent: test-agent/1.0\r\nAccept: */*\r\n\r\n")
+
+	tests := []struct {
+		name    string
+		config  *tls.Config
+		payload []byte
+		pcapng  bool
+		version string
+	}{
+		{"TLS 1.3", &tls.Config{NextProtos: []string{"h2"}}, h2Stream, false, "h2"},
+		{"TLS 1.3 Decryption Secrets Block", &tls.Config{NextProtos: []string{"h2"}}, h2Stream, true, "h2"},
+		{"TLS 1.2 AES-GCM", &tls.Config{NextProtos: []string{"h2"}, MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}}, h2Stream, true, "h2"},
+		{"TLS 1.2 ChaCha20", &tls.Config{NextProtos: []string{"http/1.1"}, MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}}, h1Request, false, "http/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets, keyLog := recordTLSSession(t, tt.config, tt.payload)
+
+			var records []CaptureRecord
+			var err error
+			if tt.pcapng {
+				records, err = ReadCapture(bytes.NewReader(writeTestPcapng(packets, keyLog)))
+			} else {
+				records, err = ReadCaptureWithKeyLog(bytes.NewReader(writeTestPcap(packets)), bytes.NewReader(keyLog))
+			}
+			if err != nil {
+				t.Fatalf("ReadCapture failed: %v", err)
+			}
+			if len(records) != 1 || records[0].TLS == nil {
+				t.Fatalf("Expected one TLS record, got %+v", records)
+			}
+
+			rec := records[0]
+			if rec.HTTPVersion != tt.version || rec.UserAgent != "test-agent/1.0" {
+				t.Errorf("Expected decrypted %s traffic, got version=%q ua=%q", tt.version, rec.HTTPVersion, rec.UserAgent)
+			}
+			if expected := analyzeClientStream(h2Stream); tt.version == "h2" && (!reflect.DeepEqual(rec.H2, expected.H2) || !reflect.DeepEqual(rec.HeaderOrder, expected.HeaderOrder)) {
+				t.Errorf("Decrypted h2 fingerprint mismatch: got %+v %v, want %+v %v", rec.H2, rec.HeaderOrder, expected.H2, expected.HeaderOrder)
+			}
+			if tt.version == "http/1.1" && !reflect.DeepEqual(rec.HeaderOrder, []string{"host", "user-agent", "accept"}) {
+				t.Errorf("Unexpected decrypted header order: %v", rec.HeaderOrder)
+			}
+
+			records, err = ReadCapture(bytes.NewReader(writeTestPcap(packets)))
+			if err != nil {
+				t.Fatalf("ReadCapture failed: %v", err)
+			}
+			if len(records) != 1 || records[0].HTTPVersion != "" || records[0].H2 != nil {
+				t.Errorf("Expected only the ClientHello without a key log, got %+v", records)
+			}
+		})
+	}
+}
+
+func TestReadCaptureUnknownFormat(t *testing.T) {
+	if _, err := ReadCapture(bytes.NewReader([]byte("not a capture file"))); err != ErrUnknownCaptureFormat {
+		t.Errorf("Expected ErrUnknownCaptureFormat, got %v", err)
+	}
+}
@@ -0,0 +1,584 @@
+package legitagent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+//go:embed data/profiles.json
+var embeddedProfilePack []byte
+
+const ProfilePackSchema = 1
+
+var ErrInvalidProfilePack = errors.New("legitagent: invalid profile pack")
+
+var chromiumBuildRegex = regexp.MustCompile(`"Chromium";v="\d+\.\d+\.(\d+)\.\d+"`)
+
+type ProfilePack struct {
+	Schema   int
+	Revision string
+
+	file          *profilePackFile
+	browsers      map[Browser]BrowserProfile
+	browserList   []Browser
+	os            map[OperatingSystem]OSProfile
+	osList        []OperatingSystem
+	platforms     map[Platform]PlatformProfile
+	platformList  []Platform
+	devices       map[string]Device
+	deviceList    []string
+	botCategories map[string][]botProfile
+	allBots       []botProfile
+
+	registryGen uint64
+	registered  atomic.Pointer[ProfilePack]
+}
+
+type profilePackFile struct {
+	Schema         int                                `json:"schema"`
+	Revision       string                             `json:"revision,omitempty"`
+	AcceptPatterns map[string][][]AcceptHeaderPart    `json:"accept_patterns,omitempty"`
+	H2Profiles     map[string]*profilePackH2          `json:"h2_profiles,omitempty"`
+	Browsers       map[Browser]*profilePackBrowser    `json:"browsers,omitempty"`
+	OS             map[OperatingSystem]*profilePackOS `json:"os,omitempty"`
+	Devices        map[string]*profilePackDevice      `json:"devices,omitempty"`
+	Bots           map[string][]profilePackBot        `json:"bots,omitempty"`
+}
+
+type profilePackH2 struct {
+	Settings     map[string]uint32 `json:"settings"`
+	WindowUpdate uint32            `json:"window_update"`
+}
+
+type profilePackBrowser struct {
+	Brand         string                      `json:"brand"`
+	Family        BrowserFamily               `json:"family"`
+	UASuffix      string                      `json:"ua_suffix,omitempty"`
+	ChromiumBased bool                        `json:"chromium_based,omitempty"`
+	H2            string                      `json:"h2"`
+	Versions      map[int]*profilePackVersion `json:"versions"`
+}
+
+type profilePackVersion struct {
+	BuildNumber   int    `json:"build_number,omitempty"`
+	ChromiumBuild int    `json:"chromium_build,omitempty"`
+	Accept        string `json:"accept"`
+	AcceptXHR     string `json:"accept_xhr"`
+	HelloID       string `json:"hello_id"`
+	GeckoRevision string `json:"gecko_revision,omitempty"`
+	WebKitVersion string `json:"webkit_version,omitempty"`
+	MobileVersion string `json:"mobile_version,omitempty"`
+	SafariVersion string `json:"safari_version,omitempty"`
+	Released      string `json:"released,omitempty"`
+	H2            bool   `json:"h2"`
+}
+
+type profilePackOS struct {
+	Name          string `json:"name"`
+	PlatformToken string `json:"platform_token"`
+	Version       string `json:"version,omitempty"`
+	Arch          string `json:"arch,omitempty"`
+	Bitness       string `json:"bitness,omitempty"`
+	Mobile        bool   `json:"mobile,omitempty"`
+	Tablet        bool   `json:"tablet,omitempty"`
+
+	Versions []profilePackOSVersion `json:"versions,omitempty"`
+}
+
+type profilePackOSVersion struct {
+	Version  string            `json:"version"`
+	Token    string            `json:"token,omitempty"`
+	Released string            `json:"released"`
+	Browsers map[Browser][]int `json:"browsers,omitempty"`
+}
+
+type profilePackDevice struct {
+	Manufacturer string            `json:"manufacturer,omitempty"`
+	Model        string            `json:"model,omitempty"`
+	Platform     Platform          `json:"platform"`
+	OS           []OperatingSystem `json:"os,omitempty"`
+	Android      []int             `json:"android,omitempty"`
+	Builds       map[int]string    `json:"builds,omitempty"`
+	DPR          float64           `json:"dpr"`
+	Screen       [2]int            `json:"screen"`
+	Memory       float64           `json:"memory"`
+}
+
+type profilePackBot struct {
+	UserAgent string            `json:"user_agent"`
+	HelloID   string            `json:"hello_id"`
+	Headers   map[string]string `json:"headers"`
+}
+
+var defaultProfilePack = mustLoadEmbeddedProfilePack()
+
+func mustLoadEmbeddedProfilePack() *ProfilePack {
+	file := newProfilePackFile()
+	if err := file.overlay(embeddedProfilePack); err != nil {
+		panic(err)
+	}
+	pack, err := compileProfilePack(file)
+	if err != nil {
+		panic(err)
+	}
+	return pack
+}
+
+func DefaultProfilePack() *ProfilePack {
+	return defaultProfilePack.withRegistry()
+}
+
+func LoadProfilePack(fsys fs.FS) (*ProfilePack, error) {
+	return defaultProfilePack.Overlay(fsys)
+}
+
+func (p *ProfilePack) Overlay(fsys fs.FS) (*ProfilePack, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: no *.json files found", ErrInvalidProfilePack)
+	}
+	sort.Strings(names)
+
+	file := p.file.clone()
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := file.overlay(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path.Base(name), err)
+		}
+	}
+
+	return compileProfilePack(file)
+}
+
+func (p *ProfilePack) clone() *ProfilePack {
+	return &ProfilePack{
+		Schema:        p.Schema,
+		Revision:      p.Revision,
+		file:          p.file,
+		browsers:      maps.Clone(p.browsers),
+		browserList:   append([]Browser(nil), p.browserList...),
+		os:            maps.Clone(p.os),
+		osList:        append([]OperatingSystem(nil), p.osList...),
+		platforms:     maps.Clone(p.platforms),
+		platformList:  append([]Platform(nil), p.platformList...),
+		devices:       p.devices,
+		deviceList:    p.deviceList,
+		botCategories: p.botCategories,
+		allBots:       p.allBots,
+	}
+}
+
+func (p *ProfilePack) Browsers() []Browser {
+	return append([]Browser(nil), p.browserList...)
+}
+
+func (p *ProfilePack) Versions(b Browser) []int {
+	versions := getVersionKeys(p.browsers[b].Versions)
+	sort.Ints(versions)
+	return versions
+}
+
+func (p *ProfilePack) OSVersions(os OperatingSystem) []OSVersion {
+	return append([]OSVersion(nil), p.os[os].Versions...)
+}
+
+func (p *ProfilePack) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.file)
+}
+
+func newProfilePackFile() *profilePackFile {
+	return &profilePackFile{
+		Schema:         ProfilePackSchema,
+		AcceptPatterns: make(map[string][][]AcceptHeaderPart),
+		H2Profiles:     make(map[string]*profilePackH2),
+		Browsers:       make(map[Browser]*profilePackBrowser),
+		OS:             make(map[OperatingSystem]*profilePackOS),
+		Devices:        make(map[string]*profilePackDevice),
+		Bots:           make(map[string][]profilePackBot),
+	}
+}
+
+func (f *profilePackFile) clone() *profilePackFile {
+	data, _ := json.Marshal(f)
+	c := newProfilePackFile()
+	_ = json.Unmarshal(data, c)
+	return c
+}
+
+func (f *profilePackFile) overlay(data []byte) error {
+	var raw struct {
+		Schema         int                                 `json:"schema"`
+		Revision       string                              `json:"revision"`
+		AcceptPatterns map[string][][]AcceptHeaderPart     `json:"accept_patterns"`
+		H2Profiles     map[string]*profilePackH2           `json:"h2_profiles"`
+		Browsers       map[Browser]json.RawMessage         `json:"browsers"`
+		OS             map[OperatingSystem]json.RawMessage `json:"os"`
+		Devices        map[string]*profilePackDevice       `json:"devices"`
+		Bots           map[string][]profilePackBot         `json:"bots"`
+		Entries        []ProfilePackEntry                  `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProfilePack, err)
+	}
+	if raw.Schema != ProfilePackSchema {
+		return fmt.Errorf("%w: schema %d, want %d", ErrInvalidProfilePack, raw.Schema, ProfilePackSchema)
+	}
+
+	if raw.Revision != "" {
+		f.Revision = raw.Revision
+	}
+	for name, pattern := range raw.AcceptPatterns {
+		f.AcceptPatterns[name] = pattern
+	}
+	for name, h2 := range raw.H2Profiles {
+		f.H2Profiles[name] = h2
+	}
+	for name, msg := range raw.Browsers {
+		b := f.Browsers[name]
+		if b == nil {
+			b = new(profilePackBrowser)
+			f.Browsers[name] = b
+		}
+		if err := json.Unmarshal(msg, b); err != nil {
+			return fmt.Errorf("%w: browser %s: %v", ErrInvalidProfilePack, name, err)
+		}
+	}
+	for name, msg := range raw.OS {
+		o := f.OS[name]
+		if o == nil {
+			o = new(profilePackOS)
+			f.OS[name] = o
+		}
+		if err := json.Unmarshal(msg, o); err != nil {
+			return fmt.Errorf("%w: os %s: %v", ErrInvalidProfilePack, name, err)
+		}
+	}
+	for name, d := range raw.Devices {
+		f.Devices[name] = d
+	}
+	for category, bots := range raw.Bots {
+		f.Bots[category] = bots
+	}
+	for i := range raw.Entries {
+		if err := f.applyEntry(&raw.Entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *profilePackFile) applyEntry(e *ProfilePackEntry) error {
+	b := f.Browsers[e.Browser]
+	if b == nil {
+		return fmt.Errorf("%w: entry for unknown browser %q", ErrInvalidProfilePack, e.Browser)
+	}
+
+	closest := -1
+	for v := range b.Versions {
+		if v <= e.Version && v > closest {
+			closest = v
+		}
+	}
+	if closest == -1 {
+		return fmt.Errorf("%w: %s %d is older than every version in the pack", ErrInvalidProfilePack, e.Browser, e.Version)
+	}
+
+	v := *b.Versions[closest]
+	v.Released = ""
+	if e.HelloID != "" {
+		v.HelloID = e.HelloID
+	}
+	v.H2 = v.H2 || e.H2 != nil
+	if parts := strings.Split(e.FullVersion, "."); b.ChromiumBased && len(parts) == 4 {
+		if build, err := strconv.Atoi(parts[2]); err == nil && build > 0 {
+			v.BuildNumber = build
+		}
+		for _, req := range e.Requests {
+			if m := chromiumBuildRegex.FindStringSubmatch(req.Headers["sec-ch-ua-full-version-list"]); m != nil {
+				v.ChromiumBuild, _ = strconv.Atoi(m[1])
+				break
+			}
+		}
+	}
+	if b.Family == Gecko && e.FullVersion != "" {
+		v.GeckoRevision = e.FullVersion
+	}
+
+	for rt, target := range map[RequestType]*string{RequestTypeNavigate: &v.Accept, RequestTypeXHR: &v.AcceptXHR} {
+		if req := e.Requests[rt]; req != nil && req.Headers["accept"] != "" {
+			name := fmt.Sprintf("%s-%d-%s", e.Browser, e.Version, rt)
+			f.AcceptPatterns[name] = [][]AcceptHeaderPart{parseLanguageHeader(req.Headers["accept"])}
+			*target = name
+		}
+	}
+
+	b.Versions[e.Version] = &v
+	return nil
+}
+
+func compileProfilePack(f *profilePackFile) (*ProfilePack, error) {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidProfilePack, fmt.Sprintf(format, args...))
+	}
+
+	p := &ProfilePack{
+		Schema:        f.Schema,
+		Revision:      f.Revision,
+		file:          f,
+		browsers:      make(map[Browser]BrowserProfile, len(f.Browsers)),
+		os:            make(map[OperatingSystem]OSProfile, len(f.OS)),
+		platforms:     make(map[Platform]PlatformProfile),
+		devices:       make(map[string]Device, len(f.Devices)),
+		botCategories: make(map[string][]botProfile, len(f.Bots)),
+	}
+
+	h2Profiles := make(map[string]map[http2.SettingID]uint32, len(f.H2Profiles))
+	for name, h2 := range f.H2Profiles {
+		settings := make(map[http2.SettingID]uint32, len(h2.Settings))
+		for key, val := range h2.Settings {
+			id, ok := h2SettingIDs[key]
+			if !ok {
+				return nil, invalid("h2 profile %s: unknown setting %q", name, key)
+			}
+			settings[id] = val
+		}
+		h2Profiles[name] = settings
+	}
+
+	for name, b := range f.Browsers {
+		if _, ok := familyPseudoHeaderOrder[b.Family]; !ok {
+			return nil, invalid("browser %s: unknown family %q", name, b.Family)
+		}
+		if b.Brand == "" {
+			return nil, invalid("browser %s: brand is required", name)
+		}
+		settings, ok := h2Profiles[b.H2]
+		if !ok {
+			return nil, invalid("browser %s: unknown h2 profile %q", name, b.H2)
+		}
+		if len(b.Versions) == 0 {
+			return nil, invalid("browser %s: no versions", name)
+		}
+
+		profile := BrowserProfile{
+			Brand:          b.Brand,
+			Family:         b.Family,
+			UASuffix:       b.UASuffix,
+			ChromiumBased:  b.ChromiumBased,
+			Versions:       make(map[int]VersionProfile, len(b.Versions)),
+			H2Settings:     copyH2Settings(settings),
+			H2WindowUpdate: f.H2Profiles[b.H2].WindowUpdate,
+		}
+		for version, v := range b.Versions {
+			helloID, err := parseClientHelloID(v.HelloID)
+			if err != nil {
+				return nil, invalid("browser %s version %d: %v", name, version, err)
+			}
+			accept, ok := f.AcceptPatterns[v.Accept]
+			if !ok {
+				return nil, invalid("browser %s version %d: unknown accept pattern %q", name, version, v.Accept)
+			}
+			acceptXHR, ok := f.AcceptPatterns[v.AcceptXHR]
+			if !ok {
+				return nil, invalid("browser %s version %d: unknown accept pattern %q", name, version, v.AcceptXHR)
+			}
+			var released time.Time
+			if v.Released != "" {
+				if released, err = time.Parse(time.DateOnly, v.Released); err != nil {
+					return nil, invalid("browser %s version %d: invalid release date %q", name, version, v.Released)
+				}
+			}
+			profile.Versions[version] = VersionProfile{
+				BuildNumber:             v.BuildNumber,
+				ChromiumBuild:           v.ChromiumBuild,
+				AcceptHeaderPatterns:    accept,
+				AcceptHeaderPatternsXHR: acceptXHR,
+				TLS:                     TLSProfile{HelloID: helloID},
+				GeckoRevision:           v.GeckoRevision,
+				WebKitVersion:           v.WebKitVersion,
+				MobileVersion:           v.MobileVersion,
+				SafariVersion:           v.SafariVersion,
+				Released:                released,
+				SupportsH2:              v.H2,
+			}
+		}
+		p.browsers[name] = profile
+		p.browserList = append(p.browserList, name)
+	}
+	sort.Slice(p.browserList, func(i, j int) bool { return p.browserList[i] < p.browserList[j] })
+
+	for name, o := range f.OS {
+		if o.Name == "" || o.PlatformToken == "" {
+			return nil, invalid("os %s: name and platform_token are required", name)
+		}
+		versions, err := compileOSVersions(o.Versions)
+		if err != nil {
+			return nil, invalid("os %s: %v", name, err)
+		}
+		if strings.Contains(o.PlatformToken, "{os_version}") && len(versions) == 0 {
+			return nil, invalid("os %s: platform_token uses {os_version} but no versions are listed", name)
+		}
+		p.os[name] = OSProfile{
+			Name:          o.Name,
+			PlatformToken: o.PlatformToken,
+			Version:       o.Version,
+			Arch:          o.Arch,
+			BitnessHint:   o.Bitness,
+			IsMobile:      o.Mobile,
+			IsTablet:      o.Tablet,
+			Versions:      versions,
+		}
+		p.osList = append(p.osList, name)
+	}
+	sort.Slice(p.osList, func(i, j int) bool { return p.osList[i] < p.osList[j] })
+
+	for name, d := range f.Devices {
+		switch {
+		case d.Platform == "":
+			return nil, invalid("device %s: platform is required", name)
+		case d.DPR <= 0 || d.Screen[0] <= 0 || d.Screen[1] <= 0 || d.Memory <= 0:
+			return nil, invalid("device %s: dpr, screen and memory must be positive", name)
+		}
+		for _, o := range d.OS {
+			if _, ok := p.os[o]; !ok {
+				return nil, invalid("device %s: unknown os %q", name, o)
+			}
+		}
+		if len(d.Android) > 0 && !containsOS(d.OS, OSAndroid) && !containsOS(d.OS, osAndroidTablet) {
+			return nil, invalid("device %s: android versions require the android os", name)
+		}
+		supported := make(map[int]bool, len(d.Android))
+		for _, v := range d.Android {
+			if v <= 0 {
+				return nil, invalid("device %s: invalid android version %d", name, v)
+			}
+			supported[v] = true
+		}
+		for v := range d.Builds {
+			if !supported[v] {
+				return nil, invalid("device %s: build for unsupported android version %d", name, v)
+			}
+		}
+		p.devices[name] = Device{
+			Name:            name,
+			Manufacturer:    d.Manufacturer,
+			Model:           d.Model,
+			Platform:        d.Platform,
+			OS:              d.OS,
+			AndroidVersions: d.Android,
+			Builds:          d.Builds,
+			DPR:             d.DPR,
+			ScreenWidth:     d.Screen[0],
+			ScreenHeight:    d.Screen[1],
+			DeviceMemory:    d.Memory,
+		}
+		p.deviceList = append(p.deviceList, name)
+	}
+	sort.Strings(p.deviceList)
+
+	categories := make([]string, 0, len(f.Bots))
+	for category := range f.Bots {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		for _, b := range f.Bots[category] {
+			helloID, err := parseClientHelloID(b.HelloID)
+			if err != nil {
+				return nil, invalid("bot %s: %v", category, err)
+			}
+			if b.UserAgent == "" {
+				return nil, invalid("bot %s: user_agent is required", category)
+			}
+			bot := botProfile{UserAgent: b.UserAgent, HelloID: helloID, Headers: b.Headers}
+			p.botCategories[category] = append(p.botCategories[category], bot)
+			p.allBots = append(p.allBots, bot)
+		}
+	}
+
+	p.applyRegistry()
+	return p, nil
+}
+
+var h2SettingIDs = func() map[string]http2.SettingID {
+	ids := make(map[string]http2.SettingID)
+	for id := http2.SettingHeaderTableSize; id <= http2.SettingEnableConnectProtocol; id++ {
+		ids[id.String()] = id
+	}
+	return ids
+}()
+
+func compileOSVersions(raw []profilePackOSVersion) ([]OSVersion, error) {
+	versions := make([]OSVersion, 0, len(raw))
+	for _, v := range raw {
+		if v.Version == "" {
+			return nil, errors.New("version is required")
+		}
+		released, err := time.Parse(time.DateOnly, v.Released)
+		if err != nil {
+			return nil, fmt.Errorf("version %s: invalid release date %q", v.Version, v.Released)
+		}
+
+		browsers := make(map[Browser][2]int, len(v.Browsers))
+		for b, r := range v.Browsers {
+			if len(r) == 0 || len(r) > 2 || r[0] <= 0 || (len(r) == 2 && r[1] < r[0]) {
+				return nil, fmt.Errorf("version %s: invalid %s range %v", v.Version, b, r)
+			}
+			var bounds [2]int
+			copy(bounds[:], r)
+			browsers[b] = bounds
+		}
+
+		token := v.Token
+		if token == "" {
+			token = v.Version
+		}
+		versions = append(versions, OSVersion{Version: v.Version, Token: token, Released: released, Browsers: browsers})
+	}
+	return versions, nil
+}
+
+func copyH2Settings(settings map[http2.SettingID]uint32) func() map[http2.SettingID]uint32 {
+	return func() map[http2.SettingID]uint32 {
+		c := make(map[http2.SettingID]uint32, len(settings))
+		for id, val := range settings {
+			c[id] = val
+		}
+		return c
+	}
+}
+
+func parseClientHelloID(s string) (utls.ClientHelloID, error) {
+	i := strings.LastIndex(s, "-")
+	if i <= 0 {
+		return utls.ClientHelloID{}, fmt.Errorf("malformed hello_id %q", s)
+	}
+	id := utls.ClientHelloID{Client: s[:i], Version: s[i+1:]}
+	if id == utls.HelloGolang {
+		return id, nil
+	}
+	if _, err := utls.UTLSIdToSpec(id); err != nil {
+		return utls.ClientHelloID{}, fmt.Errorf("unknown hello_id %q", s)
+	}
+	return id, nil
+}
@@ -0,0 +1,157 @@
+package legitagent
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestDefaultProfilePack(t *testing.T) {
+	p := DefaultProfilePack()
+	if p.Schema != ProfilePackSchema || len(p.Browsers()) != len(allRealBrowsers) {
+		t.Fatalf("Unexpected default pack: schema %d, browsers %v", p.Schema, p.Browsers())
+	}
+	if v := p.Versions(BrowserChrome); v[0] != 114 || v[len(v)-1] != 141 {
+		t.Errorf("Unexpected Chrome versions %v", v)
+	}
+	if id := p.browsers[BrowserSafari].Versions[17].TLS.HelloID; id != utls.HelloSafari_16_0 {
+		t.Errorf("Expected Safari 17 to use Safari-16.0, got %s", id.Str())
+	}
+	if len(p.botCategories[BotGoogle]) == 0 || p.os[OSAndroid].PlatformToken == "" {
+		t.Error("Expected bots and OS profiles in the default pack")
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	again, err := LoadProfilePack(fstest.MapFS{"pack.json": {Data: data}})
+	if err != nil {
+		t.Fatalf("Reloading the default pack failed: %v", err)
+	}
+	if len(again.allBots) != len(p.allBots) || len(again.Versions(BrowserEdge)) != len(p.Versions(BrowserEdge)) {
+		t.Error("Expected the default pack to round-trip")
+	}
+}
+
+func TestProfilePackOverlay(t *testing.T) {
+	fsys := fstest.MapFS{
+		"01-chrome.json": {Data: []byte(`{"schema": 1, "revision": "test", "browsers": {"chrome": {"versions": {
+			"142": {"build_number": 7444, "accept": "chrome", "accept_xhr": "xhr", "hello_id": "Chrome-120", "h2": true}
+		}}}}`)},
+		"02-freebsd.json": {Data: []byte(`{"schema": 1, "os": {"freebsd": {"name": "FreeBSD", "platform_token": "X11; FreeBSD amd64"}}}`)},
+		"03-entry.json": {Data: []byte(`{"schema": 1, "entries": [{"browser": "chrome", "version": 143, "full_version": "143.0.7499.4",
+			"hello_id": "Chrome-120", "requests": {"navigate": {"header_order": ["accept"], "headers": {"accept": "text/html,*/*;q=0.8"}}}}]}`)},
+		"README.md": {Data: []byte("ignored")},
+	}
+
+	pack, err := LoadProfilePack(fsys)
+	if err != nil {
+		t.Fatalf("LoadProfilePack failed: %v", err)
+	}
+
+	t.Run("Merged Versions", func(t *testing.T) {
+		if pack.Revision != "test" {
+			t.Errorf("Expected revision from the overlay, got %q", pack.Revision)
+		}
+		versions := pack.Versions(BrowserChrome)
+		if versions[0] != 114 || versions[len(versions)-2] != 142 || versions[len(versions)-1] != 143 {
+			t.Errorf("Expected built-in and overlay versions, got %v", versions)
+		}
+		if len(DefaultProfilePack().Versions(BrowserChrome)) == len(versions) {
+			t.Error("Overlay modified the default pack")
+		}
+
+		vp := pack.browsers[BrowserChrome].Versions[143]
+		if vp.BuildNumber != 7499 || vp.TLS.HelloID != utls.HelloChrome_120 || !vp.SupportsH2 {
+			t.Errorf("Unexpected version from entry: %+v", vp)
+		}
+		if got := buildAcceptHeader(vp.AcceptHeaderPatterns[0]); !strings.HasPrefix(got, "text/html,*/*;q=") {
+			t.Errorf("Unexpected accept header from entry %q", got)
+		}
+	})
+
+	t.Run("Generator", func(t *testing.T) {
+		g := NewGenerator(WithProfilePack(fsys), WithBrowsers(BrowserChrome), WithOS(OSLinux), WithPlatforms(PlatformDesktop), WithVersionRange(142, 142))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if !strings.Contains(agent.UserAgent, "Chrome/142.0.0.0") {
+			t.Errorf("Expected a Chrome 142 agent, got %q", agent.UserAgent)
+		}
+
+		g = NewGenerator(WithProfilePack(fsys), WithBrowsers(BrowserFirefox), WithOS("freebsd"), WithPlatforms(PlatformDesktop))
+		agent, err = g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if !strings.Contains(agent.UserAgent, "(X11; FreeBSD amd64; rv:") {
+			t.Errorf("Expected a FreeBSD agent, got %q", agent.UserAgent)
+		}
+	})
+
+	t.Run("Hot Swap", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithVersionRange(142, 0))
+		if _, err := g.Generate(); err == nil {
+			t.Fatal("Expected no Chrome 142+ in the default pack")
+		}
+
+		g.SetProfilePack(pack)
+		if _, err := g.Generate(); err != nil {
+			t.Fatalf("Generate after swap failed: %v", err)
+		}
+		if g.ProfilePack() != pack {
+			t.Error("Expected the swapped pack to be active")
+		}
+
+		g.SetProfilePack(nil)
+		if g.ProfilePack() != DefaultProfilePack() {
+			t.Error("Expected a nil pack to restore the default")
+		}
+	})
+}
+
+func TestProfilePackErrors(t *testing.T) {
+	cases := map[string]string{
+		"Schema":            `{"schema": 2}`,
+		"Syntax":            `{"schema": 1,`,
+		"HelloID":           `{"schema": 1, "browsers": {"chrome": {"versions": {"150": {"accept": "chrome", "accept_xhr": "xhr", "hello_id": "Chrome-9999"}}}}}`,
+		"Accept":            `{"schema": 1, "browsers": {"chrome": {"versions": {"150": {"accept": "missing", "accept_xhr": "xhr", "hello_id": "Chrome-120"}}}}}`,
+		"Family":            `{"schema": 1, "browsers": {"links": {"brand": "Links", "family": "Text", "h2": "chromium", "versions": {}}}}`,
+		"H2 Setting":        `{"schema": 1, "h2_profiles": {"chromium": {"settings": {"BOGUS": 1}}}}`,
+		"OS":                `{"schema": 1, "os": {"plan9": {"name": "Plan 9"}}}`,
+		"Entry":             `{"schema": 1, "entries": [{"browser": "links", "version": 1}]}`,
+		"Old Entry":         `{"schema": 1, "entries": [{"browser": "chrome", "version": 100}]}`,
+		"Bot HelloID":       `{"schema": 1, "bots": {"GoogleBot": [{"user_agent": "x", "hello_id": "nope"}]}}`,
+		"Device OS":         `{"schema": 1, "devices": {"Nokia 3310": {"platform": "mobile", "os": ["symbian"], "dpr": 1, "screen": [84, 48], "memory": 1}}}`,
+		"Device DPR":        `{"schema": 1, "devices": {"Nokia 3310": {"platform": "mobile", "dpr": 0, "screen": [84, 48], "memory": 1}}}`,
+		"OS Released":       `{"schema": 1, "os": {"ios": {"name": "iOS", "platform_token": "iPhone; CPU iPhone OS {os_version} like Mac OS X", "versions": [{"version": "18.0.0", "released": "soon"}]}}}`,
+		"OS Range":          `{"schema": 1, "os": {"ios": {"name": "iOS", "platform_token": "iPhone; CPU iPhone OS {os_version} like Mac OS X", "versions": [{"version": "18.0.0", "released": "2024-09-16", "browsers": {"safari": [18, 17]}}]}}}`,
+		"OS Token":          `{"schema": 1, "os": {"visionos": {"name": "visionOS", "platform_token": "iPhone; CPU iPhone OS {os_version} like Mac OS X"}}}`,
+		"Device OS Version": `{"schema": 1, "devices": {"Pixel 7": {"model": "Pixel 7", "platform": "mobile", "os": ["android"], "android": [13], "builds": {"14": "AP2A.240805.005"}, "dpr": 2.625, "screen": [412, 915], "memory": 8}}}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadProfilePack(fstest.MapFS{"pack.json": {Data: []byte(data)}}); !errors.Is(err, ErrInvalidProfilePack) {
+				t.Errorf("Expected ErrInvalidProfilePack, got %v", err)
+			}
+		})
+	}
+
+	if _, err := LoadProfilePack(fstest.MapFS{}); !errors.Is(err, ErrInvalidProfilePack) {
+		t.Errorf("Expected ErrInvalidProfilePack for an empty pack, got %v", err)
+	}
+
+	g := NewGenerator(WithProfilePack(fstest.MapFS{"pack.json": {Data: []byte(`{"schema": 2}`)}}))
+	if _, err := g.Generate(); !errors.Is(err, ErrInvalidProfilePack) {
+		t.Errorf("Expected Generate to report the pack error, got %v", err)
+	}
+	if _, err := g.FromUserAgent("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", RequestTypeNavigate); !errors.Is(err, ErrInvalidProfilePack) {
+		t.Errorf("Expected FromUserAgent to report the pack error, got %v", err)
+	}
+}
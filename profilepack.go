@@ -0,0 +1,426 @@
+package legitagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const profilePackServerName = "example.com"
+
+var (
+	ErrNoProfileCaptures    = errors.New("legitagent: no captures with a supported browser User-Agent")
+	ErrMixedProfileCaptures = errors.New("legitagent: captures are from different browsers or versions")
+)
+
+var uaPlatformTokenRegex = regexp.MustCompile(`\([^)]*\)`)
+
+type ProfileCapture struct {
+	Fingerprint
+	RequestType RequestType  `json:"request_type,omitempty"`
+	Headers     []EchoHeader `json:"headers,omitempty"`
+}
+
+type ProfilePackRequest struct {
+	PseudoHeaderOrder []string          `json:"pseudo_header_order,omitempty"`
+	HeaderOrder       []string          `json:"header_order"`
+	Headers           map[string]string `json:"headers,omitempty"`
+}
+
+type ProfilePackEntry struct {
+	Browser     Browser                             `json:"browser"`
+	Family      BrowserFamily                       `json:"family"`
+	Version     int                                 `json:"version"`
+	FullVersion string                              `json:"full_version,omitempty"`
+	UserAgent   string                              `json:"user_agent"`
+	UATemplate  string                              `json:"ua_template"`
+	Requests    map[RequestType]*ProfilePackRequest `json:"requests"`
+	HelloID     string                              `json:"hello_id,omitempty"`
+	TLS         *TLSFingerprint                     `json:"tls,omitempty"`
+	H2          *H2Fingerprint                      `json:"h2,omitempty"`
+}
+
+func ProfileCaptureFromEcho(resp EchoResponse) ProfileCapture {
+	return ProfileCapture{Fingerprint: resp.Fingerprint, Headers: resp.Headers}
+}
+
+func ProfileCaptureFromRecord(rec CaptureRecord) ProfileCapture {
+	return ProfileCapture{Fingerprint: rec.Fingerprint}
+}
+
+func ProfileCapturesFromHAR(entries []HAREntry) []ProfileCapture {
+	captures := make([]ProfileCapture, 0, len(entries))
+	for _, e := range entries {
+		c := ProfileCapture{
+			Fingerprint: Fingerprint{UserAgent: e.Agent.UserAgent, HTTPVersion: e.HTTPVersion},
+			RequestType: e.RequestType,
+		}
+		if e.HTTPVersion != "http/1.1" {
+			c.H2 = &H2Fingerprint{PseudoHeaderOrder: e.Agent.pseudoHeaderOrder()}
+		}
+		for _, h := range e.Agent.HeaderOrder {
+			if strings.HasPrefix(h, ":") {
+				continue
+			}
+			c.HeaderOrder = append(c.HeaderOrder, h)
+			value := e.Agent.Headers.Get(h)
+			if h == "user-agent" {
+				value = e.Agent.UserAgent
+			}
+			c.Headers = append(c.Headers, EchoHeader{Name: h, Value: value})
+		}
+		captures = append(captures, c)
+	}
+	return captures
+}
+
+func ReadProfileCaptures(r io.Reader) ([]ProfileCapture, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		records, err := ReadCapture(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		captures := make([]ProfileCapture, len(records))
+		for i, rec := range records {
+			captures[i] = ProfileCaptureFromRecord(rec)
+		}
+		return captures, nil
+	}
+
+	var probe struct {
+		Log json.RawMessage `json:"log"`
+	}
+	if json.NewDecoder(bytes.NewReader(trimmed)).Decode(&probe) == nil && probe.Log != nil {
+		entries, err := FromHAR(bytes.NewReader(trimmed))
+		if err != nil {
+			return nil, err
+		}
+		return ProfileCapturesFromHAR(entries), nil
+	}
+
+	var captures []ProfileCapture
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var resp EchoResponse
+		if err := dec.Decode(&resp); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("legitagent: could not decode echo capture: %w", err)
+		}
+		captures = append(captures, ProfileCaptureFromEcho(resp))
+	}
+	return captures, nil
+}
+
+func BuildProfilePackEntry(captures ...ProfileCapture) (*ProfilePackEntry, error) {
+	var entry *ProfilePackEntry
+	for _, c := range captures {
+		info, err := ParseUserAgent(c.UserAgent)
+		if err != nil || info.Browser == "" {
+			continue
+		}
+
+		if entry == nil {
+			entry = &ProfilePackEntry{
+				Browser:     info.Browser,
+				Family:      DefaultProfilePack().browsers[info.Browser].Family,
+				Version:     info.Version,
+				FullVersion: info.FullVersion,
+				UserAgent:   c.UserAgent,
+				UATemplate:  userAgentTemplate(c.UserAgent, info.FullVersion),
+				Requests:    make(map[RequestType]*ProfilePackRequest),
+			}
+		} else if info.Browser != entry.Browser || info.Version != entry.Version {
+			return nil, fmt.Errorf("%w: %s %d and %s %d", ErrMixedProfileCaptures, entry.Browser, entry.Version, info.Browser, info.Version)
+		}
+
+		entry.addRequest(c)
+	}
+	if entry == nil {
+		return nil, ErrNoProfileCaptures
+	}
+
+	for _, c := range captures {
+		if entry.TLS == nil && c.TLS != nil {
+			tls := *c.TLS
+			tls.ServerName = ""
+			entry.TLS = &tls
+		}
+		if entry.H2 == nil && c.H2 != nil && len(c.H2.Settings) > 0 {
+			entry.H2 = c.H2
+		}
+	}
+	if entry.TLS != nil {
+		entry.HelloID = matchingHelloID(entry.TLS.JA4)
+	}
+
+	return entry, nil
+}
+
+type ProfilePackEntries struct {
+	Schema  int                 `json:"schema"`
+	Entries []*ProfilePackEntry `json:"entries"`
+}
+
+func NewProfilePackEntries(entries ...*ProfilePackEntry) *ProfilePackEntries {
+	return &ProfilePackEntries{Schema: ProfilePackSchema, Entries: entries}
+}
+
+func ReadProfilePackEntries(r io.Reader) (*ProfilePackEntries, error) {
+	var pack ProfilePackEntries
+	if err := json.NewDecoder(r).Decode(&pack); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfilePack, err)
+	}
+	if pack.Schema != ProfilePackSchema {
+		return nil, fmt.Errorf("%w: schema %d, want %d", ErrInvalidProfilePack, pack.Schema, ProfilePackSchema)
+	}
+	if len(pack.Entries) == 0 {
+		return nil, fmt.Errorf("%w: no entries", ErrInvalidProfilePack)
+	}
+	return &pack, nil
+}
+
+func (e *ProfilePackEntry) addRequest(c ProfileCapture) {
+	headers := make(map[string]string, len(c.Headers))
+	for _, h := range c.Headers {
+		if !hopByHopHeaders[h.Name] && !harSkippedHeaders[h.Name] {
+			headers[h.Name] = h.Value
+		}
+	}
+
+	rt := c.RequestType
+	if rt == "" {
+		h := make(http.Header, len(headers))
+		for k, v := range headers {
+			h.Set(k, v)
+		}
+		rt = requestTypeFromHeaders("", h)
+	}
+
+	if existing := e.Requests[rt]; existing != nil && len(existing.Headers) > 0 {
+		return
+	}
+	if len(c.HeaderOrder) == 0 {
+		return
+	}
+
+	req := &ProfilePackRequest{Headers: headers}
+	if c.H2 != nil {
+		req.PseudoHeaderOrder = c.H2.PseudoHeaderOrder
+	}
+	for _, h := range c.HeaderOrder {
+		if !hopByHopHeaders[h] && (h == "user-agent" || !harSkippedHeaders[h]) && !containsString(req.HeaderOrder, h) {
+			req.HeaderOrder = append(req.HeaderOrder, h)
+		}
+	}
+	if len(req.Headers) == 0 {
+		req.Headers = nil
+	}
+	e.Requests[rt] = req
+}
+
+func userAgentTemplate(ua, fullVersion string) string {
+	template := ua
+	if loc := uaPlatformTokenRegex.FindStringIndex(template); loc != nil {
+		template = template[:loc[0]] + "({platform})" + template[loc[1]:]
+	}
+	if fullVersion != "" {
+		template = strings.ReplaceAll(template, fullVersion, "{full_version}")
+	}
+	return template
+}
+
+func matchingHelloID(ja4 string) string {
+	seen := make(map[string]bool)
+	for _, b := range allRealBrowsers {
+		for _, vp := range DefaultProfilePack().browsers[b].Versions {
+			id := vp.TLS.HelloID
+			if seen[id.Str()] {
+				continue
+			}
+			seen[id.Str()] = true
+
+			hello, err := (&Agent{ClientHelloID: id}).tlsFingerprint(profilePackServerName, h2ALPN)
+			if err == nil && ja4Hashes(hello.JA4) == ja4Hashes(ja4) {
+				return id.Str()
+			}
+		}
+	}
+	return ""
+}
+
+func ja4Hashes(ja4 string) string {
+	if _, hashes, ok := strings.Cut(ja4, "_"); ok {
+		return hashes
+	}
+	return ja4
+}
+
+func PreviousProfilePackEntry(entry *ProfilePackEntry) (*ProfilePackEntry, error) {
+	info, err := ParseUserAgent(entry.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	pack := DefaultProfilePack()
+	profile, ok := pack.browsers[entry.Browser]
+	if !ok {
+		return nil, ErrUnsupportedBrowser
+	}
+	osProf, ok := pack.os[info.profileOS]
+	if !ok {
+		return nil, ErrUnsupportedOS
+	}
+	platform := PlatformDesktop
+	if info.Platform == PlatformMobile {
+		platform = PlatformMobile
+	}
+	platformProf := platformProfiles[platform]
+
+	versionProf, version, err := findClosestVersionProfile(profile.Versions, entry.Version-1)
+	if err != nil {
+		return nil, err
+	}
+
+	fullVersion := ""
+	if profile.ChromiumBased {
+		fullVersion = fmt.Sprintf("%d.0.%d.0", version, versionProf.BuildNumber)
+	}
+	ua := buildUserAgent(profile, osProf, platformProf, versionProf, fullVersion)
+
+	var captures []ProfileCapture
+	for _, rt := range []RequestType{RequestTypeNavigate, RequestTypeSubresource, RequestTypeXHR} {
+		headers, order := buildStaticHeaders(profile, osProf, platformProf, version, fullVersion, versionProf, rt)
+		c := ProfileCapture{RequestType: rt}
+		c.UserAgent = ua
+		c.H2 = &H2Fingerprint{}
+		for _, h := range order {
+			if strings.HasPrefix(h, ":") {
+				c.H2.PseudoHeaderOrder = append(c.H2.PseudoHeaderOrder, h)
+				continue
+			}
+			c.HeaderOrder = append(c.HeaderOrder, h)
+			c.Headers = append(c.Headers, EchoHeader{Name: h, Value: headers.Get(h)})
+		}
+		c.HeaderOrder = insertByPriority(c.HeaderOrder, "user-agent")
+		c.Headers = append(c.Headers, EchoHeader{Name: "user-agent", Value: ua})
+		captures = append(captures, c)
+	}
+
+	agent := &Agent{ClientHelloID: versionProf.TLS.HelloID}
+	if versionProf.TLS.ClientSpec != nil {
+		agent.ClientHelloSpec = versionProf.TLS.ClientSpec()
+	}
+	if versionProf.SupportsH2 {
+		agent.H2Settings = profile.H2Settings()
+	}
+	hello, err := agent.tlsFingerprint(profilePackServerName, agent.alpn())
+	if err != nil {
+		return nil, err
+	}
+	captures[0].TLS = hello
+	if versionProf.SupportsH2 {
+		captures[0].H2 = NewH2Fingerprint(orderedH2Settings(profile.H2Settings()), profile.H2WindowUpdate, nil, familyPseudoHeaderOrder[profile.Family])
+	}
+
+	return BuildProfilePackEntry(captures...)
+}
+
+func DiffProfilePackEntries(a, b *ProfilePackEntry) *AgentDiff {
+	d := &AgentDiff{}
+	add := func(name string, entries []DiffEntry) {
+		if len(entries) > 0 {
+			d.Layers = append(d.Layers, DiffLayer{Name: name, Entries: entries})
+		}
+	}
+
+	var version []DiffEntry
+	if a.Browser != b.Browser {
+		version = append(version, DiffEntry{Field: "browser", Kind: DiffChanged, A: string(a.Browser), B: string(b.Browser)})
+	}
+	if a.Version != b.Version {
+		version = append(version, DiffEntry{Field: "version", Kind: DiffChanged, A: strconv.Itoa(a.Version), B: strconv.Itoa(b.Version)})
+	}
+	add("version", version)
+	add("user-agent", diffUserAgents(a.UATemplate, b.UATemplate))
+
+	var types []string
+	for rt := range a.Requests {
+		types = append(types, string(rt))
+	}
+	for rt := range b.Requests {
+		if a.Requests[rt] == nil {
+			types = append(types, string(rt))
+		}
+	}
+	sort.Strings(types)
+
+	var requests []DiffEntry
+	for _, name := range types {
+		ra, rb := a.Requests[RequestType(name)], b.Requests[RequestType(name)]
+		switch {
+		case ra == nil:
+			requests = append(requests, DiffEntry{Field: "request", Kind: DiffAdded, B: name})
+			continue
+		case rb == nil:
+			requests = append(requests, DiffEntry{Field: "request", Kind: DiffRemoved, A: name})
+			continue
+		}
+
+		add(name+" header-set", diffSets("header", ra.HeaderOrder, rb.HeaderOrder))
+		add(name+" header-order", diffOrder(ra.HeaderOrder, rb.HeaderOrder))
+		if ra.Headers != nil && rb.Headers != nil {
+			add(name+" header-values", diffValues(ra.Headers, rb.Headers, ra.HeaderOrder, rb.HeaderOrder))
+		}
+		if pa, pb := strings.Join(ra.PseudoHeaderOrder, ","), strings.Join(rb.PseudoHeaderOrder, ","); pa != pb {
+			add(name+" pseudo-header-order", []DiffEntry{{Field: "pseudo-header order", Kind: DiffChanged, A: pa, B: pb}})
+		}
+	}
+	add("requests", requests)
+
+	if a.TLS != nil && b.TLS != nil {
+		tls := diffClientHellos(a.TLS, b.TLS)
+		if a.HelloID != b.HelloID {
+			tls = append(tls, DiffEntry{Field: "hello id", Kind: DiffChanged, A: a.HelloID, B: b.HelloID})
+		}
+		add("tls", tls)
+	}
+	if a.H2 != nil && b.H2 != nil {
+		add("h2", diffH2Fingerprints(a.H2, b.H2))
+	}
+
+	return d
+}
+
+func diffH2Fingerprints(a, b *H2Fingerprint) []DiffEntry {
+	settings := func(f *H2Fingerprint) map[string]string {
+		values := make(map[string]string, len(f.Settings))
+		for _, s := range f.Settings {
+			values[s.ID.String()] = strconv.FormatUint(uint64(s.Val), 10)
+		}
+		return values
+	}
+
+	settingsA, settingsB := settings(a), settings(b)
+	entries := diffValues(settingsA, settingsB, sortedKeys(settingsA), sortedKeys(settingsB))
+
+	if a.WindowUpdate != b.WindowUpdate {
+		entries = append(entries, DiffEntry{Field: "window update", Kind: DiffChanged, A: strconv.FormatUint(uint64(a.WindowUpdate), 10), B: strconv.FormatUint(uint64(b.WindowUpdate), 10)})
+	}
+	if pa, pb := strings.Join(a.PseudoHeaderOrder, ","), strings.Join(b.PseudoHeaderOrder, ","); pa != pb {
+		entries = append(entries, DiffEntry{Field: "pseudo-header order", Kind: DiffChanged, A: pa, B: pb})
+	}
+	return entries
+}
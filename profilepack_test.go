@@ -0,0 +1,187 @@
+package legitagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func echoProfileCaptures(t *testing.T, agent *Agent) []byte {
+	t.Helper()
+
+	s, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("NewEchoServer failed: %v", err)
+	}
+	defer s.Close()
+
+	client := &http.Client{Transport: &Transport{Agent: agent, InsecureSkipVerify: true}}
+	var buf bytes.Buffer
+	for _, path := range []string{"/", "/api"} {
+		resp, err := client.Get(strings.Replace(s.URL, "127.0.0.1", "localhost", 1) + path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var echo EchoResponse
+		err = json.NewDecoder(resp.Body).Decode(&echo)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode echo response: %v", err)
+		}
+		_ = json.NewEncoder(&buf).Encode(echo)
+	}
+	return buf.Bytes()
+}
+
+func TestBuildProfilePackEntry(t *testing.T) {
+	g := NewGenerator(WithBrowsers(BrowserChrome), WithVersionRange(141, 141), WithOS(OSWindows11), WithPlatforms(PlatformDesktop))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	captures, err := ReadProfileCaptures(bytes.NewReader(echoProfileCaptures(t, agent)))
+	if err != nil {
+		t.Fatalf("ReadProfileCaptures failed: %v", err)
+	}
+	entry, err := BuildProfilePackEntry(captures...)
+	if err != nil {
+		t.Fatalf("BuildProfilePackEntry failed: %v", err)
+	}
+
+	t.Run("Entry", func(t *testing.T) {
+		if entry.Browser != BrowserChrome || entry.Version != 141 || entry.Family != Chromium {
+			t.Errorf("Unexpected entry identity: %s %d %s", entry.Browser, entry.Version, entry.Family)
+		}
+		if !strings.Contains(entry.UATemplate, "({platform})") || !strings.Contains(entry.UATemplate, "Chrome/{full_version}") {
+			t.Errorf("Unexpected UA template %q", entry.UATemplate)
+		}
+		if entry.HelloID != "Chrome-120" {
+			t.Errorf("Expected Chrome-120 ClientHelloID, got %q", entry.HelloID)
+		}
+
+		want, err := agent.Fingerprint("example.com")
+		if err != nil {
+			t.Fatalf("Fingerprint failed: %v", err)
+		}
+		if entry.TLS == nil || entry.TLS.JA4 != want.TLS.JA4 || entry.TLS.ServerName != "" {
+			t.Errorf("Unexpected TLS fingerprint: %+v", entry.TLS)
+		}
+		if entry.H2 == nil || entry.H2.Akamai != want.H2.Akamai {
+			t.Errorf("Unexpected H2 fingerprint: %+v", entry.H2)
+		}
+
+		req := entry.Requests[RequestTypeNavigate]
+		if req == nil {
+			t.Fatalf("Expected a navigate request, got %v", entry.Requests)
+		}
+		if !reflect.DeepEqual(req.PseudoHeaderOrder, familyPseudoHeaderOrder[Chromium]) {
+			t.Errorf("Unexpected pseudo-header order %v", req.PseudoHeaderOrder)
+		}
+		if req.Headers["sec-fetch-mode"] != "navigate" || !containsString(req.HeaderOrder, "user-agent") {
+			t.Errorf("Unexpected navigate request: %+v", req)
+		}
+	})
+
+	t.Run("Diff Against Previous", func(t *testing.T) {
+		prev, err := PreviousProfilePackEntry(entry)
+		if err != nil {
+			t.Fatalf("PreviousProfilePackEntry failed: %v", err)
+		}
+		if prev.Version != 140 || prev.HelloID != "Chrome-120" || len(prev.Requests) != 3 {
+			t.Errorf("Unexpected previous entry: %d %q %d requests", prev.Version, prev.HelloID, len(prev.Requests))
+		}
+
+		d := DiffProfilePackEntries(prev, entry)
+		if l := d.Layer("version"); l == nil || l.Entries[0].A != "140" || l.Entries[0].B != "141" {
+			t.Errorf("Expected a version change, got %+v", l)
+		}
+		if d.Layer("tls") != nil || d.Layer("h2") != nil {
+			t.Errorf("Expected identical network fingerprints, got:\n%s", d)
+		}
+		if d.Layer("user-agent") != nil {
+			t.Errorf("Expected identical UA templates, got:\n%s", d)
+		}
+		if !DiffProfilePackEntries(entry, entry).Empty() {
+			t.Error("Expected an entry to have no differences with itself")
+		}
+	})
+
+	t.Run("Load As Profile Pack", func(t *testing.T) {
+		data, err := json.MarshalIndent(NewProfilePackEntries(entry), "", "  ")
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		read, err := ReadProfilePackEntries(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadProfilePackEntries failed: %v", err)
+		}
+		if len(read.Entries) != 1 || !DiffProfilePackEntries(entry, read.Entries[0]).Empty() {
+			t.Errorf("Expected the entry to round-trip, got %+v", read.Entries)
+		}
+
+		fsys := fstest.MapFS{"chrome-141.json": {Data: data}}
+		pack, err := LoadProfilePack(fsys)
+		if err != nil {
+			t.Fatalf("LoadProfilePack failed: %v", err)
+		}
+		vp := pack.browsers[BrowserChrome].Versions[141]
+		if got := buildAcceptHeader(vp.AcceptHeaderPatterns[0]); !strings.HasPrefix(got, "text/html,application/xhtml+xml,application/xml;q=") {
+			t.Errorf("Unexpected accept header from entry %q", got)
+		}
+
+		g := NewGenerator(WithProfilePack(fsys), WithBrowsers(BrowserChrome), WithVersionRange(141, 141), WithOS(OSWindows11), WithPlatforms(PlatformDesktop))
+		a, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(a)
+		if a.ClientHelloID != utls.HelloChrome_120 {
+			t.Errorf("Expected the entry's ClientHelloID, got %v", a.ClientHelloID)
+		}
+
+		if _, err := ReadProfilePackEntries(strings.NewReader(`{"browser": "chrome", "version": 141}`)); !errors.Is(err, ErrInvalidProfilePack) {
+			t.Errorf("Expected ErrInvalidProfilePack for a bare entry, got %v", err)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := BuildProfilePackEntry(); !errors.Is(err, ErrNoProfileCaptures) {
+			t.Errorf("Expected ErrNoProfileCaptures, got %v", err)
+		}
+
+		firefox := ProfileCapture{Fingerprint: Fingerprint{UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"}}
+		if _, err := BuildProfilePackEntry(append(captures, firefox)...); !errors.Is(err, ErrMixedProfileCaptures) {
+			t.Errorf("Expected ErrMixedProfileCaptures, got %v", err)
+		}
+	})
+}
+
+func TestProfileCapturesFromHAR(t *testing.T) {
+	captures, err := ReadProfileCaptures(strings.NewReader(testHAR))
+	if err != nil {
+		t.Fatalf("ReadProfileCaptures failed: %v", err)
+	}
+	entry, err := BuildProfilePackEntry(captures[:2]...)
+	if err != nil {
+		t.Fatalf("BuildProfilePackEntry failed: %v", err)
+	}
+
+	if entry.TLS != nil || entry.H2 != nil {
+		t.Error("Expected HAR captures to carry no network fingerprint")
+	}
+	if entry.Requests[RequestTypeNavigate] == nil || entry.Requests[RequestTypeXHR] == nil {
+		t.Fatalf("Expected navigate and xhr requests, got %v", entry.Requests)
+	}
+	if got := entry.Requests[RequestTypeNavigate].HeaderOrder; got[0] != "sec-ch-ua" || containsString(got, "cookie") {
+		t.Errorf("Unexpected header order %v", got)
+	}
+}
@@ -0,0 +1,10 @@
+package legitagent
+
+import "math/rand/v2"
+
+func randomChoice[T any](items []T) T {
+	if len(items) == 0 {
+		panic("legitagent: cannot choose from an empty slice")
+	}
+	return items[rand.IntN(len(items))]
+}
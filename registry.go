@@ -0,0 +1,354 @@
+package legitagent
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+var (
+	ErrInvalidProfile = errors.New("legitagent: invalid profile")
+	ErrProfileExists  = errors.New("legitagent: profile already registered")
+)
+
+type registeredBrowser struct {
+	name    Browser
+	profile BrowserProfile
+	pattern *regexp.Regexp
+}
+
+type registeredVersion struct {
+	browser Browser
+	version int
+	profile VersionProfile
+}
+
+type registeredOS struct {
+	name    OperatingSystem
+	profile OSProfile
+	token   string
+}
+
+type registeredPlatform struct {
+	name    Platform
+	profile PlatformProfile
+}
+
+var registry struct {
+	sync.RWMutex
+	gen       atomic.Uint64
+	browsers  []registeredBrowser
+	versions  []registeredVersion
+	os        []registeredOS
+	platforms []registeredPlatform
+}
+
+func RegisterBrowser(name Browser, profile BrowserProfile) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: browser %s: %s", ErrInvalidProfile, name, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case name == "" || name == BrowserRandom:
+		return invalid("name is reserved")
+	case profile.Brand == "":
+		return invalid("brand is required")
+	case profile.H2Settings == nil:
+		return invalid("H2Settings is required")
+	case len(profile.Versions) == 0:
+		return invalid("no versions")
+	}
+	if _, ok := familyPseudoHeaderOrder[profile.Family]; !ok {
+		return invalid("unknown family %q", profile.Family)
+	}
+
+	var pattern *regexp.Regexp
+	if profile.UASuffix != "" {
+		if strings.Count(profile.UASuffix, "%s") != 1 {
+			return invalid("UASuffix must contain exactly one %%s")
+		}
+		pattern = regexp.MustCompile(strings.Replace(regexp.QuoteMeta(profile.UASuffix), "%s", `(\d+(?:\.\d+)*)`, 1))
+	}
+
+	versions := make(map[int]VersionProfile, len(profile.Versions))
+	for v, vp := range profile.Versions {
+		if err := validateVersionProfile(profile.Family, v, vp); err != nil {
+			return invalid("%v", err)
+		}
+		versions[v] = vp
+	}
+	profile.Versions = versions
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := lookupBrowserLocked(name); ok {
+		return fmt.Errorf("%w: browser %s", ErrProfileExists, name)
+	}
+	registry.browsers = append(registry.browsers, registeredBrowser{name: name, profile: profile, pattern: pattern})
+	registry.gen.Add(1)
+	return nil
+}
+
+func RegisterVersion(browser Browser, version int, profile VersionProfile) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	bp, ok := lookupBrowserLocked(browser)
+	if !ok {
+		return fmt.Errorf("%w: unknown browser %s", ErrInvalidProfile, browser)
+	}
+	if err := validateVersionProfile(bp.Family, version, profile); err != nil {
+		return fmt.Errorf("%w: browser %s: %v", ErrInvalidProfile, browser, err)
+	}
+	if _, ok := bp.Versions[version]; ok {
+		return fmt.Errorf("%w: browser %s version %d", ErrProfileExists, browser, version)
+	}
+
+	registry.versions = append(registry.versions, registeredVersion{browser: browser, version: version, profile: profile})
+	registry.gen.Add(1)
+	return nil
+}
+
+func RegisterOS(name OperatingSystem, profile OSProfile) error {
+	switch {
+	case name == "" || name == OSRandom || name == OSMac:
+		return fmt.Errorf("%w: os %s: name is reserved", ErrInvalidProfile, name)
+	case profile.Name == "" || profile.PlatformToken == "":
+		return fmt.Errorf("%w: os %s: Name and PlatformToken are required", ErrInvalidProfile, name)
+	case strings.Contains(profile.PlatformToken, "{os_version}") && len(profile.Versions) == 0:
+		return fmt.Errorf("%w: os %s: PlatformToken uses {os_version} but Versions is empty", ErrInvalidProfile, name)
+	}
+
+	token, _, _ := strings.Cut(profile.PlatformToken, "{")
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := defaultProfilePack.os[name]; ok || containsRegisteredOS(name) {
+		return fmt.Errorf("%w: os %s", ErrProfileExists, name)
+	}
+	registry.os = append(registry.os, registeredOS{name: name, profile: profile, token: "(" + token})
+	registry.gen.Add(1)
+	return nil
+}
+
+func RegisterPlatform(name Platform, profile PlatformProfile) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: platform %s: %s", ErrInvalidProfile, name, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case name == "" || name == PlatformRandom:
+		return invalid("name is reserved")
+	case profile.MobileHint != "?0" && profile.MobileHint != "?1":
+		return invalid("MobileHint must be ?0 or ?1")
+	case len(profile.ComponentGenerators) == 0:
+		return invalid("no component generators")
+	}
+	for family, generators := range profile.ComponentGenerators {
+		if _, ok := familyPseudoHeaderOrder[family]; !ok {
+			return invalid("unknown family %q", family)
+		}
+		if len(generators) == 0 {
+			return invalid("no component generators for %s", family)
+		}
+		for _, gen := range generators {
+			if gen == nil {
+				return invalid("nil component generator for %s", family)
+			}
+		}
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := platformProfiles[name]; ok || containsRegisteredPlatform(name) {
+		return fmt.Errorf("%w: platform %s", ErrProfileExists, name)
+	}
+	registry.platforms = append(registry.platforms, registeredPlatform{name: name, profile: profile})
+	registry.gen.Add(1)
+	return nil
+}
+
+func validateVersionProfile(family BrowserFamily, version int, vp VersionProfile) error {
+	switch {
+	case version <= 0:
+		return fmt.Errorf("version %d must be positive", version)
+	case vp.TLS.HelloID.Client == "" && vp.TLS.ClientSpec == nil:
+		return fmt.Errorf("version %d: TLS HelloID or ClientSpec is required", version)
+	case len(vp.AcceptHeaderPatterns) == 0 || len(vp.AcceptHeaderPatternsXHR) == 0:
+		return fmt.Errorf("version %d: accept header patterns are required", version)
+	}
+	if vp.TLS.ClientSpec == nil && vp.TLS.HelloID != utls.HelloGolang {
+		if _, err := utls.UTLSIdToSpec(vp.TLS.HelloID); err != nil {
+			return fmt.Errorf("version %d: unknown HelloID %s", version, vp.TLS.HelloID.Str())
+		}
+	}
+
+	switch family {
+	case Chromium:
+		if vp.BuildNumber <= 0 {
+			return fmt.Errorf("version %d: BuildNumber is required for Chromium", version)
+		}
+	case Gecko:
+		if vp.GeckoRevision == "" {
+			return fmt.Errorf("version %d: GeckoRevision is required for Gecko", version)
+		}
+	case WebKit:
+		if vp.WebKitVersion == "" || vp.SafariVersion == "" {
+			return fmt.Errorf("version %d: WebKitVersion and SafariVersion are required for WebKit", version)
+		}
+	}
+	return nil
+}
+
+func lookupBrowserLocked(name Browser) (BrowserProfile, bool) {
+	bp, ok := defaultProfilePack.browsers[name]
+	if !ok {
+		for _, b := range registry.browsers {
+			if b.name == name {
+				bp, ok = b.profile, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return bp, false
+	}
+
+	versions := maps.Clone(bp.Versions)
+	for _, v := range registry.versions {
+		if v.browser == name {
+			versions[v.version] = v.profile
+		}
+	}
+	bp.Versions = versions
+	return bp, true
+}
+
+func containsRegisteredOS(name OperatingSystem) bool {
+	for _, o := range registry.os {
+		if o.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRegisteredPlatform(name Platform) bool {
+	for _, p := range registry.platforms {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ProfilePack) platform(name Platform) (PlatformProfile, bool) {
+	if profile, ok := platformProfiles[name]; ok {
+		return profile, true
+	}
+	profile, ok := p.platforms[name]
+	return profile, ok
+}
+
+func (p *ProfilePack) platformNames() []Platform {
+	return append(append([]Platform(nil), allRealPlatforms...), p.platformList...)
+}
+
+func (p *ProfilePack) withRegistry() *ProfilePack {
+	gen := registry.gen.Load()
+	if p.registryGen == gen {
+		return p
+	}
+	if c := p.registered.Load(); c != nil && c.registryGen == gen {
+		return c
+	}
+
+	c := p.clone()
+	c.applyRegistry()
+	p.registered.Store(c)
+	return c
+}
+
+func (p *ProfilePack) applyRegistry() {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, b := range registry.browsers {
+		if _, ok := p.browsers[b.name]; !ok {
+			p.addBrowser(b.name, b.profile)
+		}
+	}
+	for _, v := range registry.versions {
+		p.addVersion(v.browser, v.version, v.profile)
+	}
+	for _, o := range registry.os {
+		if _, ok := p.os[o.name]; !ok {
+			p.addOS(o.name, o.profile)
+		}
+	}
+	for _, pl := range registry.platforms {
+		if _, ok := p.platforms[pl.name]; !ok {
+			p.platforms[pl.name] = pl.profile
+			p.platformList = append(p.platformList, pl.name)
+		}
+	}
+	p.registryGen = registry.gen.Load()
+}
+
+func (p *ProfilePack) addBrowser(name Browser, profile BrowserProfile) {
+	profile.Versions = maps.Clone(profile.Versions)
+	p.browsers[name] = profile
+	p.browserList = append(p.browserList, name)
+	sort.Slice(p.browserList, func(i, j int) bool { return p.browserList[i] < p.browserList[j] })
+}
+
+func (p *ProfilePack) addVersion(browser Browser, version int, profile VersionProfile) {
+	if bp, ok := p.browsers[browser]; ok {
+		bp.Versions = maps.Clone(bp.Versions)
+		bp.Versions[version] = profile
+		p.browsers[browser] = bp
+	}
+}
+
+func (p *ProfilePack) addOS(name OperatingSystem, profile OSProfile) {
+	p.os[name] = profile
+	p.osList = append(p.osList, name)
+	sort.Slice(p.osList, func(i, j int) bool { return p.osList[i] < p.osList[j] })
+}
+
+func detectRegisteredBrowser(ua string) (Browser, BrowserFamily, string) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, b := range registry.browsers {
+		if b.pattern == nil {
+			continue
+		}
+		if m := b.pattern.FindStringSubmatch(ua); len(m) > 1 {
+			return b.name, b.profile.Family, m[1]
+		}
+	}
+	return "", "", ""
+}
+
+func detectRegisteredOS(ua string) (OperatingSystem, bool, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, o := range registry.os {
+		if strings.Contains(ua, o.token) {
+			return o.name, o.profile.IsMobile, true
+		}
+	}
+	return "", false, false
+}
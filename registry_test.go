@@ -0,0 +1,244 @@
+package legitagent
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func resetRegistryOnCleanup(t *testing.T) {
+	t.Helper()
+
+	t.Cleanup(func() {
+		registry.Lock()
+		defer registry.Unlock()
+
+		registry.browsers, registry.versions, registry.os, registry.platforms = nil, nil, nil, nil
+		registry.gen.Add(1)
+	})
+}
+
+func testChromiumVersion() VersionProfile {
+	chrome := DefaultProfilePack().browsers[BrowserChrome].Versions[133]
+	return VersionProfile{
+		BuildNumber:             7000,
+		AcceptHeaderPatterns:    chrome.AcceptHeaderPatterns,
+		AcceptHeaderPatternsXHR: chrome.AcceptHeaderPatternsXHR,
+		TLS:                     TLSProfile{HelloID: utls.HelloChrome_133},
+		SupportsH2:              true,
+	}
+}
+
+func TestRegisterBrowser(t *testing.T) {
+	resetRegistryOnCleanup(t)
+
+	const browser Browser = "internal"
+	err := RegisterBrowser(browser, BrowserProfile{
+		Brand:         "Internal Browser",
+		Family:        Chromium,
+		UASuffix:      "Internal/%s",
+		ChromiumBased: true,
+		H2Settings:    GetChromiumH2Settings,
+		Versions:      map[int]VersionProfile{200: testChromiumVersion()},
+	})
+	if err != nil {
+		t.Fatalf("RegisterBrowser failed: %v", err)
+	}
+	if err := RegisterVersion(browser, 201, testChromiumVersion()); err != nil {
+		t.Fatalf("RegisterVersion failed: %v", err)
+	}
+
+	g := NewGenerator(WithBrowsers(browser), WithPlatforms(PlatformDesktop), WithVersionRange(201, 201))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(agent.UserAgent, "Chrome/201.0.0.0") || !strings.HasSuffix(agent.UserAgent, "Internal/201.0.0.0") {
+		t.Errorf("Unexpected user agent %q", agent.UserAgent)
+	}
+	if !strings.Contains(agent.Headers.Get("sec-ch-ua"), `"Internal Browser";v="201"`) {
+		t.Errorf("Expected the registered brand in sec-ch-ua, got %q", agent.Headers.Get("sec-ch-ua"))
+	}
+
+	info, err := ParseUserAgent(agent.UserAgent)
+	if err != nil || info.Browser != browser || info.Version != 201 {
+		t.Errorf("Expected the parser to detect the registered browser, got %+v (%v)", info, err)
+	}
+	if _, err := FromUserAgentString(agent.UserAgent, RequestTypeNavigate); err != nil {
+		t.Errorf("FromUserAgentString failed: %v", err)
+	}
+	g.ReleaseAgent(agent)
+
+	pack, err := LoadProfilePack(fstest.MapFS{"pack.json": {Data: []byte(`{"schema": 1}`)}})
+	if err != nil {
+		t.Fatalf("LoadProfilePack failed: %v", err)
+	}
+	if v := pack.Versions(browser); len(v) != 2 {
+		t.Errorf("Expected compiled packs to include registered versions, got %v", v)
+	}
+}
+
+func TestRegisterOSAndPlatform(t *testing.T) {
+	resetRegistryOnCleanup(t)
+
+	if err := RegisterOS("freebsd", OSProfile{Name: "FreeBSD", PlatformToken: "X11; FreeBSD amd64", Arch: "x86", BitnessHint: "64"}); err != nil {
+		t.Fatalf("RegisterOS failed: %v", err)
+	}
+	err := RegisterPlatform("kiosk", PlatformProfile{MobileHint: "?0", ComponentGenerators: map[BrowserFamily][]UAComponentGenerator{
+		Gecko: {MozillaGenerator, FirefoxOSGenerator, GeckoTrailGenerator, FirefoxVersionGenerator},
+	}})
+	if err != nil {
+		t.Fatalf("RegisterPlatform failed: %v", err)
+	}
+
+	g := NewGenerator(WithBrowsers(BrowserFirefox), WithOS("freebsd"), WithPlatforms("kiosk"))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(agent.UserAgent, "(X11; FreeBSD amd64; rv:") {
+		t.Errorf("Expected a FreeBSD agent, got %q", agent.UserAgent)
+	}
+
+	info, err := ParseUserAgent(agent.UserAgent)
+	if err != nil || info.OS != "freebsd" || info.Platform != PlatformDesktop {
+		t.Errorf("Expected the parser to detect the registered OS, got %+v (%v)", info, err)
+	}
+	g.ReleaseAgent(agent)
+
+	if _, err := NewGenerator(WithBrowsers(BrowserChrome), WithPlatforms("kiosk")).Generate(); err == nil {
+		t.Error("Expected no combos for a family without kiosk generators")
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	resetRegistryOnCleanup(t)
+
+	noBuild := testChromiumVersion()
+	noBuild.BuildNumber = 0
+	badHello := testChromiumVersion()
+	badHello.TLS.HelloID = utls.ClientHelloID{Client: "Chrome", Version: "9999"}
+
+	valid := BrowserProfile{Brand: "X", Family: Chromium, H2Settings: GetChromiumH2Settings, Versions: map[int]VersionProfile{1: testChromiumVersion()}}
+	withVersion := func(vp VersionProfile) BrowserProfile {
+		b := valid
+		b.Versions = map[int]VersionProfile{1: vp}
+		return b
+	}
+	withFamily := func(f BrowserFamily) BrowserProfile {
+		b := valid
+		b.Family = f
+		return b
+	}
+
+	invalid := map[string]error{
+		"Reserved":     RegisterBrowser(BrowserRandom, valid),
+		"Family":       RegisterBrowser("x", withFamily("Blink")),
+		"Gecko":        RegisterBrowser("x", withFamily(Gecko)),
+		"BuildNumber":  RegisterBrowser("x", withVersion(noBuild)),
+		"HelloID":      RegisterBrowser("x", withVersion(badHello)),
+		"Suffix":       RegisterBrowser("x", BrowserProfile{Brand: "X", Family: Chromium, UASuffix: "X", H2Settings: GetChromiumH2Settings, Versions: valid.Versions}),
+		"No Versions":  RegisterBrowser("x", BrowserProfile{Brand: "X", Family: Chromium, H2Settings: GetChromiumH2Settings}),
+		"Version":      RegisterVersion("nope", 1, testChromiumVersion()),
+		"OS":           RegisterOS("plan9", OSProfile{Name: "Plan 9"}),
+		"Mobile Hint":  RegisterPlatform("watch", PlatformProfile{MobileHint: "yes"}),
+		"No Generator": RegisterPlatform("watch", PlatformProfile{MobileHint: "?1"}),
+	}
+	for name, err := range invalid {
+		if !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("%s: expected ErrInvalidProfile, got %v", name, err)
+		}
+	}
+
+	exists := map[string]error{
+		"Browser":  RegisterBrowser(BrowserChrome, valid),
+		"Version":  RegisterVersion(BrowserChrome, 133, testChromiumVersion()),
+		"OS":       RegisterOS(OSLinux, OSProfile{Name: "Linux", PlatformToken: "X11; Linux x86_64"}),
+		"Platform": RegisterPlatform(PlatformMobile, platformProfiles[PlatformMobile]),
+	}
+	for name, err := range exists {
+		if !errors.Is(err, ErrProfileExists) {
+			t.Errorf("%s: expected ErrProfileExists, got %v", name, err)
+		}
+	}
+}
+
+func TestRegisterConcurrentWithProfilePack(t *testing.T) {
+	resetRegistryOnCleanup(t)
+
+	packed := NewGenerator(WithProfilePack(fstest.MapFS{"pack.json": {Data: []byte(`{"schema": 1}`)}}), WithBrowsers(BrowserChrome))
+	plain := NewGenerator(WithBrowsers(BrowserChrome))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for _, g := range []*Generator{packed, plain} {
+					agent, err := g.Generate()
+					if err != nil {
+						t.Errorf("Generate failed: %v", err)
+						return
+					}
+					g.ReleaseAgent(agent)
+				}
+			}
+		}()
+	}
+	for v := 300; v < 320; v++ {
+		if err := RegisterVersion(BrowserChrome, v, testChromiumVersion()); err != nil {
+			t.Fatalf("RegisterVersion failed: %v", err)
+		}
+	}
+	if err := RegisterOS("haiku", OSProfile{Name: "Haiku", PlatformToken: "X11; Haiku x86_64", Arch: "x86", BitnessHint: "64"}); err != nil {
+		t.Fatalf("RegisterOS failed: %v", err)
+	}
+	wg.Wait()
+
+	if v := packed.ProfilePack().Versions(BrowserChrome); v[len(v)-1] != 319 {
+		t.Errorf("Expected registrations after WithProfilePack to reach the pack, got %v", v)
+	}
+	if _, ok := packed.ProfilePack().os["haiku"]; !ok {
+		t.Error("Expected the registered OS in the loaded pack")
+	}
+	if _, ok := defaultProfilePack.browsers[BrowserChrome].Versions[300]; ok {
+		t.Error("Registrations must not modify the embedded pack in place")
+	}
+}
+
+func TestRegisterClientSpecVersion(t *testing.T) {
+	resetRegistryOnCleanup(t)
+
+	vp := testChromiumVersion()
+	vp.TLS = TLSProfile{ClientSpec: ChromeLatestSpec}
+	if err := RegisterVersion(BrowserChrome, 400, vp); err != nil {
+		t.Fatalf("RegisterVersion failed: %v", err)
+	}
+
+	g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSWindows11), WithPlatforms(PlatformDesktop), WithVersionRange(400, 400), WithH2Only(true))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	if agent.ClientHelloSpec == nil {
+		t.Fatalf("Expected the registered ClientSpec to be used, got HelloID %v", agent.ClientHelloID)
+	}
+	got, err := agent.Fingerprint("example.com")
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+	want, err := ClientHelloSpecFingerprint(ChromeLatestSpec(), "example.com")
+	if err != nil {
+		t.Fatalf("ClientHelloSpecFingerprint failed: %v", err)
+	}
+	if got.TLS.JA4 != want.JA4 {
+		t.Errorf("Expected JA4 %s from the registered spec, got %s", want.JA4, got.TLS.JA4)
+	}
+}
@@ -2,9 +2,8 @@ package legitagent
 
 import (
 	"math"
+	"math/rand/v2"
 	"sort"
-
-	"github.com/SyNdicateFoundation/fastrand"
 )
 
 type HeaderSorter func(keys []string)
@@ -12,7 +11,7 @@ type HeaderSorter func(keys []string)
 var headerPriority = map[string]int{
 	":authority": 0, ":method": 1, ":path": 2, ":scheme": 3, ":status": 4,
 	"host": 10, "connection": 11, "upgrade": 12, "upgrade-insecure-requests": 13, "user-agent": 14,
-	"sec-ch-ua": 15, "sec-ch-ua-arch": 16, "sec-ch-ua-bitness": 17, "sec-ch-ua-full-version": 18, "sec-ch-ua-full-version-list": 19, "sec-ch-ua-mobile": 20, "sec-ch-ua-model": 21, "sec-ch-ua-platform": 22, "sec-ch-ua-platform-version": 23, "sec-ch-ua-wow64": 24,
+	"sec-ch-ua": 15, "sec-ch-ua-arch": 16, "sec-ch-ua-bitness": 17, "sec-ch-ua-full-version": 18, "sec-ch-ua-full-version-list": 19, "sec-ch-ua-mobile": 20, "sec-ch-ua-model": 21, "sec-ch-ua-platform": 22, "sec-ch-ua-platform-version": 23, "sec-ch-ua-wow64": 24, "sec-ch-ua-form-factors": 25,
 	"authorization": 30, "proxy-authorization": 31, "cookie": 32, "sec-gpc": 33, "expect": 34, "max-forwards": 35, "from": 36,
 	"accept": 40, "accept-charset": 41, "accept-encoding": 42, "accept-language": 43, "te": 44,
 	"if-match": 50, "if-none-match": 51, "if-modified-since": 52, "if-unmodified-since": 53, "if-range": 54,
@@ -30,7 +29,7 @@ var headerPriority = map[string]int{
 }
 
 func RandomHeaderSorter(keys []string) {
-	fastrand.Shuffle(len(keys), func(i, j int) {
+	rand.Shuffle(len(keys), func(i, j int) {
 		keys[i], keys[j] = keys[j], keys[i]
 	})
 }
@@ -58,7 +57,7 @@ func ShuffledPriorityHeaderSorter(keys []string) {
 		p2, _ := headerPriority[keys[i]]
 		if p1 != p2 {
 			if i-start > 1 {
-				fastrand.Shuffle(i-start, func(a, b int) {
+				rand.Shuffle(i-start, func(a, b int) {
 					keys[start+a], keys[start+b] = keys[start+b], keys[start+a]
 				})
 			}
@@ -66,7 +65,7 @@ func ShuffledPriorityHeaderSorter(keys []string) {
 		}
 	}
 	if len(keys)-start > 1 {
-		fastrand.Shuffle(len(keys)-start, func(a, b int) {
+		rand.Shuffle(len(keys)-start, func(a, b int) {
 			keys[start+a], keys[start+b] = keys[start+b], keys[start+a]
 		})
 	}
@@ -1,14 +1,19 @@
 package legitagent
 
 import (
-	"github.com/SyNdicateFoundation/fastrand"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
 	utls "github.com/refraction-networking/utls"
 )
 
+var ErrUnsupportedExtension = errors.New("legitagent: client hello spec has an extension that cannot be cloned")
+
 func shuffleExtensions(extensions []utls.TLSExtension) []utls.TLSExtension {
 	shuffled := make([]utls.TLSExtension, len(extensions))
 	copy(shuffled, extensions)
-	fastrand.Shuffle(len(shuffled), func(i, j int) {
+	rand.Shuffle(len(shuffled), func(i, j int) {
 		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
 	})
 
@@ -71,7 +76,7 @@ func ChromeLatestSpec() *utls.ClientHelloSpec {
 
 	shuffledCiphers := make([]uint16, len(cipherSuites))
 	copy(shuffledCiphers, cipherSuites)
-	fastrand.Shuffle(len(shuffledCiphers), func(i, j int) {
+	rand.Shuffle(len(shuffledCiphers), func(i, j int) {
 		shuffledCiphers[i], shuffledCiphers[j] = shuffledCiphers[j], shuffledCiphers[i]
 	})
 
@@ -82,3 +87,103 @@ func ChromeLatestSpec() *utls.ClientHelloSpec {
 		GetSessionID:       nil,
 	}
 }
+
+func maximumClientHelloSpec(family BrowserFamily, tlsProf TLSProfile) *utls.ClientHelloSpec {
+	if family == Chromium {
+		return ChromeLatestSpec()
+	}
+	if tlsProf.ClientSpec != nil {
+		return tlsProf.ClientSpec()
+	}
+	spec, err := utls.UTLSIdToSpec(tlsProf.HelloID)
+	if err != nil {
+		return nil
+	}
+	return &spec
+}
+
+func cloneClientHelloSpec(spec *utls.ClientHelloSpec) (*utls.ClientHelloSpec, error) {
+	clone := *spec
+	clone.CipherSuites = append([]uint16(nil), spec.CipherSuites...)
+	clone.CompressionMethods = append([]byte(nil), spec.CompressionMethods...)
+	clone.Extensions = make([]utls.TLSExtension, len(spec.Extensions))
+
+	for i, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *utls.SNIExtension:
+			clone.Extensions[i] = &utls.SNIExtension{}
+		case *utls.UtlsGREASEExtension:
+			clone.Extensions[i] = &utls.UtlsGREASEExtension{}
+		case *utls.UtlsPaddingExtension:
+			clone.Extensions[i] = &utls.UtlsPaddingExtension{GetPaddingLen: e.GetPaddingLen}
+		case *utls.SupportedCurvesExtension:
+			clone.Extensions[i] = &utls.SupportedCurvesExtension{Curves: append([]utls.CurveID(nil), e.Curves...)}
+		case *utls.SupportedVersionsExtension:
+			clone.Extensions[i] = &utls.SupportedVersionsExtension{Versions: append([]uint16(nil), e.Versions...)}
+		case *utls.ALPNExtension:
+			clone.Extensions[i] = &utls.ALPNExtension{AlpnProtocols: append([]string(nil), e.AlpnProtocols...)}
+		case *utls.KeyShareExtension:
+			shares := make([]utls.KeyShare, len(e.KeyShares))
+			for j, ks := range e.KeyShares {
+				shares[j] = utls.KeyShare{Group: ks.Group}
+				if len(ks.Data) <= 1 {
+					shares[j].Data = append([]byte(nil), ks.Data...)
+				}
+			}
+			clone.Extensions[i] = &utls.KeyShareExtension{KeyShares: shares}
+		case *utls.SessionTicketExtension:
+			clone.Extensions[i] = &utls.SessionTicketExtension{}
+		case *utls.SupportedPointsExtension:
+			clone.Extensions[i] = &utls.SupportedPointsExtension{SupportedPoints: append([]uint8(nil), e.SupportedPoints...)}
+		case *utls.SignatureAlgorithmsExtension:
+			clone.Extensions[i] = &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: append([]utls.SignatureScheme(nil), e.SupportedSignatureAlgorithms...)}
+		case *utls.SignatureAlgorithmsCertExtension:
+			clone.Extensions[i] = &utls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: append([]utls.SignatureScheme(nil), e.SupportedSignatureAlgorithms...)}
+		case *utls.FakeDelegatedCredentialsExtension:
+			clone.Extensions[i] = &utls.FakeDelegatedCredentialsExtension{SupportedSignatureAlgorithms: append([]utls.SignatureScheme(nil), e.SupportedSignatureAlgorithms...)}
+		case *utls.PSKKeyExchangeModesExtension:
+			clone.Extensions[i] = &utls.PSKKeyExchangeModesExtension{Modes: append([]uint8(nil), e.Modes...)}
+		case *utls.UtlsCompressCertExtension:
+			clone.Extensions[i] = &utls.UtlsCompressCertExtension{Algorithms: append([]utls.CertCompressionAlgo(nil), e.Algorithms...)}
+		case *utls.ApplicationSettingsExtension:
+			c := *e
+			c.SupportedProtocols = append([]string(nil), e.SupportedProtocols...)
+			clone.Extensions[i] = &c
+		case *utls.ApplicationSettingsExtensionNew:
+			c := *e
+			c.SupportedProtocols = append([]string(nil), e.SupportedProtocols...)
+			clone.Extensions[i] = &c
+		case *utls.RenegotiationInfoExtension:
+			clone.Extensions[i] = &utls.RenegotiationInfoExtension{Renegotiation: e.Renegotiation, RenegotiatedConnection: append([]byte(nil), e.RenegotiatedConnection...)}
+		case *utls.GREASEEncryptedClientHelloExtension:
+			clone.Extensions[i] = &utls.GREASEEncryptedClientHelloExtension{
+				CandidateCipherSuites: append([]utls.HPKESymmetricCipherSuite(nil), e.CandidateCipherSuites...),
+				CandidateConfigIds:    append([]uint8(nil), e.CandidateConfigIds...),
+				EncapsulatedKey:       append([]byte(nil), e.EncapsulatedKey...),
+				CandidatePayloadLens:  append([]uint16(nil), e.CandidatePayloadLens...),
+			}
+		case *utls.GenericExtension:
+			clone.Extensions[i] = &utls.GenericExtension{Id: e.Id, Data: append([]byte(nil), e.Data...)}
+		case *utls.CookieExtension:
+			clone.Extensions[i] = &utls.CookieExtension{Cookie: append([]byte(nil), e.Cookie...)}
+		case *utls.NPNExtension:
+			clone.Extensions[i] = &utls.NPNExtension{NextProtos: append([]string(nil), e.NextProtos...)}
+		case *utls.FakeTokenBindingExtension:
+			clone.Extensions[i] = &utls.FakeTokenBindingExtension{MajorVersion: e.MajorVersion, MinorVersion: e.MinorVersion, KeyParameters: append([]uint8(nil), e.KeyParameters...)}
+		case *utls.StatusRequestExtension:
+			clone.Extensions[i] = &utls.StatusRequestExtension{}
+		case *utls.SCTExtension:
+			clone.Extensions[i] = &utls.SCTExtension{}
+		case *utls.ExtendedMasterSecretExtension:
+			clone.Extensions[i] = &utls.ExtendedMasterSecretExtension{}
+		case *utls.FakeChannelIDExtension:
+			clone.Extensions[i] = &utls.FakeChannelIDExtension{OldExtensionID: e.OldExtensionID}
+		case *utls.FakeRecordSizeLimitExtension:
+			clone.Extensions[i] = &utls.FakeRecordSizeLimitExtension{Limit: e.Limit}
+		default:
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedExtension, ext)
+		}
+	}
+
+	return &clone, nil
+}
@@ -0,0 +1,60 @@
+package legitagent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTabletPlatform(t *testing.T) {
+	t.Run("Android", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSAndroid), WithPlatforms(PlatformTablet), WithVersionRange(133, 133), WithFullFingerprint(true), WithValidation(ValidationReject))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		if strings.Contains(agent.UserAgent, "Mobile") || !strings.Contains(agent.UserAgent, "Android 10; K)") {
+			t.Errorf("Expected a reduced Android tablet UA without the Mobile token, got %q", agent.UserAgent)
+		}
+		if agent.Device == nil || agent.Device.Platform != PlatformTablet || agent.Device.AndroidVersion == 0 {
+			t.Fatalf("Expected an Android tablet persona, got %+v", agent.Device)
+		}
+
+		hints := agent.ClientHints.Values
+		if hints["sec-ch-ua-mobile"] != "?0" || hints["sec-ch-ua-form-factors"] != `"Tablet"` || hints["sec-ch-ua-model"] != `"`+agent.Device.Model+`"` {
+			t.Errorf("Unexpected tablet client hints: %v", hints)
+		}
+	})
+
+	t.Run("iPad Safari", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserSafari), WithPlatforms(PlatformTablet))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		ua := agent.UserAgent
+		if !strings.HasPrefix(ua, "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)") || strings.Contains(ua, "Mobile/") || !strings.HasSuffix(ua, "Safari/605.1.15") {
+			t.Errorf("Expected iPad Safari to send a desktop macOS UA, got %q", ua)
+		}
+		if agent.Device == nil || agent.Device.Model != "iPad" {
+			t.Errorf("Expected an iPad persona, got %+v", agent.Device)
+		}
+	})
+
+	t.Run("From User Agent", func(t *testing.T) {
+		g := NewGenerator(WithFullFingerprint(true))
+		agent, err := g.FromUserAgent("Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.6943.49 Safari/537.36", RequestTypeNavigate)
+		if err != nil {
+			t.Fatalf("FromUserAgent failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		hints := agent.ClientHints.Values
+		if agent.Device.Name != "Galaxy Tab S9" || hints["sec-ch-ua-mobile"] != "?0" || hints["sec-ch-ua-form-factors"] != `"Tablet"` || hints["sec-ch-ua-platform-version"] != `"13.0.0"` {
+			t.Errorf("Unexpected Galaxy Tab S9 agent: %+v %v", agent.Device, hints)
+		}
+	})
+}
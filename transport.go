@@ -0,0 +1,971 @@
+package legitagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("legitagent: transport only supports https urls")
+	errH2ConnUnusable    = errors.New("legitagent: http/2 connection is no longer usable")
+	errH2StreamReset     = errors.New("legitagent: http/2 stream was reset by the server")
+)
+
+const (
+	h2DefaultWindow       = 65535
+	h2DefaultMaxFrameSize = 16384
+	h2WindowUpdateChunk   = 16384
+)
+
+var hopByHopHeaders = map[string]bool{
+	"connection":        true,
+	"proxy-connection":  true,
+	"keep-alive":        true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+	"host":              true,
+	"te":                true,
+}
+
+type Transport struct {
+	Agent              *Agent
+	InsecureSkipVerify bool
+	RootCAs            *x509.CertPool
+	DialContext        func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu    sync.Mutex
+	conns map[string]*h2ClientConn
+}
+
+func NewTransport(agent *Agent) *Transport {
+	return &Transport{Agent: agent}
+}
+
+var (
+	h2ALPN    = []string{"h2", "http/1.1"}
+	http1ALPN = []string{"http/1.1"}
+)
+
+func (a *Agent) alpn() []string {
+	if a.H2Settings == nil {
+		return http1ALPN
+	}
+	return h2ALPN
+}
+
+func (a *Agent) newUConn(conn net.Conn, config *utls.Config, alpn []string) (*utls.UConn, error) {
+	id, spec := a.ClientHelloID, a.ClientHelloSpec
+	if spec != nil {
+		var err error
+		if spec, err = cloneClientHelloSpec(spec); err != nil {
+			return nil, err
+		}
+		id = utls.HelloCustom
+	} else if id == (utls.ClientHelloID{}) {
+		id = utls.HelloGolang
+	}
+
+	config = config.Clone()
+	config.NextProtos = append([]string(nil), alpn...)
+
+	if !slices.Equal(alpn, h2ALPN) && id != utls.HelloGolang {
+		if spec == nil {
+			s, err := utls.UTLSIdToSpec(id)
+			if err != nil {
+				return nil, fmt.Errorf("legitagent: could not build spec for %s: %w", id.Str(), err)
+			}
+			spec = &s
+			id = utls.HelloCustom
+		}
+		for _, ext := range spec.Extensions {
+			if e, ok := ext.(*utls.ALPNExtension); ok {
+				e.AlpnProtocols = append([]string(nil), alpn...)
+			}
+		}
+	}
+
+	uconn := utls.UClient(conn, config, id)
+	if spec != nil {
+		if err := uconn.ApplyPreset(spec); err != nil {
+			return nil, fmt.Errorf("legitagent: could not apply client hello spec: %w", err)
+		}
+	}
+	return uconn, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTrip(req)
+	if err != nil || t.Agent.ClientHints == nil {
+		return resp, err
+	}
+
+	retry := t.Agent.ClientHints.Record(requestOrigin(req), resp.Header)
+	for i := 0; i < len(retry); i++ {
+		if t.Agent.Headers.Get(retry[i]) != "" || req.Header.Get(retry[i]) != "" {
+			retry = append(retry[:i], retry[i+1:]...)
+			i--
+		}
+	}
+	if len(retry) == 0 || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	retryReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retryReq.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	return t.roundTrip(retryReq)
+}
+
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL == nil || req.URL.Scheme != "https" {
+		closeRequestBody(req)
+		return nil, ErrUnsupportedScheme
+	}
+	if t.Agent == nil {
+		closeRequestBody(req)
+		return nil, errors.New("legitagent: transport has no agent")
+	}
+
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+
+	t.mu.Lock()
+	cc := t.conns[addr]
+	if cc != nil && !cc.usable() {
+		delete(t.conns, addr)
+		cc = nil
+	}
+	t.mu.Unlock()
+
+	if cc != nil {
+		resp, err := cc.roundTrip(req)
+		if !errors.Is(err, errH2ConnUnusable) {
+			return resp, err
+		}
+	}
+
+	conn, err := t.dial(req.Context(), addr, req.URL.Hostname())
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	if conn.ConnectionState().NegotiatedProtocol != "h2" {
+		return roundTripHTTP1(conn, req, t.Agent)
+	}
+
+	cc, err = newH2ClientConn(conn, t.Agent)
+	if err != nil {
+		_ = conn.Close()
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	for {
+		t.mu.Lock()
+		if t.conns == nil {
+			t.conns = make(map[string]*h2ClientConn)
+		}
+		existing := t.conns[addr]
+		if existing == nil || !existing.usable() {
+			t.conns[addr] = cc
+			t.mu.Unlock()
+			return cc.roundTrip(req)
+		}
+		t.mu.Unlock()
+
+		resp, err := existing.roundTrip(req)
+		if !errors.Is(err, errH2ConnUnusable) {
+			cc.close(errH2ConnUnusable)
+			return resp, err
+		}
+	}
+}
+
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for addr, cc := range t.conns {
+		if cc.idle() {
+			cc.close(errH2ConnUnusable)
+			delete(t.conns, addr)
+		}
+	}
+}
+
+func (t *Transport) dial(ctx context.Context, addr, serverName string) (*utls.UConn, error) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+
+	raw, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	uconn, err := t.Agent.newUConn(raw, &utls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		RootCAs:            t.RootCAs,
+	}, t.Agent.alpn())
+	if err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		_ = raw.Close()
+		return nil, fmt.Errorf("legitagent: tls handshake failed: %w", err)
+	}
+	return uconn, nil
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+func (a *Agent) requestHeaders(req *http.Request) [][2]string {
+	values := make(map[string][]string, len(a.Headers)+len(req.Header)+1)
+	for k, v := range a.Headers {
+		values[strings.ToLower(k)] = v
+	}
+	if a.UserAgent != "" {
+		values["user-agent"] = []string{a.UserAgent}
+	}
+	if a.ClientHints != nil {
+		for _, k := range a.ClientHints.Accepted(requestOrigin(req)) {
+			values[k] = []string{a.ClientHints.Values[k]}
+		}
+	}
+	for k, v := range req.Header {
+		values[strings.ToLower(k)] = v
+	}
+	for k := range hopByHopHeaders {
+		delete(values, k)
+	}
+	if req.ContentLength > 0 {
+		values["content-length"] = []string{strconv.FormatInt(req.ContentLength, 10)}
+	}
+
+	order := make([]string, 0, len(values))
+	for _, k := range a.wireHeaderOrder() {
+		if _, ok := values[k]; ok {
+			order = append(order, k)
+		}
+	}
+
+	var extras []string
+	for k := range values {
+		found := false
+		for _, o := range order {
+			if o == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			extras = append(extras, k)
+		}
+	}
+	sort.Strings(extras)
+	for _, k := range extras {
+		order = insertByPriority(order, k)
+	}
+
+	headers := make([][2]string, 0, len(order))
+	for _, k := range order {
+		for _, v := range values[k] {
+			headers = append(headers, [2]string{k, v})
+		}
+	}
+	return headers
+}
+
+func requestAuthority(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	return strings.TrimSuffix(host, ":443")
+}
+
+func requestOrigin(req *http.Request) string {
+	return req.URL.Scheme + "://" + requestAuthority(req)
+}
+
+func roundTripHTTP1(conn net.Conn, req *http.Request, a *Agent) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	bw := bufio.NewWriter(conn)
+	fmt.Fprintf(bw, "%s %s HTTP/1.1\r\nHost: %s\r\nConnection: keep-alive\r\n", req.Method, req.URL.RequestURI(), requestAuthority(req))
+	for _, h := range a.requestHeaders(req) {
+		if h[0] == "content-length" {
+			continue
+		}
+		fmt.Fprintf(bw, "%s: %s\r\n", http1HeaderName(h[0]), h[1])
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(bw, "Content-Length: %d\r\n", len(body))
+	}
+	bw.WriteString("\r\n")
+	bw.Write(body)
+
+	if err := bw.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	resp.Body = &connClosingBody{ReadCloser: resp.Body, conn: conn}
+	return resp, nil
+}
+
+func http1HeaderName(name string) string {
+	if strings.HasPrefix(name, "sec-ch-") {
+		return name
+	}
+	return http.CanonicalHeaderKey(name)
+}
+
+type connClosingBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *connClosingBody) Close() error {
+	err := b.ReadCloser.Close()
+	_ = b.conn.Close()
+	return err
+}
+
+type h2ClientConn struct {
+	conn   net.Conn
+	agent  *Agent
+	framer *http2.Framer
+
+	wmu  sync.Mutex
+	hbuf bytes.Buffer
+	henc *hpack.Encoder
+
+	mu            sync.Mutex
+	cond          *sync.Cond
+	streams       map[uint32]*h2ClientStream
+	nextStreamID  uint32
+	closed        bool
+	goAway        bool
+	err           error
+	sendWindow    int64
+	initialWindow int64
+	maxFrameSize  uint32
+	recvUnacked   uint32
+}
+
+type h2ClientStream struct {
+	id         uint32
+	req        *http.Request
+	respc      chan h2Result
+	sendWindow int64
+	done       bool
+
+	mu         sync.Mutex
+	gotHeaders bool
+	failed     bool
+
+	body *h2Body
+}
+
+type h2Result struct {
+	resp *http.Response
+	err  error
+}
+
+func newH2ClientConn(conn net.Conn, a *Agent) (*h2ClientConn, error) {
+	cc := &h2ClientConn{
+		conn:          conn,
+		agent:         a,
+		framer:        http2.NewFramer(conn, conn),
+		streams:       make(map[uint32]*h2ClientStream),
+		nextStreamID:  1,
+		sendWindow:    h2DefaultWindow,
+		initialWindow: h2DefaultWindow,
+		maxFrameSize:  h2DefaultMaxFrameSize,
+	}
+	cc.cond = sync.NewCond(&cc.mu)
+	cc.henc = hpack.NewEncoder(&cc.hbuf)
+
+	tableSize := uint32(4096)
+	if v, ok := a.H2Settings[http2.SettingHeaderTableSize]; ok {
+		tableSize = v
+	}
+	cc.framer.ReadMetaHeaders = hpack.NewDecoder(tableSize, nil)
+	if v, ok := a.H2Settings[http2.SettingMaxHeaderListSize]; ok && v > 0 {
+		cc.framer.MaxHeaderListSize = v
+	}
+	if v, ok := a.H2Settings[http2.SettingMaxFrameSize]; ok && v >= h2DefaultMaxFrameSize {
+		cc.framer.SetMaxReadFrameSize(v)
+	}
+
+	if _, err := io.WriteString(conn, h2ClientPreface); err != nil {
+		return nil, err
+	}
+	if err := cc.framer.WriteSettings(orderedH2Settings(a.H2Settings)...); err != nil {
+		return nil, err
+	}
+	if a.H2WindowUpdate > 0 {
+		if err := cc.framer.WriteWindowUpdate(0, a.H2WindowUpdate); err != nil {
+			return nil, err
+		}
+	}
+
+	go cc.readLoop()
+	return cc, nil
+}
+
+func (cc *h2ClientConn) streamRecvWindow() uint32 {
+	if v, ok := cc.agent.H2Settings[http2.SettingInitialWindowSize]; ok {
+		return v
+	}
+	return h2DefaultWindow
+}
+
+func (cc *h2ClientConn) usable() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return !cc.closed && !cc.goAway && cc.nextStreamID < 1<<31-1
+}
+
+func (cc *h2ClientConn) idle() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return len(cc.streams) == 0
+}
+
+func (cc *h2ClientConn) close(err error) {
+	cc.mu.Lock()
+	if cc.closed {
+		cc.mu.Unlock()
+		return
+	}
+	cc.closed = true
+	cc.err = err
+	streams := cc.streams
+	cc.streams = make(map[uint32]*h2ClientStream)
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+
+	_ = cc.conn.Close()
+	for _, cs := range streams {
+		cs.fail(err)
+	}
+}
+
+func (cs *h2ClientStream) fail(err error) {
+	cs.mu.Lock()
+	if !cs.gotHeaders {
+		if !cs.failed {
+			cs.failed = true
+			cs.respc <- h2Result{err: err}
+		}
+		cs.mu.Unlock()
+		return
+	}
+	cs.mu.Unlock()
+	cs.body.closeWithError(err)
+}
+
+func (cs *h2ClientStream) headersReceived() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.gotHeaders
+}
+
+func (cs *h2ClientStream) respond(resp *http.Response) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.failed {
+		return false
+	}
+	cs.gotHeaders = true
+	cs.respc <- h2Result{resp: resp}
+	return true
+}
+
+func (cc *h2ClientConn) roundTrip(req *http.Request) (*http.Response, error) {
+	cc.mu.Lock()
+	if cc.closed || cc.goAway {
+		cc.mu.Unlock()
+		return nil, errH2ConnUnusable
+	}
+	cs := &h2ClientStream{
+		id:         cc.nextStreamID,
+		req:        req,
+		respc:      make(chan h2Result, 1),
+		sendWindow: cc.initialWindow,
+	}
+	cs.body = &h2Body{cc: cc, cs: cs}
+	cs.body.cond = sync.NewCond(&cs.body.mu)
+	cc.nextStreamID += 2
+	cc.streams[cs.id] = cs
+	cc.mu.Unlock()
+
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if err := cc.writeHeaders(cs, req, !hasBody); err != nil {
+		cc.close(err)
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	if hasBody {
+		go cc.writeBody(cs, req.Body)
+	}
+
+	select {
+	case res := <-cs.respc:
+		return res.resp, res.err
+	case <-req.Context().Done():
+		cc.resetStream(cs, http2.ErrCodeCancel)
+		return nil, req.Context().Err()
+	}
+}
+
+func (cc *h2ClientConn) writeHeaders(cs *h2ClientStream, req *http.Request, endStream bool) error {
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+
+	cc.hbuf.Reset()
+	for _, p := range cc.agent.pseudoHeaderOrder() {
+		var value string
+		switch p {
+		case ":method":
+			value = req.Method
+		case ":authority":
+			value = requestAuthority(req)
+		case ":scheme":
+			value = "https"
+		case ":path":
+			value = req.URL.RequestURI()
+		default:
+			continue
+		}
+		if err := cc.henc.WriteField(hpack.HeaderField{Name: p, Value: value}); err != nil {
+			return err
+		}
+	}
+	for _, h := range cc.agent.requestHeaders(req) {
+		if err := cc.henc.WriteField(hpack.HeaderField{Name: h[0], Value: h[1]}); err != nil {
+			return err
+		}
+	}
+
+	cc.mu.Lock()
+	maxFrame := int(cc.maxFrameSize)
+	cc.mu.Unlock()
+
+	block := cc.hbuf.Bytes()
+	first := true
+	for first || len(block) > 0 {
+		chunk := block
+		if len(chunk) > maxFrame {
+			chunk = chunk[:maxFrame]
+		}
+		block = block[len(chunk):]
+		endHeaders := len(block) == 0
+
+		var err error
+		if first {
+			err = cc.framer.WriteHeaders(http2.HeadersFrameParam{StreamID: cs.id, BlockFragment: chunk, EndStream: endStream, EndHeaders: endHeaders})
+			first = false
+		} else {
+			err = cc.framer.WriteContinuation(cs.id, endHeaders, chunk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cc *h2ClientConn) writeBody(cs *h2ClientStream, body io.ReadCloser) {
+	defer body.Close()
+
+	buf := make([]byte, h2DefaultMaxFrameSize)
+	for {
+		n, err := body.Read(buf)
+		data := buf[:n]
+
+		for len(data) > 0 {
+			cc.mu.Lock()
+			for !cc.closed && !cs.done && (cc.sendWindow <= 0 || cs.sendWindow <= 0) {
+				cc.cond.Wait()
+			}
+			if cc.closed || cs.done {
+				cc.mu.Unlock()
+				return
+			}
+			allowed := min(int64(len(data)), cc.sendWindow, cs.sendWindow, int64(cc.maxFrameSize))
+			cc.sendWindow -= allowed
+			cs.sendWindow -= allowed
+			cc.mu.Unlock()
+
+			cc.wmu.Lock()
+			werr := cc.framer.WriteData(cs.id, false, data[:allowed])
+			cc.wmu.Unlock()
+			if werr != nil {
+				cc.close(werr)
+				return
+			}
+			data = data[allowed:]
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				cc.resetStream(cs, http2.ErrCodeCancel)
+				return
+			}
+			cc.wmu.Lock()
+			werr := cc.framer.WriteData(cs.id, true, nil)
+			cc.wmu.Unlock()
+			if werr != nil {
+				cc.close(werr)
+			}
+			return
+		}
+	}
+}
+
+func (cc *h2ClientConn) resetStream(cs *h2ClientStream, code http2.ErrCode) {
+	cc.mu.Lock()
+	_, open := cc.streams[cs.id]
+	delete(cc.streams, cs.id)
+	cs.done = true
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+
+	if open {
+		cc.wmu.Lock()
+		_ = cc.framer.WriteRSTStream(cs.id, code)
+		cc.wmu.Unlock()
+	}
+}
+
+func (cc *h2ClientConn) stream(id uint32) *h2ClientStream {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.streams[id]
+}
+
+func (cc *h2ClientConn) endStream(cs *h2ClientStream) {
+	cc.mu.Lock()
+	delete(cc.streams, cs.id)
+	cs.done = true
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+}
+
+func (cc *h2ClientConn) readLoop() {
+	for {
+		frame, err := cc.framer.ReadFrame()
+		if err != nil {
+			cc.close(err)
+			return
+		}
+
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			cc.mu.Lock()
+			_ = f.ForeachSetting(func(s http2.Setting) error {
+				switch s.ID {
+				case http2.SettingInitialWindowSize:
+					delta := int64(s.Val) - cc.initialWindow
+					cc.initialWindow = int64(s.Val)
+					for _, cs := range cc.streams {
+						cs.sendWindow += delta
+					}
+				case http2.SettingMaxFrameSize:
+					cc.maxFrameSize = s.Val
+				}
+				return nil
+			})
+			cc.cond.Broadcast()
+			cc.mu.Unlock()
+
+			cc.wmu.Lock()
+			err = cc.framer.WriteSettingsAck()
+			cc.wmu.Unlock()
+		case *http2.WindowUpdateFrame:
+			cc.mu.Lock()
+			if f.StreamID == 0 {
+				cc.sendWindow += int64(f.Increment)
+			} else if cs := cc.streams[f.StreamID]; cs != nil {
+				cs.sendWindow += int64(f.Increment)
+			}
+			cc.cond.Broadcast()
+			cc.mu.Unlock()
+		case *http2.MetaHeadersFrame:
+			cc.handleHeaders(f)
+		case *http2.DataFrame:
+			err = cc.handleData(f)
+		case *http2.RSTStreamFrame:
+			if cs := cc.stream(f.StreamID); cs != nil {
+				cc.endStream(cs)
+				cs.fail(fmt.Errorf("%w: %v", errH2StreamReset, f.ErrCode))
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				cc.wmu.Lock()
+				err = cc.framer.WritePing(true, f.Data)
+				cc.wmu.Unlock()
+			}
+		case *http2.GoAwayFrame:
+			cc.mu.Lock()
+			cc.goAway = true
+			var failed []*h2ClientStream
+			for id, cs := range cc.streams {
+				if id > f.LastStreamID {
+					failed = append(failed, cs)
+					delete(cc.streams, id)
+				}
+			}
+			cc.mu.Unlock()
+			for _, cs := range failed {
+				cs.fail(errH2ConnUnusable)
+			}
+		}
+
+		if err != nil {
+			cc.close(err)
+			return
+		}
+	}
+}
+
+func (cc *h2ClientConn) handleHeaders(f *http2.MetaHeadersFrame) {
+	cs := cc.stream(f.StreamID)
+	if cs == nil {
+		return
+	}
+
+	if cs.headersReceived() {
+		if f.StreamEnded() {
+			cc.endStream(cs)
+			cs.body.closeWithError(io.EOF)
+		}
+		return
+	}
+
+	status, err := strconv.Atoi(f.PseudoValue("status"))
+	if err != nil {
+		cc.resetStream(cs, http2.ErrCodeProtocol)
+		cs.fail(fmt.Errorf("legitagent: malformed response status %q", f.PseudoValue("status")))
+		return
+	}
+	if status >= 100 && status < 200 {
+		return
+	}
+
+	header := make(http.Header, len(f.RegularFields()))
+	for _, field := range f.RegularFields() {
+		header.Add(http.CanonicalHeaderKey(field.Name), field.Value)
+	}
+
+	resp := &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        header,
+		ContentLength: -1,
+		Request:       cs.req,
+		Body:          cs.body,
+	}
+	if cl, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		resp.ContentLength = cl
+	}
+
+	if f.StreamEnded() {
+		cc.endStream(cs)
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+	}
+	cs.respond(resp)
+}
+
+func (cc *h2ClientConn) handleData(f *http2.DataFrame) error {
+	length := f.Header().Length
+	data := f.Data()
+
+	cs := cc.stream(f.StreamID)
+	open := cs != nil && cs.headersReceived()
+
+	discarded := length - uint32(len(data))
+	if !open || !cs.body.write(data) {
+		discarded = length
+	}
+	if update := cc.connWindowUpdate(discarded); update > 0 {
+		cc.wmu.Lock()
+		err := cc.framer.WriteWindowUpdate(0, update)
+		cc.wmu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if open && f.StreamEnded() {
+		cc.endStream(cs)
+		cs.body.closeWithError(io.EOF)
+	}
+	return nil
+}
+
+func (cc *h2ClientConn) connWindowUpdate(n uint32) uint32 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.recvUnacked += n
+	if cc.recvUnacked < h2WindowUpdateChunk {
+		return 0
+	}
+	update := cc.recvUnacked
+	cc.recvUnacked = 0
+	return update
+}
+
+func (cc *h2ClientConn) consumed(cs *h2ClientStream, n int) {
+	connUpdate := cc.connWindowUpdate(uint32(n))
+	cc.mu.Lock()
+	open := !cs.done
+	cc.mu.Unlock()
+
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	if connUpdate > 0 {
+		_ = cc.framer.WriteWindowUpdate(0, connUpdate)
+	}
+	if open {
+		_ = cc.framer.WriteWindowUpdate(cs.id, uint32(n))
+	}
+}
+
+type h2Body struct {
+	cc *h2ClientConn
+	cs *h2ClientStream
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      bytes.Buffer
+	err      error
+	unacked  int
+	isClosed bool
+}
+
+func (b *h2Body) write(p []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.isClosed {
+		return false
+	}
+	b.buf.Write(p)
+	b.cond.Broadcast()
+	return true
+}
+
+func (b *h2Body) closeWithError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.cond.Broadcast()
+}
+
+func (b *h2Body) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	for b.buf.Len() == 0 && b.err == nil && !b.isClosed {
+		b.cond.Wait()
+	}
+	if b.isClosed {
+		b.mu.Unlock()
+		return 0, errors.New("legitagent: read on closed response body")
+	}
+	if b.buf.Len() == 0 {
+		err := b.err
+		b.mu.Unlock()
+		return 0, err
+	}
+
+	n, _ := b.buf.Read(p)
+	b.unacked += n
+	var ack int
+	if b.unacked >= h2WindowUpdateChunk || b.err != nil {
+		ack, b.unacked = b.unacked, 0
+	}
+	b.mu.Unlock()
+
+	if ack > 0 {
+		b.cc.consumed(b.cs, ack)
+	}
+	return n, nil
+}
+
+func (b *h2Body) Close() error {
+	b.mu.Lock()
+	b.isClosed = true
+	done := b.err != nil
+	unacked := b.buf.Len() + b.unacked
+	b.unacked = 0
+	b.buf.Reset()
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	if !done {
+		b.cc.resetStream(b.cs, http2.ErrCodeCancel)
+	}
+	if unacked > 0 {
+		b.cc.consumed(b.cs, unacked)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package legitagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestTransportReusesH2Connection(t *testing.T) {
+	s, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("NewEchoServer failed: %v", err)
+	}
+	defer s.Close()
+
+	g := NewGenerator(WithBrowsers(BrowserFirefox), WithOS(OSLinux), WithPlatforms(PlatformDesktop))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+
+	transport := &Transport{Agent: agent, InsecureSkipVerify: true}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	var remote string
+	for i := 0; i < 3; i++ {
+		body := strings.NewReader(strings.Repeat("x", 100000))
+		resp, err := client.Post(s.URL+"/upload", "text/plain", body)
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+
+		var echo EchoResponse
+		err = json.NewDecoder(resp.Body).Decode(&echo)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode echo response: %v", err)
+		}
+
+		if resp.ProtoMajor != 2 || echo.Method != http.MethodPost || echo.UserAgent != agent.UserAgent {
+			t.Errorf("Unexpected echo for request %d: proto=%d method=%s ua=%q", i, resp.ProtoMajor, echo.Method, echo.UserAgent)
+		}
+		if remote != "" && echo.RemoteAddr != remote {
+			t.Errorf("Expected connection reuse, got %s then %s", remote, echo.RemoteAddr)
+		}
+		remote = echo.RemoteAddr
+	}
+}
+
+func TestTransportReturnsDiscardedFlowControl(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 256<<10)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	defer s.Close()
+
+	g := NewGenerator(WithBrowsers(BrowserFirefox), WithOS(OSLinux), WithPlatforms(PlatformDesktop))
+	agent, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	defer g.ReleaseAgent(agent)
+	agent.H2WindowUpdate = 0
+
+	transport := &Transport{Agent: agent, InsecureSkipVerify: true}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		if resp.ProtoMajor != 2 {
+			t.Fatalf("Expected HTTP/2, got %s", resp.Proto)
+		}
+		if _, err := io.ReadFull(resp.Body, make([]byte, 1024)); err != nil {
+			t.Fatalf("Request %d read failed: %v", i, err)
+		}
+		resp.Body.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Final request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || len(body) != len(payload) {
+		t.Errorf("Expected the full body on a reused connection, got %d bytes (%v)", len(body), err)
+	}
+}
+
+func TestTransportRejectsPlainHTTP(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := (&Transport{Agent: &Agent{}}).RoundTrip(req); err != ErrUnsupportedScheme {
+		t.Errorf("Expected ErrUnsupportedScheme, got %v", err)
+	}
+}
+
+func TestCloneClientHelloSpec(t *testing.T) {
+	spec, err := utls.UTLSIdToSpec(utls.HelloChrome_133)
+	if err != nil {
+		t.Fatalf("UTLSIdToSpec failed: %v", err)
+	}
+
+	clone, err := cloneClientHelloSpec(&spec)
+	if err != nil {
+		t.Fatalf("cloneClientHelloSpec failed: %v", err)
+	}
+	for _, ext := range clone.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols[0] = "http/1.1"
+		}
+	}
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok && alpn.AlpnProtocols[0] != "h2" {
+			t.Errorf("Modifying the clone changed the original ALPN to %v", alpn.AlpnProtocols)
+		}
+	}
+
+	spec.Extensions = append(spec.Extensions, &utls.FakePreSharedKeyExtension{})
+	if _, err := cloneClientHelloSpec(&spec); !errors.Is(err, ErrUnsupportedExtension) {
+		t.Errorf("Expected ErrUnsupportedExtension, got %v", err)
+	}
+}
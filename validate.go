@@ -0,0 +1,355 @@
+package legitagent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+var ErrInvalidAgent = errors.New("legitagent: agent failed cross-layer validation")
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+const (
+	RuleUnrecognizedUserAgent = "ua-unrecognized"
+	RuleChromiumOnIOS         = "chromium-on-ios"
+	RuleUAPlatform            = "ua-platform"
+	RuleTLSFamily             = "tls-family"
+	RuleH2Family              = "h2-family"
+	RuleH2WindowUpdate        = "h2-window-update"
+	RulePseudoHeaderOrder     = "pseudo-header-order"
+	RuleClientHintsUnexpected = "client-hints-unexpected"
+	RuleClientHintsPartial    = "client-hints-partial"
+	RuleClientHintsBrand      = "client-hints-brand"
+	RuleClientHintsPlatform   = "client-hints-platform"
+	RuleClientHintsMobile     = "client-hints-mobile"
+	RuleHeaderOrder           = "header-order"
+)
+
+type Issue struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("[%s] %s: %s", i.Severity, i.Rule, i.Message)
+}
+
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		if issue.Severity == SeverityError {
+			msgs = append(msgs, issue.Rule+": "+issue.Message)
+		}
+	}
+	return ErrInvalidAgent.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidAgent
+}
+
+type ValidationMode int
+
+const (
+	ValidationOff ValidationMode = iota
+	ValidationReject
+	ValidationRegenerate
+)
+
+const maxValidationAttempts = 32
+
+var (
+	lowEntropyClientHints = []string{"sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform"}
+	secChUaBrandRegex     = regexp.MustCompile(`"([^"]*)";\s*v="([^"]*)"`)
+	chromeMajorRegex      = regexp.MustCompile(`Chrome/(\d+)`)
+)
+
+func Validate(agent *Agent) []Issue {
+	issues := validateHeaderOrder(agent)
+	return append(issues, validateLayers(agent, clientHelloFamily(agent), false)...)
+}
+
+func validateLayers(agent *Agent, tlsFamily BrowserFamily, strictH2 bool) []Issue {
+	var issues []Issue
+	report := func(rule string, severity Severity, format string, args ...any) {
+		issues = append(issues, Issue{Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	parsed, err := parseUserAgentString(agent.UserAgent)
+	if err != nil {
+		report(RuleUnrecognizedUserAgent, SeverityWarning, "user agent %q could not be parsed, cross-layer checks skipped", agent.UserAgent)
+		return issues
+	}
+
+	profile := parsed.engineProfile()
+	family := profile.Family
+	platformName := userAgentPlatformName(agent.UserAgent)
+	mobile := strings.Contains(agent.UserAgent, "Mobile")
+
+	if platformName == "iOS" && family == Chromium {
+		report(RuleChromiumOnIOS, SeverityError, "user agent claims a Chromium engine on iOS, where every browser runs on WebKit")
+	}
+
+	if mobile && platformName != "iOS" && platformName != "Android" {
+		report(RuleUAPlatform, SeverityError, "user agent has a Mobile token on %s", platformName)
+	}
+
+	if tlsFamily != "" && tlsFamily != family {
+		report(RuleTLSFamily, SeverityError, "user agent is %s but the TLS ClientHello is %s", family, tlsFamily)
+	}
+
+	if agent.H2Settings != nil {
+		switch h2Family := h2SettingsFamily(agent.H2Settings); {
+		case h2Family != "" && h2Family != family:
+			report(RuleH2Family, SeverityError, "user agent is %s but the HTTP/2 SETTINGS are %s", family, h2Family)
+		case h2Family == "" && strictH2:
+			report(RuleH2Family, SeverityError, "user agent is %s but the HTTP/2 SETTINGS match no known browser", family)
+		}
+
+		if want := profile.H2WindowUpdate; agent.H2WindowUpdate != want {
+			report(RuleH2WindowUpdate, SeverityWarning, "connection WINDOW_UPDATE is %d, %s sends %d", agent.H2WindowUpdate, family, want)
+		}
+
+		if want, got := familyPseudoHeaderOrder[family], agent.pseudoHeaderOrder(); strings.Join(want, ",") != strings.Join(got, ",") {
+			report(RulePseudoHeaderOrder, SeverityError, "pseudo-header order is %s, %s sends %s", strings.Join(got, ","), family, strings.Join(want, ","))
+		}
+	}
+
+	hints := clientHintHeaders(agent.Headers)
+	if family != Chromium {
+		if len(hints) > 0 {
+			report(RuleClientHintsUnexpected, SeverityError, "%s does not send client hints but the agent has %s", family, strings.Join(hints, ", "))
+		}
+		return issues
+	}
+
+	if len(hints) == 0 {
+		return issues
+	}
+
+	var missing []string
+	for _, h := range lowEntropyClientHints {
+		if agent.Headers.Get(h) == "" {
+			missing = append(missing, h)
+		}
+	}
+	if len(missing) > 0 {
+		report(RuleClientHintsPartial, SeverityError, "client hints are present but %s missing", strings.Join(missing, ", "))
+	}
+
+	if secChUa := agent.Headers.Get("sec-ch-ua"); secChUa != "" {
+		issues = append(issues, validateSecChUaBrands(agent.UserAgent, secChUa)...)
+	}
+
+	if v := agent.Headers.Get("sec-ch-ua-platform"); v != "" && strings.Trim(v, `"`) != platformName {
+		report(RuleClientHintsPlatform, SeverityError, "sec-ch-ua-platform is %s but the user agent is %s", v, platformName)
+	}
+
+	if v := agent.Headers.Get("sec-ch-ua-mobile"); v != "" {
+		want := "?0"
+		if mobile {
+			want = "?1"
+		}
+		if v != want {
+			report(RuleClientHintsMobile, SeverityError, "sec-ch-ua-mobile is %s but the user agent implies %s", v, want)
+		}
+	}
+
+	return issues
+}
+
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func validateHeaderOrder(agent *Agent) []Issue {
+	var issues []Issue
+
+	ordered := make(map[string]bool, len(agent.HeaderOrder))
+	for _, h := range agent.HeaderOrder {
+		ordered[h] = true
+	}
+
+	for k := range agent.Headers {
+		if k := strings.ToLower(k); !ordered[k] {
+			issues = append(issues, Issue{Rule: RuleHeaderOrder, Severity: SeverityError, Message: fmt.Sprintf("header %s is set but missing from HeaderOrder", k)})
+		}
+	}
+	for _, h := range agent.HeaderOrder {
+		if !strings.HasPrefix(h, ":") && h != "user-agent" && agent.Headers.Get(h) == "" {
+			issues = append(issues, Issue{Rule: RuleHeaderOrder, Severity: SeverityWarning, Message: fmt.Sprintf("header %s is in HeaderOrder but not set", h)})
+		}
+	}
+
+	return issues
+}
+
+func validateSecChUaBrands(userAgent, secChUa string) []Issue {
+	var issues []Issue
+	report := func(format string, args ...any) {
+		issues = append(issues, Issue{Rule: RuleClientHintsBrand, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+
+	major := ""
+	if m := chromeMajorRegex.FindStringSubmatch(userAgent); len(m) > 1 {
+		major = m[1]
+	}
+
+	brands := make(map[string][]string)
+	for _, m := range secChUaBrandRegex.FindAllStringSubmatch(secChUa, -1) {
+		brands[m[1]] = append(brands[m[1]], m[2])
+	}
+
+	switch chromium := brands["Chromium"]; {
+	case len(chromium) != 1:
+		report("sec-ch-ua lists the Chromium brand %d times", len(chromium))
+	case chromium[0] != major:
+		report("sec-ch-ua Chromium version %s does not match user agent major version %s", chromium[0], major)
+	}
+
+	var wanted []string
+	browsers := DefaultProfilePack().browsers
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		wanted = []string{browsers[BrowserEdge].Brand}
+	case strings.Contains(userAgent, "OPR/"):
+		wanted = []string{browsers[BrowserOpera].Brand}
+	default:
+		wanted = []string{browsers[BrowserChrome].Brand, browsers[BrowserBrave].Brand}
+	}
+	found := false
+	for _, w := range wanted {
+		if _, ok := brands[w]; ok {
+			found = true
+		}
+	}
+	if !found {
+		report("sec-ch-ua %s does not list %q", secChUa, wanted[0])
+	}
+
+	return issues
+}
+
+func clientHintHeaders(h http.Header) []string {
+	var hints []string
+	for k := range h {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "sec-ch-ua") {
+			hints = append(hints, k)
+		}
+	}
+	return hints
+}
+
+func userAgentPlatformName(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		return "iOS"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS"
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return ""
+}
+
+func clientHelloFamily(agent *Agent) BrowserFamily {
+	if agent.ClientHelloSpec != nil {
+		return clientHelloSpecFamily(agent.ClientHelloSpec)
+	}
+
+	switch agent.ClientHelloID.Client {
+	case utls.HelloChrome_Auto.Client, utls.HelloEdge_Auto.Client, utls.Hello360_Auto.Client, utls.HelloQQ_Auto.Client:
+		return Chromium
+	case utls.HelloFirefox_Auto.Client:
+		return Gecko
+	case utls.HelloSafari_Auto.Client, utls.HelloIOS_Auto.Client:
+		return WebKit
+	}
+	return ""
+}
+
+func clientHelloSpecFamily(spec *utls.ClientHelloSpec) BrowserFamily {
+	grease, brotli := false, false
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *utls.UtlsGREASEExtension:
+			grease = true
+		case *utls.UtlsCompressCertExtension:
+			for _, alg := range e.Algorithms {
+				if alg == utls.CertCompressionBrotli {
+					brotli = true
+				}
+			}
+		case *utls.FakeRecordSizeLimitExtension, *utls.FakeDelegatedCredentialsExtension:
+			return Gecko
+		}
+	}
+
+	switch {
+	case grease && brotli:
+		return Chromium
+	case grease:
+		return WebKit
+	}
+	return ""
+}
+
+func h2SettingsFamily(settings map[http2.SettingID]uint32) BrowserFamily {
+	for _, candidate := range []struct {
+		family   BrowserFamily
+		settings map[http2.SettingID]uint32
+	}{
+		{Chromium, GetChromiumH2Settings()},
+		{Gecko, GetGeckoH2Settings()},
+		{WebKit, GetWebKitH2Settings()},
+	} {
+		if h2SettingsNear(settings, candidate.settings, 0.2) {
+			return candidate.family
+		}
+	}
+	return ""
+}
+
+func h2SettingsNear(settings, base map[http2.SettingID]uint32, tolerance float64) bool {
+	if len(settings) != len(base) {
+		return false
+	}
+	for id, want := range base {
+		got, ok := settings[id]
+		if !ok {
+			return false
+		}
+		delta := float64(want) * tolerance
+		if float64(got) < float64(want)-delta || float64(got) > float64(want)+delta {
+			return false
+		}
+	}
+	return true
+}
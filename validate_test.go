@@ -0,0 +1,135 @@
+package legitagent
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func hasRule(issues []Issue, rule string) bool {
+	for _, issue := range issues {
+		if issue.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Consistent Firefox Agent", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserFirefox), WithOS(OSLinux), WithPlatforms(PlatformDesktop))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		if issues := Validate(agent); len(issues) > 0 {
+			t.Errorf("Expected no issues, got %v", issues)
+		}
+	})
+
+	t.Run("Firefox UA With Chrome Layers", func(t *testing.T) {
+		agent, err := FromUserAgentString("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0", RequestTypeNavigate)
+		if err != nil {
+			t.Fatalf("FromUserAgentString failed: %v", err)
+		}
+		agent.ClientHelloID = utls.HelloChrome_120
+		agent.H2Settings = GetChromiumH2Settings()
+		agent.H2WindowUpdate = chromiumH2WindowUpdate
+
+		issues := Validate(agent)
+		for _, rule := range []string{RuleTLSFamily, RuleH2Family, RuleH2WindowUpdate} {
+			if !hasRule(issues, rule) {
+				t.Errorf("Expected %s issue, got %v", rule, issues)
+			}
+		}
+		if !HasErrors(issues) {
+			t.Error("Expected error severity issues")
+		}
+	})
+
+	t.Run("Chromium On iOS", func(t *testing.T) {
+		agent := &Agent{
+			UserAgent:     "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5_1 like Mac OS X) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.7255.1 Mobile Safari/537.36",
+			ClientHelloID: utls.HelloChrome_120,
+		}
+		if issues := Validate(agent); !hasRule(issues, RuleChromiumOnIOS) {
+			t.Errorf("Expected %s issue, got %v", RuleChromiumOnIOS, issues)
+		}
+	})
+
+	t.Run("Partial Client Hints", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserChrome), WithOS(OSWindows), WithPlatforms(PlatformDesktop))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		agent.Headers.Del("sec-ch-ua-mobile")
+		agent.Headers.Set("sec-ch-ua-platform", `"macOS"`)
+
+		issues := Validate(agent)
+		for _, rule := range []string{RuleClientHintsPartial, RuleClientHintsPlatform, RuleHeaderOrder} {
+			if !hasRule(issues, rule) {
+				t.Errorf("Expected %s issue, got %v", rule, issues)
+			}
+		}
+	})
+
+	t.Run("Client Hints On Safari", func(t *testing.T) {
+		g := NewGenerator(WithBrowsers(BrowserSafari), WithPlatforms(PlatformDesktop))
+		agent, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		defer g.ReleaseAgent(agent)
+
+		agent.Headers.Set("sec-ch-ua-mobile", "?0")
+		agent.HeaderOrder = append(agent.HeaderOrder, "sec-ch-ua-mobile")
+
+		if issues := Validate(agent); !hasRule(issues, RuleClientHintsUnexpected) {
+			t.Errorf("Expected %s issue, got %v", RuleClientHintsUnexpected, issues)
+		}
+	})
+}
+
+func TestWithValidation(t *testing.T) {
+	t.Run("Regenerate", func(t *testing.T) {
+		g := NewGenerator(WithValidation(ValidationRegenerate), WithFingerprintProfile(FingerprintProfileExtreme))
+		for i := 0; i < 200; i++ {
+			agent, err := g.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if issues := Validate(agent); HasErrors(issues) {
+				t.Fatalf("Generated invalid agent %q: %v", agent.UserAgent, issues)
+			}
+			g.ReleaseAgent(agent)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		fsys := fstest.MapFS{"mismatch.json": {Data: []byte(`{"schema": 1, "entries": [{"browser": "firefox", "version": 128, "hello_id": "Chrome-120"}]}`)}}
+		g := NewGenerator(
+			WithValidation(ValidationReject),
+			WithProfilePack(fsys),
+			WithBrowsers(BrowserFirefox),
+			WithVersionRange(128, 128),
+			WithOS(OSLinux),
+		)
+
+		_, err := g.Generate()
+		if !errors.Is(err, ErrInvalidAgent) {
+			t.Fatalf("Expected ErrInvalidAgent, got %v", err)
+		}
+
+		var verr *ValidationError
+		if !errors.As(err, &verr) || !hasRule(verr.Issues, RuleTLSFamily) {
+			t.Errorf("Expected %s issue in validation error, got %v", RuleTLSFamily, err)
+		}
+	})
+}